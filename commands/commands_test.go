@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/protolambda/ask"
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zcli/spec_types"
+	"github.com/protolambda/zcli/util"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// minimalSpecFlags select the minimal config and presets.
+var minimalSpecFlags = []string{
+	"--config=minimal",
+	"--preset-phase0=minimal",
+	"--preset-altair=minimal",
+	"--preset-bellatrix=minimal",
+	"--preset-capella=minimal",
+	"--preset-deneb=minimal",
+	"--preset-electra=minimal",
+}
+
+// minimalArgs prefixes the arguments with the flags of the minimal spec.
+func minimalArgs(args ...string) []string {
+	return append(append([]string{}, minimalSpecFlags...), args...)
+}
+
+// testValidatorCount is the number of validators in the genesis state of the tests.
+const testValidatorCount = 64
+
+// testKeys returns the secret keys of the validators in the genesis state of the tests.
+func testKeys(t *testing.T) []*blsu.SecretKey {
+	t.Helper()
+	keys := make([]*blsu.SecretKey, testValidatorCount)
+	for i := range keys {
+		var b [32]byte
+		binary.BigEndian.PutUint64(b[24:], uint64(i+1))
+		keys[i] = new(blsu.SecretKey)
+		if err := keys[i].Deserialize(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+// genesisPhases are the phases that genesisState can upgrade the genesis state to, in order.
+var genesisPhases = []string{"phase0", "altair", "bellatrix", "capella", "deneb", "electra"}
+
+// genesisState creates a minimal genesis state, with all validators active, of the given phase.
+func genesisState(t *testing.T, phase string) (common.BeaconState, *common.EpochsContext) {
+	t.Helper()
+	spec := configs.Minimal
+	validators := make([]phase0.KickstartValidatorData, testValidatorCount)
+	for i, key := range testKeys(t) {
+		pub, err := blsu.SkToPk(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validators[i] = phase0.KickstartValidatorData{
+			Pubkey:  pub.Serialize(),
+			Balance: spec.MAX_EFFECTIVE_BALANCE,
+		}
+		validators[i].WithdrawalCredentials[31] = byte(i)
+	}
+	state, epc, err := phase0.KickStartState(spec, common.Root{0x42}, 1600000000, validators)
+	if err != nil {
+		t.Fatalf("failed to create genesis state: %v", err)
+	}
+	var out common.BeaconState = state
+	for i := 1; genesisPhases[i-1] != phase; i++ {
+		if i == len(genesisPhases) {
+			t.Fatalf("no genesis state for phase %s", phase)
+		}
+		fork, err := spec_types.ForkByPhase(genesisPhases[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err = fork.Upgrade(spec, epc, out)
+		if err != nil {
+			t.Fatalf("failed to upgrade genesis state to %s: %v", genesisPhases[i], err)
+		}
+	}
+	return out, epc
+}
+
+// writeInput writes the object as SSZ to a temporary file, and returns the input path of it.
+func writeInput(t *testing.T, name string, obj interface{}) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name+".ssz")
+	out := util.ObjOutput("ssz:" + path)
+	if err := out.Write(obj); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return "ssz:" + path
+}
+
+// writeState writes the state as SSZ to a temporary file, and returns the input path of it.
+func writeState(t *testing.T, state common.BeaconState) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "state.ssz")
+	out := util.StateOutput("ssz:" + path)
+	if err := out.Write(configs.Minimal, state); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+	return "ssz:" + path
+}
+
+// runCmd runs the command with the arguments, and returns what it wrote to STDOUT.
+func runCmd(t *testing.T, cmd interface{}, args ...string) (string, error) {
+	t.Helper()
+	descr, err := ask.Load(cmd)
+	if err != nil {
+		t.Fatalf("failed to load command: %v", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		stdout <- string(data)
+	}()
+	prev := os.Stdout
+	os.Stdout = w
+	_, err = descr.Execute(context.Background(), nil, args...)
+	os.Stdout = prev
+	_ = w.Close()
+	return <-stdout, err
+}
+
+// routeCmd gets the sub-command at the routes, like the arguments "lightclient bootstrap altair".
+func routeCmd(t *testing.T, cmd interface{}, routes ...string) interface{} {
+	t.Helper()
+	for _, route := range routes {
+		router, ok := cmd.(interface {
+			Cmd(route string) (interface{}, error)
+		})
+		if !ok {
+			t.Fatalf("command %T has no sub-commands", cmd)
+		}
+		var err error
+		if cmd, err = router.Cmd(route); err != nil {
+			t.Fatalf("failed to route %q: %v", route, err)
+		}
+	}
+	return cmd
+}
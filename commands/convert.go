@@ -15,15 +15,15 @@ func (c *ConvertCmd) Help() string {
 }
 
 func (c *ConvertCmd) Cmd(route string) (cmd interface{}, err error) {
-	phaseTypes, ok := spec_types.TypesByPhase[route]
-	if !ok {
-		return nil, fmt.Errorf("unrecognized phase: %s", route)
+	phaseTypes, err := phaseTypes(route)
+	if err != nil {
+		return nil, err
 	}
 	return &ConvertPhaseCmd{PhaseName: route, Types: phaseTypes}, nil
 }
 
 func (c *ConvertCmd) Routes() []string {
-	return spec_types.Phases
+	return phaseRoutes()
 }
 
 type ConvertPhaseCmd struct {
@@ -57,8 +57,12 @@ func (c *ConvertObjCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	obj := c.Type.Alloc(spec)
-	if err := c.Input.Read(obj); err != nil {
+	c.PhaseName, c.Type, err = resolveType(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
+		return err
+	}
+	obj, err := readSpecObj(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
 		return fmt.Errorf("failed to read input: %v", err)
 	}
 	if err := c.Output.Write(obj); err != nil {
@@ -2,11 +2,14 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/protolambda/messagediff"
 	"github.com/protolambda/zcli/spec_types"
 	"github.com/protolambda/zcli/util"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/zrnt/eth2/configs"
+	"os"
 )
 
 type DiffCmd struct{}
@@ -16,15 +19,15 @@ func (c *DiffCmd) Help() string {
 }
 
 func (c *DiffCmd) Cmd(route string) (cmd interface{}, err error) {
-	phaseTypes, ok := spec_types.TypesByPhase[route]
-	if !ok {
-		return nil, fmt.Errorf("unrecognized phase: %s", route)
+	phaseTypes, err := phaseTypes(route)
+	if err != nil {
+		return nil, err
 	}
 	return &DiffPhaseCmd{PhaseName: route, Types: phaseTypes}, nil
 }
 
 func (c *DiffCmd) Routes() []string {
-	return spec_types.Phases
+	return phaseRoutes()
 }
 
 type DiffPhaseCmd struct {
@@ -49,8 +52,12 @@ type DiffObjCmd struct {
 	TypeName            string
 	Type                spec_types.SpecType
 	configs.SpecOptions `ask:"."`
-	InputA              util.ObjInput `ask:"<a>" help:"Input A, prefix with format, empty path for STDIN"`
-	InputB              util.ObjInput `ask:"<b>" help:"Input B, prefix with format, empty path for STDIN"`
+	InputA              util.ObjInput     `ask:"<a>" help:"Input A, prefix with format, empty path for STDIN"`
+	InputB              util.ObjInput     `ask:"<b>" help:"Input B, prefix with format, empty path for STDIN"`
+	Tree                bool              `ask:"--tree" help:"Compare the merkle trees of A and B, skipping identical subtrees, and list the differing paths with their gindices"`
+	MaxDepth            int               `ask:"--max-depth" help:"Maximum number of path elements to descend into, 0 for unlimited (implies --tree)"`
+	Format              util.RecordFormat `ask:"--format" help:"Output format: text, or json, ndjson or csv records of the differences (implies --tree)"`
+	Ignore              util.PathsFlag    `ask:"--ignore" help:"Paths to ignore differences at, e.g. 'latest_block_header/state_root' (implies --tree)"`
 }
 
 func (c *DiffObjCmd) Run(ctx context.Context, args ...string) error {
@@ -58,18 +65,78 @@ func (c *DiffObjCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	objA := c.Type.Alloc(spec)
-	if err := c.InputA.Read(objA); err != nil {
+	c.PhaseName, c.Type, err = resolveType(spec, c.PhaseName, c.TypeName, c.Type, &c.InputA)
+	if err != nil {
+		return err
+	}
+	objA, err := readSpecObj(spec, c.PhaseName, c.TypeName, c.Type, &c.InputA)
+	if err != nil {
 		return fmt.Errorf("failed to read input A: %v", err)
 	}
-	objB := c.Type.Alloc(spec)
-	if err := c.InputB.Read(objB); err != nil {
+	objB, err := readSpecObj(spec, c.PhaseName, c.TypeName, c.Type, &c.InputB)
+	if err != nil {
 		return fmt.Errorf("failed to read input B: %v", err)
 	}
+	if c.Format != "" && c.Format != util.TextRecords {
+		c.Tree = true
+	}
+	if len(c.Ignore) > 0 || c.MaxDepth != 0 {
+		c.Tree = true
+	}
+	if c.Tree {
+		return c.treeDiff(spec, objA, objB)
+	}
 	if diff, equal := messagediff.PrettyDiff(objA, objB, messagediff.SliceWeakEmptyOption{}); equal {
 		fmt.Printf("%s (%s) objects A and B are equal\n", c.TypeName, c.PhaseName)
 	} else {
 		fmt.Printf("%s (%s) objects A and B are different:\n%s\n", c.TypeName, c.PhaseName, diff)
+		return ErrObjectsDiffer
 	}
 	return nil
 }
+
+// ErrObjectsDiffer is returned when the diffed objects are different, to exit with code 1 instead of 2.
+var ErrObjectsDiffer = errors.New("objects A and B are different")
+
+func (c *DiffObjCmd) treeDiff(spec *common.Spec, objA, objB common.SSZObj) error {
+	typ := c.Type.TypeDef(spec)
+	viewA, err := util.TreeView(objA, typ)
+	if err != nil {
+		return fmt.Errorf("failed to convert A to tree: %v", err)
+	}
+	viewB, err := util.TreeView(objB, typ)
+	if err != nil {
+		return fmt.Errorf("failed to convert B to tree: %v", err)
+	}
+	opts := util.DiffOptions{MaxDepth: c.MaxDepth, Ignore: c.Ignore}
+	if err := opts.CheckIgnore(typ); err != nil {
+		return err
+	}
+	diffs, err := util.DiffTrees(viewA, viewB, opts)
+	if err != nil {
+		return err
+	}
+	out := util.NewRecordWriter(os.Stdout, c.Format)
+	if len(diffs) == 0 {
+		if err := out.Textf("%s (%s) objects A and B are equal", c.TypeName, c.PhaseName); err != nil {
+			return err
+		}
+		return out.Close()
+	}
+	if err := out.Textf("%s (%s) objects A and B are different (A != B):", c.TypeName, c.PhaseName); err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		rec, err := d.Record()
+		if err != nil {
+			return err
+		}
+		if err := out.Write(rec); err != nil {
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return ErrObjectsDiffer
+}
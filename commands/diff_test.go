@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, _ := genesisState(t, "phase0")
+	b, _ := genesisState(t, "phase0")
+	if err := b.SetSlot(3); err != nil {
+		t.Fatal(err)
+	}
+	inputA, inputB := writeState(t, a), writeState(t, b)
+	missing := "ssz:" + filepath.Join(t.TempDir(), "missing.ssz")
+
+	cases := []struct {
+		name   string
+		args   []string
+		differ bool
+		fails  bool
+		output string
+	}{
+		{"equal", []string{inputA, inputA}, false, false, "are equal"},
+		{"different", []string{inputA, inputB}, true, false, "are different"},
+		// the merkle tree diff is marked with (A != B)
+		{"max depth implies tree", []string{"--max-depth=1", inputA, inputB}, true, false, "(A != B)"},
+		{"unreadable input", []string{inputA, missing}, false, true, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := runCmd(t, routeCmd(t, &DiffCmd{}, "phase0", "BeaconState"), minimalArgs(c.args...)...)
+			if differ := errors.Is(err, ErrObjectsDiffer); differ != c.differ {
+				t.Fatalf("got error %v, expected objects to differ: %v", err, c.differ)
+			}
+			if fails := err != nil && !c.differ; fails != c.fails {
+				t.Fatalf("got error %v, expected failure: %v", err, c.fails)
+			}
+			if !strings.Contains(out, c.output) {
+				t.Fatalf("output does not contain %q:\n%s", c.output, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package commands
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/electra"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/util/hashing"
+	"github.com/protolambda/ztyp/view"
+
+	"github.com/protolambda/zcli/spec_types"
+)
+
+// ZRNT only implements the validator sampling before Electra.
+// Electra samples with 16-bit random values, weighted by MAX_EFFECTIVE_BALANCE_ELECTRA,
+// for both the proposers and the sync committees. This is computed here.
+//
+// ZRNT does not implement the Electra epoch and block processing either.
+// These are implemented in electra_epoch.go and electra_block.go, following the consensus-specs v1.5.0,
+// with the registry changes of Electra (churn, exits, slashings and new validators) implemented here.
+
+// newPhaseEpochsContext creates an epochs-context for the state,
+// with the proposers of the current epoch computed with the sampling of the phase.
+func newPhaseEpochsContext(spec *common.Spec, state common.BeaconState, phase string) (*common.EpochsContext, error) {
+	epc, err := common.NewEpochsContext(spec, state)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadPhaseProposers(spec, epc, state, phase); err != nil {
+		return nil, err
+	}
+	return epc, nil
+}
+
+// loadPhaseProposers replaces the proposers of the epochs-context with the Electra proposers, if the phase is Electra.
+func loadPhaseProposers(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, phase string) error {
+	if phase != "electra" {
+		return nil
+	}
+	epoch := epc.CurrentEpoch.Epoch
+	startSlot, err := spec.EpochStartSlot(epoch)
+	if err != nil {
+		return err
+	}
+	proposers := make([]common.ValidatorIndex, spec.SLOTS_PER_EPOCH)
+	for i := range proposers {
+		proposers[i], err = electraBeaconProposer(spec, state, epc.CurrentEpoch.ActiveIndices, startSlot+common.Slot(i))
+		if err != nil {
+			return err
+		}
+	}
+	props := *epc.Proposers
+	props.Proposers = proposers
+	epc.Proposers = &props
+	return nil
+}
+
+// beaconProposer looks up the proposer of a slot in the epoch of the epochs-context.
+func beaconProposer(spec *common.Spec, epc *common.EpochsContext, state common.BeaconState, phase string, slot common.Slot) (common.ValidatorIndex, error) {
+	if phase != "electra" {
+		return epc.GetBeaconProposer(slot)
+	}
+	return electraBeaconProposer(spec, state, epc.CurrentEpoch.ActiveIndices, slot)
+}
+
+// electraBeaconProposer computes the proposer like compute_proposer_index of Electra.
+func electraBeaconProposer(spec *common.Spec, state common.BeaconState, active []common.ValidatorIndex, slot common.Slot) (common.ValidatorIndex, error) {
+	if len(active) == 0 {
+		return 0, errors.New("no active validators available to compute proposer")
+	}
+	mixes, err := state.RandaoMixes()
+	if err != nil {
+		return 0, err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return 0, err
+	}
+	epochSeed, err := common.GetSeed(spec, mixes, spec.SlotToEpoch(slot), common.DOMAIN_BEACON_PROPOSER)
+	if err != nil {
+		return 0, err
+	}
+	var buf [32 + 8]byte
+	copy(buf[:32], epochSeed[:])
+	binary.LittleEndian.PutUint64(buf[32:], uint64(slot))
+	seed := common.Root(hashing.GetHashFn()(buf[:]))
+
+	for i := uint64(0); i < 1<<20; i++ {
+		candidate, ok, err := electraSample(spec, vals, active, seed, i)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return candidate, nil
+		}
+	}
+	return 0, errors.New("random (but balance-biased) sampling should always find a proposer")
+}
+
+// electraSyncCommitteeIndices computes the indices of the next sync committee,
+// like get_next_sync_committee_indices of Electra.
+func electraSyncCommitteeIndices(spec *common.Spec, state common.BeaconState, epoch common.Epoch, active []common.ValidatorIndex) ([]common.ValidatorIndex, error) {
+	if len(active) == 0 {
+		return nil, errors.New("no active validators to compute sync committee from")
+	}
+	mixes, err := state.RandaoMixes()
+	if err != nil {
+		return nil, err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return nil, err
+	}
+	seed, err := common.GetSeed(spec, mixes, epoch, common.DOMAIN_SYNC_COMMITTEE)
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]common.ValidatorIndex, 0, spec.SYNC_COMMITTEE_SIZE)
+	for i := uint64(0); uint64(len(indices)) < uint64(spec.SYNC_COMMITTEE_SIZE); i++ {
+		candidate, ok, err := electraSample(spec, vals, active, seed, i)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			indices = append(indices, candidate)
+		}
+	}
+	return indices, nil
+}
+
+// processElectraSyncCommitteeUpdates rotates the sync committees at the end of a sync committee period,
+// like process_sync_committee_updates, with the Electra sync committee selection.
+func processElectraSyncCommitteeUpdates(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state common.SyncCommitteeBeaconState) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	nextEpoch := epc.NextEpoch.Epoch
+	if nextEpoch%spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD != 0 {
+		return nil
+	}
+	indices, err := electraSyncCommitteeIndices(spec, state, nextEpoch, epc.NextEpoch.ActiveIndices)
+	if err != nil {
+		return fmt.Errorf("failed to compute sync committee indices for epoch %d: %v", nextEpoch, err)
+	}
+	next, err := common.IndicesToSyncCommittee(indices, epc.ValidatorPubkeyCache)
+	if err != nil {
+		return fmt.Errorf("failed to update sync committee: %v", err)
+	}
+	nextView, err := next.View(spec)
+	if err != nil {
+		return fmt.Errorf("failed to convert sync committee to state tree representation: %v", err)
+	}
+	if err := state.RotateSyncCommittee(nextView); err != nil {
+		return fmt.Errorf("failed to rotate sync committee: %v", err)
+	}
+	return nil
+}
+
+// electraSample returns the i-th candidate of the shuffled active validators,
+// and if the candidate is selected by its effective balance.
+func electraSample(spec *common.Spec, vals common.ValidatorRegistry, active []common.ValidatorIndex, seed common.Root, i uint64) (common.ValidatorIndex, bool, error) {
+	const maxRandomValue = 1<<16 - 1
+	total := uint64(len(active))
+	shuffled := common.PermuteIndex(uint8(spec.SHUFFLE_ROUND_COUNT), common.ValidatorIndex(i%total), total, seed)
+	candidate := active[shuffled]
+	var buf [32 + 8]byte
+	copy(buf[:32], seed[:])
+	binary.LittleEndian.PutUint64(buf[32:], i/16)
+	randomBytes := hashing.GetHashFn()(buf[:])
+	offset := (i % 16) * 2
+	randomValue := binary.LittleEndian.Uint16(randomBytes[offset : offset+2])
+	val, err := vals.Validator(candidate)
+	if err != nil {
+		return 0, false, err
+	}
+	effectiveBalance, err := val.EffectiveBalance()
+	if err != nil {
+		return 0, false, err
+	}
+	return candidate, effectiveBalance*maxRandomValue >= spec.MAX_EFFECTIVE_BALANCE_ELECTRA*common.Gwei(randomValue), nil
+}
+
+// electraValidatorIndex looks up the index of the validator with the pubkey, if it is in the registry.
+func electraValidatorIndex(epc *common.EpochsContext, state *electra.BeaconStateView, pubkey common.BLSPubkey) (common.ValidatorIndex, bool, error) {
+	vals, err := state.Validators()
+	if err != nil {
+		return 0, false, err
+	}
+	count, err := vals.ValidatorCount()
+	if err != nil {
+		return 0, false, err
+	}
+	index, ok := epc.ValidatorPubkeyCache.ValidatorIndex(pubkey)
+	// it exists if: it exists in the pubkey cache AND the validator index is lower than the current validator count.
+	return index, ok && uint64(index) < count, nil
+}
+
+// consumeChurn schedules the balance in the churn, starting at the earliest epoch,
+// and returns the epoch it is scheduled in and the churn that is left to consume in that epoch.
+func consumeChurn(stateEarliest common.Epoch, stateToConsume common.Gwei, earliest common.Epoch, churn common.Gwei, balance common.Gwei) (common.Epoch, common.Gwei) {
+	if stateEarliest > earliest {
+		earliest = stateEarliest
+	}
+	toConsume := stateToConsume
+	if stateEarliest < earliest {
+		toConsume = churn
+	}
+	if balance > toConsume {
+		additionalEpochs := (balance-toConsume-1)/churn + 1
+		earliest += common.Epoch(additionalEpochs)
+		toConsume += additionalEpochs * churn
+	}
+	return earliest, toConsume - balance
+}
+
+// computeExitEpochAndUpdateChurn is compute_exit_epoch_and_update_churn.
+func computeExitEpochAndUpdateChurn(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, exitBalance common.Gwei) (common.Epoch, error) {
+	stateEarliest, err := state.EarliestExitEpoch()
+	if err != nil {
+		return 0, err
+	}
+	stateToConsume, err := state.ExitBalanceToConsume()
+	if err != nil {
+		return 0, err
+	}
+	earliest, toConsume := consumeChurn(stateEarliest, stateToConsume,
+		spec.ComputeActivationExitEpoch(epc.CurrentEpoch.Epoch),
+		spec_types.ActivationExitChurnLimit(spec, epc.TotalActiveStake), exitBalance)
+	if err := state.SetExitBalanceToConsume(toConsume); err != nil {
+		return 0, err
+	}
+	if err := state.SetEarliestExitEpoch(earliest); err != nil {
+		return 0, err
+	}
+	return earliest, nil
+}
+
+// computeConsolidationEpochAndUpdateChurn is compute_consolidation_epoch_and_update_churn.
+func computeConsolidationEpochAndUpdateChurn(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, consolidationBalance common.Gwei) (common.Epoch, error) {
+	stateEarliest, err := state.EarliestConsolidationEpoch()
+	if err != nil {
+		return 0, err
+	}
+	stateToConsume, err := state.ConsolidationBalanceToConsume()
+	if err != nil {
+		return 0, err
+	}
+	earliest, toConsume := consumeChurn(stateEarliest, stateToConsume,
+		spec.ComputeActivationExitEpoch(epc.CurrentEpoch.Epoch),
+		spec_types.ConsolidationChurnLimit(spec, epc.TotalActiveStake), consolidationBalance)
+	if err := state.SetConsolidationBalanceToConsume(toConsume); err != nil {
+		return 0, err
+	}
+	if err := state.SetEarliestConsolidationEpoch(earliest); err != nil {
+		return 0, err
+	}
+	return earliest, nil
+}
+
+// initiateElectraValidatorExit schedules the exit of the validator with the balance churn, like initiate_validator_exit.
+func initiateElectraValidatorExit(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, index common.ValidatorIndex) error {
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	v, err := vals.Validator(index)
+	if err != nil {
+		return err
+	}
+	if exitEpoch, err := v.ExitEpoch(); err != nil {
+		return err
+	} else if exitEpoch != common.FAR_FUTURE_EPOCH {
+		return nil
+	}
+	effectiveBalance, err := v.EffectiveBalance()
+	if err != nil {
+		return err
+	}
+	exitQueueEpoch, err := computeExitEpochAndUpdateChurn(spec, epc, state, effectiveBalance)
+	if err != nil {
+		return err
+	}
+	if err := v.SetExitEpoch(exitQueueEpoch); err != nil {
+		return err
+	}
+	return v.SetWithdrawableEpoch(exitQueueEpoch + spec.MIN_VALIDATOR_WITHDRAWABILITY_DELAY)
+}
+
+// slashElectraValidator slashes the validator with the Electra penalty and rewards, like slash_validator.
+func slashElectraValidator(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView,
+	slashedIndex common.ValidatorIndex, whistleblowerIndex *common.ValidatorIndex) error {
+
+	currentEpoch := epc.CurrentEpoch.Epoch
+	if err := initiateElectraValidatorExit(spec, epc, state, slashedIndex); err != nil {
+		return err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	v, err := vals.Validator(slashedIndex)
+	if err != nil {
+		return err
+	}
+	if err := v.MakeSlashed(); err != nil {
+		return err
+	}
+	prevWithdrawalEpoch, err := v.WithdrawableEpoch()
+	if err != nil {
+		return err
+	}
+	if withdrawalEpoch := currentEpoch + spec.EPOCHS_PER_SLASHINGS_VECTOR; withdrawalEpoch > prevWithdrawalEpoch {
+		if err := v.SetWithdrawableEpoch(withdrawalEpoch); err != nil {
+			return err
+		}
+	}
+	effectiveBalance, err := v.EffectiveBalance()
+	if err != nil {
+		return err
+	}
+	slashings, err := state.Slashings()
+	if err != nil {
+		return err
+	}
+	if err := slashings.AddSlashing(currentEpoch, effectiveBalance); err != nil {
+		return err
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	if err := common.DecreaseBalance(bals, slashedIndex, effectiveBalance/common.Gwei(spec.MIN_SLASHING_PENALTY_QUOTIENT_ELECTRA)); err != nil {
+		return err
+	}
+	slot, err := state.Slot()
+	if err != nil {
+		return err
+	}
+	propIndex, err := epc.GetBeaconProposer(slot)
+	if err != nil {
+		return err
+	}
+	if whistleblowerIndex == nil {
+		whistleblowerIndex = &propIndex
+	}
+	whistleblowerReward := effectiveBalance / common.Gwei(spec.WHISTLEBLOWER_REWARD_QUOTIENT_ELECTRA)
+	proposerReward := whistleblowerReward * altair.PROPOSER_WEIGHT / altair.WEIGHT_DENOMINATOR
+	if err := common.IncreaseBalance(bals, propIndex, proposerReward); err != nil {
+		return err
+	}
+	return common.IncreaseBalance(bals, *whistleblowerIndex, whistleblowerReward-proposerReward)
+}
+
+// addElectraValidator appends a validator to the registry, like add_validator_to_registry.
+func addElectraValidator(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView,
+	pubkey common.BLSPubkey, withdrawalCreds common.Root, amount common.Gwei) error {
+
+	effBalance := amount - amount%spec.EFFECTIVE_BALANCE_INCREMENT
+	if max := spec_types.MaxEffectiveBalance(spec, withdrawalCreds); effBalance > max {
+		effBalance = max
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	registry, ok := vals.(*phase0.ValidatorsRegistryView)
+	if !ok {
+		return fmt.Errorf("unexpected validator registry type %T", vals)
+	}
+	index, err := registry.ValidatorCount()
+	if err != nil {
+		return err
+	}
+	validator := phase0.Validator{
+		Pubkey:                     pubkey,
+		WithdrawalCredentials:      withdrawalCreds,
+		ActivationEligibilityEpoch: common.FAR_FUTURE_EPOCH,
+		ActivationEpoch:            common.FAR_FUTURE_EPOCH,
+		ExitEpoch:                  common.FAR_FUTURE_EPOCH,
+		WithdrawableEpoch:          common.FAR_FUTURE_EPOCH,
+		EffectiveBalance:           effBalance,
+	}
+	if err := registry.Append(validator.View()); err != nil {
+		return err
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	if err := bals.AppendBalance(amount); err != nil {
+		return err
+	}
+	prevPart, err := state.PreviousEpochParticipation()
+	if err != nil {
+		return err
+	}
+	if err := prevPart.Append(view.Uint8View(0)); err != nil {
+		return err
+	}
+	currPart, err := state.CurrentEpochParticipation()
+	if err != nil {
+		return err
+	}
+	if err := currPart.Append(view.Uint8View(0)); err != nil {
+		return err
+	}
+	scores, err := state.InactivityScores()
+	if err != nil {
+		return err
+	}
+	if err := scores.Append(view.Uint64View(0)); err != nil {
+		return err
+	}
+	pc, err := epc.ValidatorPubkeyCache.AddValidator(common.ValidatorIndex(index), pubkey)
+	if err != nil {
+		return err
+	}
+	epc.ValidatorPubkeyCache = pc
+	return nil
+}
+
+// isValidDepositSignature verifies the proof of possession of a deposit, like is_valid_deposit_signature.
+func isValidDepositSignature(spec *common.Spec, pubkey common.BLSPubkey, withdrawalCreds common.Root, amount common.Gwei, signature common.BLSSignature) bool {
+	blsPub, err := pubkey.Pubkey()
+	if err != nil {
+		return false
+	}
+	sig, err := signature.Signature()
+	if err != nil {
+		return false
+	}
+	data := common.DepositData{Pubkey: pubkey, WithdrawalCredentials: withdrawalCreds, Amount: amount}
+	// Fork-agnostic domain since deposits are valid across forks
+	signingRoot := common.ComputeSigningRoot(data.MessageRoot(),
+		common.ComputeDomain(common.DOMAIN_DEPOSIT, spec.GENESIS_FORK_VERSION, common.Root{}))
+	return blsu.Verify(blsPub, signingRoot[:], sig)
+}
+
+// applyPendingDeposit adds the validator of a pending deposit, or tops up its balance, like apply_pending_deposit.
+func applyPendingDeposit(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, deposit *common.PendingDeposit) error {
+	index, exists, err := electraValidatorIndex(epc, state, deposit.Pubkey)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// invalid signatures are OK, the deposit is dropped
+		if !isValidDepositSignature(spec, deposit.Pubkey, deposit.WithdrawalCredentials, deposit.Amount, deposit.Signature) {
+			return nil
+		}
+		return addElectraValidator(spec, epc, state, deposit.Pubkey, deposit.WithdrawalCredentials, deposit.Amount)
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	return common.IncreaseBalance(bals, index, deposit.Amount)
+}
+
+// pendingBalanceToWithdraw sums the pending partial withdrawals of the validator, like get_pending_balance_to_withdraw.
+func pendingBalanceToWithdraw(spec *common.Spec, state *electra.BeaconStateView, index common.ValidatorIndex) (common.Gwei, error) {
+	withdrawals, err := spec_types.PendingPartialWithdrawals(spec, state)
+	if err != nil {
+		return 0, err
+	}
+	total := common.Gwei(0)
+	for _, w := range withdrawals {
+		if w.ValidatorIndex == index {
+			total += w.Amount
+		}
+	}
+	return total, nil
+}
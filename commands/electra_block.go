@@ -0,0 +1,932 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/electra"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/util/merkle"
+	"github.com/protolambda/ztyp/tree"
+
+	"github.com/protolambda/zcli/spec_types"
+)
+
+// processElectraBlock is process_block of Electra.
+func processElectraBlock(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, benv *common.BeaconBlockEnvelope) error {
+	body, ok := benv.Body.(*electra.BeaconBlockBody)
+	if !ok {
+		return fmt.Errorf("unexpected block type %T in Electra ProcessBlock", benv.Body)
+	}
+	expectedProposer, err := epc.GetBeaconProposer(benv.Slot)
+	if err != nil {
+		return err
+	}
+	if err := common.ProcessHeader(ctx, spec, state, &benv.BeaconBlockHeader, expectedProposer); err != nil {
+		return err
+	}
+	if err := processElectraWithdrawals(ctx, spec, state, &body.ExecutionPayload); err != nil {
+		return err
+	}
+	eng, ok := spec.ExecutionEngine.(deneb.ExecutionEngine)
+	if !ok {
+		return fmt.Errorf("provided execution-engine interface does not support Electra: %T", spec.ExecutionEngine)
+	}
+	if err := processElectraExecutionPayload(ctx, spec, state, body, eng); err != nil {
+		return err
+	}
+	if err := phase0.ProcessRandaoReveal(ctx, spec, epc, state, body.RandaoReveal); err != nil {
+		return err
+	}
+	if err := phase0.ProcessEth1Vote(ctx, spec, epc, state, body.Eth1Data); err != nil {
+		return err
+	}
+	if err := processElectraOperations(ctx, spec, epc, state, body); err != nil {
+		return err
+	}
+	return altair.ProcessSyncAggregate(ctx, spec, epc, state, &body.SyncAggregate)
+}
+
+// electraExpectedWithdrawals is get_expected_withdrawals of Electra:
+// the pending partial withdrawals are withdrawn first, then the validators are swept.
+// It returns the withdrawals and the number of pending partial withdrawals that were processed.
+func electraExpectedWithdrawals(spec *common.Spec, state *electra.BeaconStateView) (common.Withdrawals, int, error) {
+	slot, err := state.Slot()
+	if err != nil {
+		return nil, 0, err
+	}
+	epoch := spec.SlotToEpoch(slot)
+	withdrawalIndex, err := state.NextWithdrawalIndex()
+	if err != nil {
+		return nil, 0, err
+	}
+	validatorIndex, err := state.NextWithdrawalValidatorIndex()
+	if err != nil {
+		return nil, 0, err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return nil, 0, err
+	}
+	validatorCount, err := vals.ValidatorCount()
+	if err != nil {
+		return nil, 0, err
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return nil, 0, err
+	}
+	withdrawals := make(common.Withdrawals, 0)
+	// the balance of the validator, minus what is already withdrawn in this payload
+	remainingBalance := func(index common.ValidatorIndex) (common.Gwei, error) {
+		balance, err := bals.GetBalance(index)
+		if err != nil {
+			return 0, err
+		}
+		for _, w := range withdrawals {
+			if w.ValidatorIndex == index {
+				balance -= w.Amount
+			}
+		}
+		return balance, nil
+	}
+
+	pendingPartials, err := spec_types.PendingPartialWithdrawals(spec, state)
+	if err != nil {
+		return nil, 0, err
+	}
+	processedPartialWithdrawalsCount := 0
+	for _, w := range pendingPartials {
+		if w.WithdrawableEpoch > epoch || uint64(len(withdrawals)) == uint64(spec.MAX_PENDING_PARTIALS_PER_WITHDRAWALS_SWEEP) {
+			break
+		}
+		v, err := vals.Validator(w.ValidatorIndex)
+		if err != nil {
+			return nil, 0, err
+		}
+		var flat common.FlatValidator
+		if err := v.Flatten(&flat); err != nil {
+			return nil, 0, err
+		}
+		balance, err := remainingBalance(w.ValidatorIndex)
+		if err != nil {
+			return nil, 0, err
+		}
+		if flat.ExitEpoch == common.FAR_FUTURE_EPOCH && flat.EffectiveBalance >= spec.MIN_ACTIVATION_BALANCE && balance > spec.MIN_ACTIVATION_BALANCE {
+			amount := balance - spec.MIN_ACTIVATION_BALANCE
+			if w.Amount < amount {
+				amount = w.Amount
+			}
+			withdrawals = append(withdrawals, common.Withdrawal{
+				Index:          withdrawalIndex,
+				ValidatorIndex: w.ValidatorIndex,
+				Address:        capella.Eth1WithdrawalCredential(v),
+				Amount:         amount,
+			})
+			withdrawalIndex += 1
+		}
+		processedPartialWithdrawalsCount += 1
+	}
+
+	bound := validatorCount
+	if max := uint64(spec.MAX_VALIDATORS_PER_WITHDRAWALS_SWEEP); bound > max {
+		bound = max
+	}
+	for i := uint64(0); i < bound; i++ {
+		v, err := vals.Validator(validatorIndex)
+		if err != nil {
+			return nil, 0, err
+		}
+		var flat common.FlatValidator
+		if err := v.Flatten(&flat); err != nil {
+			return nil, 0, err
+		}
+		creds, err := v.WithdrawalCredentials()
+		if err != nil {
+			return nil, 0, err
+		}
+		balance, err := remainingBalance(validatorIndex)
+		if err != nil {
+			return nil, 0, err
+		}
+		maxEffectiveBalance := spec_types.MaxEffectiveBalance(spec, creds)
+		if spec_types.HasExecutionWithdrawalCredential(creds) {
+			if flat.WithdrawableEpoch <= epoch && balance > 0 {
+				withdrawals = append(withdrawals, common.Withdrawal{
+					Index:          withdrawalIndex,
+					ValidatorIndex: validatorIndex,
+					Address:        capella.Eth1WithdrawalCredential(v),
+					Amount:         balance,
+				})
+				withdrawalIndex += 1
+			} else if flat.EffectiveBalance == maxEffectiveBalance && balance > maxEffectiveBalance {
+				withdrawals = append(withdrawals, common.Withdrawal{
+					Index:          withdrawalIndex,
+					ValidatorIndex: validatorIndex,
+					Address:        capella.Eth1WithdrawalCredential(v),
+					Amount:         balance - maxEffectiveBalance,
+				})
+				withdrawalIndex += 1
+			}
+		}
+		if len(withdrawals) == int(spec.MAX_WITHDRAWALS_PER_PAYLOAD) {
+			break
+		}
+		validatorIndex = common.ValidatorIndex(uint64(validatorIndex+1) % validatorCount)
+	}
+	return withdrawals, processedPartialWithdrawalsCount, nil
+}
+
+// processElectraWithdrawals is process_withdrawals of Electra.
+func processElectraWithdrawals(ctx context.Context, spec *common.Spec, state *electra.BeaconStateView, payload *deneb.ExecutionPayload) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	expectedWithdrawals, processedPartialWithdrawalsCount, err := electraExpectedWithdrawals(spec, state)
+	if err != nil {
+		return err
+	}
+	withdrawals := payload.Withdrawals
+	if len(expectedWithdrawals) != len(withdrawals) {
+		return fmt.Errorf("unexpected number of withdrawals in Electra ProcessWithdrawals: want=%d, got=%d", len(expectedWithdrawals), len(withdrawals))
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	for i := range expectedWithdrawals {
+		withdrawal := withdrawals[i]
+		expectedWithdrawal := expectedWithdrawals[i]
+		if withdrawal != expectedWithdrawal {
+			return fmt.Errorf("unexpected withdrawal in Electra ProcessWithdrawals: want=%s, got=%s", expectedWithdrawal, withdrawal)
+		}
+		if err := common.DecreaseBalance(bals, expectedWithdrawal.ValidatorIndex, expectedWithdrawal.Amount); err != nil {
+			return fmt.Errorf("failed to decrease balance: %w", err)
+		}
+	}
+	pendingPartials, err := spec_types.PendingPartialWithdrawals(spec, state)
+	if err != nil {
+		return err
+	}
+	if err := spec_types.SetPendingPartialWithdrawals(spec, state, pendingPartials[processedPartialWithdrawalsCount:]); err != nil {
+		return err
+	}
+	if len(expectedWithdrawals) > 0 {
+		latestWithdrawal := expectedWithdrawals[len(expectedWithdrawals)-1]
+		if err := state.SetNextWithdrawalIndex(latestWithdrawal.Index + 1); err != nil {
+			return fmt.Errorf("failed to set withdrawal index: %w", err)
+		}
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	validatorCount, err := vals.ValidatorCount()
+	if err != nil {
+		return err
+	}
+	if len(expectedWithdrawals) == int(spec.MAX_WITHDRAWALS_PER_PAYLOAD) {
+		latestWithdrawal := expectedWithdrawals[len(expectedWithdrawals)-1]
+		return state.SetNextWithdrawalValidatorIndex(common.ValidatorIndex(uint64(latestWithdrawal.ValidatorIndex+1) % validatorCount))
+	}
+	nextValidatorIndex, err := state.NextWithdrawalValidatorIndex()
+	if err != nil {
+		return err
+	}
+	return state.SetNextWithdrawalValidatorIndex(common.ValidatorIndex((uint64(nextValidatorIndex) + uint64(spec.MAX_VALIDATORS_PER_WITHDRAWALS_SWEEP)) % validatorCount))
+}
+
+// processElectraExecutionPayload is process_execution_payload of Electra, with the Electra blob limit.
+func processElectraExecutionPayload(ctx context.Context, spec *common.Spec, state *electra.BeaconStateView, body *electra.BeaconBlockBody, engine deneb.ExecutionEngine) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if engine == nil {
+		return errors.New("nil execution engine")
+	}
+	payload := &body.ExecutionPayload
+	slot, err := state.Slot()
+	if err != nil {
+		return err
+	}
+	latestExecHeader, err := state.LatestExecutionPayloadHeader()
+	if err != nil {
+		return err
+	}
+	// Verify consistency of the parent hash with respect to the previous execution payload header
+	parent, err := latestExecHeader.Raw()
+	if err != nil {
+		return fmt.Errorf("failed to read previous header: %v", err)
+	}
+	if payload.ParentHash != parent.BlockHash {
+		return fmt.Errorf("expected parent hash %s in execution payload, but got %s",
+			parent.BlockHash, payload.ParentHash)
+	}
+	// Verify prev_randao
+	mixes, err := state.RandaoMixes()
+	if err != nil {
+		return err
+	}
+	expectedMix, err := mixes.GetRandomMix(spec.SlotToEpoch(slot))
+	if err != nil {
+		return err
+	}
+	if payload.PrevRandao != expectedMix {
+		return fmt.Errorf("invalid random data %s, expected %s", payload.PrevRandao, expectedMix)
+	}
+	// Verify timestamp
+	genesisTime, err := state.GenesisTime()
+	if err != nil {
+		return err
+	}
+	if expectedTime, err := spec.TimeAtSlot(slot, genesisTime); err != nil {
+		return fmt.Errorf("slot or genesis time in state is corrupt, cannot compute time: %v", err)
+	} else if payload.Timestamp != expectedTime {
+		return fmt.Errorf("state at slot %d, genesis time %d, expected execution payload time %d, but got %d",
+			slot, genesisTime, expectedTime, payload.Timestamp)
+	}
+	if count := uint64(len(body.BlobKZGCommitments)); count > uint64(spec.MAX_BLOBS_PER_BLOCK_ELECTRA) {
+		return fmt.Errorf("too many blob KZG commitments: %d", count)
+	}
+	versionedHashes := make([]common.Hash32, 0, len(body.BlobKZGCommitments))
+	for _, commit := range body.BlobKZGCommitments {
+		versionedHashes = append(versionedHashes, commit.ToVersionedHash())
+	}
+	latestHeader, err := state.LatestBlockHeader()
+	if err != nil {
+		return fmt.Errorf("failed to get current in-progresss latest beacon-block-header from beacon state: %w", err)
+	}
+	if valid, err := deneb.VerifyAndNotifyNewPayload(ctx, engine, &deneb.NewPayloadRequest{
+		ExecutionPayload:      payload,
+		VersionedHashes:       versionedHashes,
+		ParentBeaconBlockRoot: latestHeader.ParentRoot,
+	}); err != nil {
+		return fmt.Errorf("unexpected problem in execution engine when inserting block %s (height %d), err: %v",
+			payload.BlockHash, payload.BlockNumber, err)
+	} else if !valid {
+		return fmt.Errorf("execution engine says payload is invalid: %s (height %d)",
+			payload.BlockHash, payload.BlockNumber)
+	}
+	return state.SetLatestExecutionPayloadHeader(payload.Header(spec))
+}
+
+// processElectraOperations is process_operations of Electra.
+func processElectraOperations(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, body *electra.BeaconBlockBody) error {
+	// Disable former deposit mechanism once all prior deposits are processed
+	eth1Data, err := state.Eth1Data()
+	if err != nil {
+		return err
+	}
+	depositRequestsStartIndex, err := state.DepositRequestsStartIndex()
+	if err != nil {
+		return err
+	}
+	eth1DepositIndexLimit := uint64(eth1Data.DepositCount)
+	if uint64(depositRequestsStartIndex) < eth1DepositIndexLimit {
+		eth1DepositIndexLimit = uint64(depositRequestsStartIndex)
+	}
+	depIndex, err := state.Eth1DepositIndex()
+	if err != nil {
+		return err
+	}
+	expectedDeposits := uint64(0)
+	if uint64(depIndex) < eth1DepositIndexLimit {
+		expectedDeposits = eth1DepositIndexLimit - uint64(depIndex)
+		if max := uint64(spec.MAX_DEPOSITS); expectedDeposits > max {
+			expectedDeposits = max
+		}
+	}
+	if uint64(len(body.Deposits)) != expectedDeposits {
+		return fmt.Errorf("expected %d deposits, but got %d", expectedDeposits, len(body.Deposits))
+	}
+
+	for i := range body.ProposerSlashings {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := processElectraProposerSlashing(spec, epc, state, &body.ProposerSlashings[i]); err != nil {
+			return err
+		}
+	}
+	for i := range body.AttesterSlashings {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := processElectraAttesterSlashing(spec, epc, state, &body.AttesterSlashings[i]); err != nil {
+			return err
+		}
+	}
+	for i := range body.Attestations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := processElectraAttestation(spec, epc, state, &body.Attestations[i]); err != nil {
+			return err
+		}
+	}
+	for i := range body.Deposits {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := processElectraDeposit(spec, epc, state, &body.Deposits[i]); err != nil {
+			return err
+		}
+	}
+	for i := range body.VoluntaryExits {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := processElectraVoluntaryExit(spec, epc, state, &body.VoluntaryExits[i]); err != nil {
+			return err
+		}
+	}
+	if err := capella.ProcessBLSToExecutionChanges(ctx, spec, epc, state, body.BLSToExecutionChanges); err != nil {
+		return err
+	}
+	requests := &body.ExecutionRequests
+	for i := range requests.Deposits {
+		if err := processDepositRequest(spec, state, &requests.Deposits[i]); err != nil {
+			return err
+		}
+	}
+	for i := range requests.Withdrawals {
+		if err := processWithdrawalRequest(spec, epc, state, &requests.Withdrawals[i]); err != nil {
+			return err
+		}
+	}
+	for i := range requests.Consolidations {
+		if err := processConsolidationRequest(spec, epc, state, &requests.Consolidations[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processElectraProposerSlashing is process_proposer_slashing, with the Electra slashing.
+func processElectraProposerSlashing(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, ps *phase0.ProposerSlashing) error {
+	if err := phase0.ValidateProposerSlashing(spec, epc, state, ps); err != nil {
+		return err
+	}
+	return slashElectraValidator(spec, epc, state, ps.SignedHeader1.Message.ProposerIndex, nil)
+}
+
+// validateElectraIndexedAttestation is is_valid_indexed_attestation,
+// with the attesting indices of multiple committees.
+func validateElectraIndexedAttestation(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, indexedAttestation *electra.IndexedAttestation) error {
+	indices := indexedAttestation.AttestingIndices
+	if len(indices) == 0 {
+		return errors.New("no empty attestation signatures are allowed")
+	}
+	// The indices must be sorted and unique
+	for i := 1; i < len(indices); i++ {
+		if indices[i-1] >= indices[i] {
+			return fmt.Errorf("attestation indices at %d and %d are not sorted or duplicate", i-1, i)
+		}
+	}
+	// if the last index is valid, the others are as well, since they are lower.
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	if valid, err := vals.IsValidIndex(indices[len(indices)-1]); err != nil {
+		return err
+	} else if !valid {
+		return errors.New("attestation indices contain out of range index")
+	}
+	dom, err := common.GetDomain(state, common.DOMAIN_BEACON_ATTESTER, indexedAttestation.Data.Target.Epoch)
+	if err != nil {
+		return err
+	}
+	return phase0.ValidateIndexedAttestationSignature(spec, dom, epc.ValidatorPubkeyCache, &phase0.IndexedAttestation{
+		AttestingIndices: common.CommitteeIndices(indices),
+		Data:             indexedAttestation.Data,
+		Signature:        indexedAttestation.Signature,
+	})
+}
+
+// processElectraAttesterSlashing is process_attester_slashing, with the Electra indexed attestations and slashing.
+func processElectraAttesterSlashing(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, attesterSlashing *electra.AttesterSlashing) error {
+	sa1 := &attesterSlashing.Attestation1
+	sa2 := &attesterSlashing.Attestation2
+	if !phase0.IsSlashableAttestationData(&sa1.Data, &sa2.Data) {
+		return errors.New("attester slashing has no valid reasoning")
+	}
+	if err := validateElectraIndexedAttestation(spec, epc, state, sa1); err != nil {
+		return fmt.Errorf("attestation 1 of attester slashing cannot be verified: %v", err)
+	}
+	if err := validateElectraIndexedAttestation(spec, epc, state, sa2); err != nil {
+		return fmt.Errorf("attestation 2 of attester slashing cannot be verified: %v", err)
+	}
+	currentEpoch := epc.CurrentEpoch.Epoch
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	slashedAny := false
+	var errorAny error
+	// the indices are sorted (as validated above), intersect them with a zig-zag join
+	common.ValidatorSet(sa1.AttestingIndices).ZigZagJoin(common.ValidatorSet(sa2.AttestingIndices), func(i common.ValidatorIndex) {
+		if errorAny != nil {
+			return
+		}
+		v, err := vals.Validator(i)
+		if err != nil {
+			errorAny = err
+			return
+		}
+		if slashable, err := phase0.IsSlashable(v, currentEpoch); err != nil {
+			errorAny = err
+		} else if slashable {
+			if err := slashElectraValidator(spec, epc, state, i, nil); err != nil {
+				errorAny = err
+			} else {
+				slashedAny = true
+			}
+		}
+	}, nil)
+	if errorAny != nil {
+		return fmt.Errorf("error during attester-slashing validators slashable check: %v", errorAny)
+	}
+	if !slashedAny {
+		return errors.New("attester slashing is not effective, hence invalid")
+	}
+	return nil
+}
+
+// processElectraAttestation is process_attestation of Electra:
+// the attestation aggregates the committees of the slot that are set in the committee bits.
+func processElectraAttestation(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, attestation *electra.Attestation) error {
+	data := &attestation.Data
+	currentSlot, err := state.Slot()
+	if err != nil {
+		return err
+	}
+	currentEpoch := spec.SlotToEpoch(currentSlot)
+	previousEpoch := currentEpoch.Previous()
+
+	if data.Target.Epoch < previousEpoch {
+		return errors.New("attestation data is invalid, target is too far in past")
+	} else if data.Target.Epoch > currentEpoch {
+		return errors.New("attestation data is invalid, target is in future")
+	}
+	if data.Target.Epoch != spec.SlotToEpoch(data.Slot) {
+		return errors.New("attestation data is invalid, slot epoch does not match target epoch")
+	}
+	if !(data.Slot+spec.MIN_ATTESTATION_INCLUSION_DELAY <= currentSlot) {
+		return errors.New("attestation is too new")
+	}
+	if data.Index != 0 {
+		return errors.New("attestation data is invalid, committee index must be 0")
+	}
+
+	commCount, err := epc.GetCommitteeCountPerSlot(data.Target.Epoch)
+	if err != nil {
+		return err
+	}
+	var attesters common.ValidatorSet
+	committeeOffset := uint64(0)
+	for ci := uint64(0); ci < uint64(spec.MAX_COMMITTEES_PER_SLOT); ci++ {
+		if !attestation.CommitteeBits.GetBit(ci) {
+			continue
+		}
+		if ci >= commCount {
+			return fmt.Errorf("attestation committee index %d out of range", ci)
+		}
+		committee, err := epc.GetBeaconCommittee(data.Slot, common.CommitteeIndex(ci))
+		if err != nil {
+			return err
+		}
+		participants := 0
+		for i, vi := range committee {
+			bit := committeeOffset + uint64(i)
+			if bit >= attestation.AggregationBits.BitLen() {
+				return fmt.Errorf("attestation aggregation bits too short for committee %d", ci)
+			}
+			if attestation.AggregationBits.GetBit(bit) {
+				attesters = append(attesters, vi)
+				participants += 1
+			}
+		}
+		if participants == 0 {
+			return fmt.Errorf("attestation has no participants in committee %d", ci)
+		}
+		committeeOffset += uint64(len(committee))
+	}
+	if attestation.AggregationBits.BitLen() != committeeOffset {
+		return fmt.Errorf("attestation aggregation bits length %d does not match committees size %d",
+			attestation.AggregationBits.BitLen(), committeeOffset)
+	}
+
+	// Note: this checks the source checkpoint.
+	applyFlags, err := deneb.GetApplicableAttestationParticipationFlags(spec, state, data, currentSlot-data.Slot)
+	if err != nil {
+		return err
+	}
+	indexedAtt := &electra.IndexedAttestation{
+		AttestingIndices: common.SlotCommitteeIndices(sortedUniqueIndices(attesters)),
+		Data:             *data,
+		Signature:        attestation.Signature,
+	}
+	if err := validateElectraIndexedAttestation(spec, epc, state, indexedAtt); err != nil {
+		return fmt.Errorf("attestation could not be verified in its indexed form: %v", err)
+	}
+
+	var epochParticipation *altair.ParticipationRegistryView
+	if data.Target.Epoch == currentEpoch {
+		epochParticipation, err = state.CurrentEpochParticipation()
+	} else {
+		epochParticipation, err = state.PreviousEpochParticipation()
+	}
+	if err != nil {
+		return err
+	}
+	proposerRewardNumerator := common.Gwei(0)
+	baseRewardPerIncrement := spec.EFFECTIVE_BALANCE_INCREMENT * common.Gwei(spec.BASE_REWARD_FACTOR) / epc.TotalActiveStakeSqRoot
+	for _, vi := range indexedAtt.AttestingIndices {
+		if applyFlags == 0 {
+			continue
+		}
+		increments := epc.EffectiveBalances[vi] / spec.EFFECTIVE_BALANCE_INCREMENT
+		baseReward := increments * baseRewardPerIncrement
+		existingFlags, err := epochParticipation.GetFlags(vi)
+		if err != nil {
+			return err
+		}
+		if (applyFlags&altair.TIMELY_SOURCE_FLAG != 0) && (existingFlags&altair.TIMELY_SOURCE_FLAG == 0) {
+			proposerRewardNumerator += baseReward * altair.TIMELY_SOURCE_WEIGHT
+		}
+		if (applyFlags&altair.TIMELY_TARGET_FLAG != 0) && (existingFlags&altair.TIMELY_TARGET_FLAG == 0) {
+			proposerRewardNumerator += baseReward * altair.TIMELY_TARGET_WEIGHT
+		}
+		if (applyFlags&altair.TIMELY_HEAD_FLAG != 0) && (existingFlags&altair.TIMELY_HEAD_FLAG == 0) {
+			proposerRewardNumerator += baseReward * altair.TIMELY_HEAD_WEIGHT
+		}
+		if err := epochParticipation.SetFlags(vi, existingFlags|applyFlags); err != nil {
+			return err
+		}
+	}
+	proposerRewardDenominator := ((altair.WEIGHT_DENOMINATOR - altair.PROPOSER_WEIGHT) * altair.WEIGHT_DENOMINATOR) / altair.PROPOSER_WEIGHT
+	proposerReward := proposerRewardNumerator / proposerRewardDenominator
+	proposerIndex, err := epc.GetBeaconProposer(currentSlot)
+	if err != nil {
+		return err
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	return common.IncreaseBalance(bals, proposerIndex, proposerReward)
+}
+
+// sortedUniqueIndices sorts the indices, and removes duplicates.
+func sortedUniqueIndices(indices common.ValidatorSet) []common.ValidatorIndex {
+	sort.Sort(indices)
+	out := make([]common.ValidatorIndex, 0, len(indices))
+	for i, vi := range indices {
+		if i == 0 || indices[i-1] != vi {
+			out = append(out, vi)
+		}
+	}
+	return out
+}
+
+// processElectraDeposit is process_deposit of Electra: the deposited balance is queued as a pending deposit.
+func processElectraDeposit(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, dep *common.Deposit) error {
+	depositIndex, err := state.Eth1DepositIndex()
+	if err != nil {
+		return err
+	}
+	eth1Data, err := state.Eth1Data()
+	if err != nil {
+		return err
+	}
+	if !merkle.VerifyMerkleBranch(
+		dep.Data.HashTreeRoot(tree.GetHashFn()),
+		dep.Proof[:],
+		common.DEPOSIT_CONTRACT_TREE_DEPTH+1, // Add 1 for the `List` length mix-in
+		uint64(depositIndex),
+		eth1Data.DepositRoot) {
+		return fmt.Errorf("deposit %d merkle proof failed to be verified", depositIndex)
+	}
+	if err := state.IncrementDepositIndex(); err != nil {
+		return err
+	}
+	_, exists, err := electraValidatorIndex(epc, state, dep.Data.Pubkey)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// invalid signatures are OK, the depositor will not receive anything because of their mistake
+		if !isValidDepositSignature(spec, dep.Data.Pubkey, dep.Data.WithdrawalCredentials, dep.Data.Amount, dep.Data.Signature) {
+			return nil
+		}
+		if err := addElectraValidator(spec, epc, state, dep.Data.Pubkey, dep.Data.WithdrawalCredentials, 0); err != nil {
+			return err
+		}
+	}
+	deposits, err := spec_types.PendingDeposits(spec, state)
+	if err != nil {
+		return err
+	}
+	return spec_types.SetPendingDeposits(spec, state, append(deposits, common.PendingDeposit{
+		Pubkey:                dep.Data.Pubkey,
+		WithdrawalCredentials: dep.Data.WithdrawalCredentials,
+		Amount:                dep.Data.Amount,
+		Signature:             dep.Data.Signature,
+		Slot:                  common.GENESIS_SLOT,
+	}))
+}
+
+// processElectraVoluntaryExit is process_voluntary_exit of Electra:
+// validators with pending partial withdrawals cannot exit.
+func processElectraVoluntaryExit(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, signedExit *phase0.SignedVoluntaryExit) error {
+	if err := deneb.ValidateVoluntaryExit(spec, epc, state, signedExit); err != nil {
+		return err
+	}
+	index := signedExit.Message.ValidatorIndex
+	if pending, err := pendingBalanceToWithdraw(spec, state, index); err != nil {
+		return err
+	} else if pending != 0 {
+		return errors.New("validator has pending partial withdrawals")
+	}
+	return initiateElectraValidatorExit(spec, epc, state, index)
+}
+
+// processDepositRequest queues the deposit of the execution layer, like process_deposit_request.
+func processDepositRequest(spec *common.Spec, state *electra.BeaconStateView, req *common.DepositRequest) error {
+	startIndex, err := state.DepositRequestsStartIndex()
+	if err != nil {
+		return err
+	}
+	if uint64(startIndex) == spec_types.UNSET_DEPOSIT_REQUESTS_START_INDEX {
+		if err := state.SetDepositRequestsStartIndex(req.Index); err != nil {
+			return err
+		}
+	}
+	slot, err := state.Slot()
+	if err != nil {
+		return err
+	}
+	deposits, err := spec_types.PendingDeposits(spec, state)
+	if err != nil {
+		return err
+	}
+	return spec_types.SetPendingDeposits(spec, state, append(deposits, common.PendingDeposit{
+		Pubkey:                req.Pubkey,
+		WithdrawalCredentials: req.WithdrawalCredentials,
+		Amount:                req.Amount,
+		Signature:             req.Signature,
+		Slot:                  slot,
+	}))
+}
+
+// executionSourceValidator checks if the validator has execution withdrawal credentials with the source address,
+// and is active and not exiting, as required for withdrawal and consolidation requests.
+func executionSourceValidator(epc *common.EpochsContext, v common.Validator, sourceAddress common.Eth1Address) (bool, error) {
+	creds, err := v.WithdrawalCredentials()
+	if err != nil {
+		return false, err
+	}
+	if !spec_types.HasExecutionWithdrawalCredential(creds) || common.Eth1Address(creds[12:]) != sourceAddress {
+		return false, nil
+	}
+	var flat common.FlatValidator
+	if err := v.Flatten(&flat); err != nil {
+		return false, err
+	}
+	return flat.IsActive(epc.CurrentEpoch.Epoch) && flat.ExitEpoch == common.FAR_FUTURE_EPOCH, nil
+}
+
+// processWithdrawalRequest exits the validator, or queues a partial withdrawal, like process_withdrawal_request.
+func processWithdrawalRequest(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, req *common.WithdrawalRequest) error {
+	isFullExitRequest := req.Amount == 0
+	pendingPartials, err := spec_types.PendingPartialWithdrawals(spec, state)
+	if err != nil {
+		return err
+	}
+	// If the partial withdrawal queue is full, only full exits are processed
+	if uint64(len(pendingPartials)) == uint64(spec.PENDING_PARTIAL_WITHDRAWALS_LIMIT) && !isFullExitRequest {
+		return nil
+	}
+	index, exists, err := electraValidatorIndex(epc, state, req.ValidatorPubkey)
+	if err != nil || !exists {
+		return err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	v, err := vals.Validator(index)
+	if err != nil {
+		return err
+	}
+	if ok, err := executionSourceValidator(epc, v, req.SourceAddress); err != nil || !ok {
+		return err
+	}
+	// Verify the validator has been active long enough
+	activationEpoch, err := v.ActivationEpoch()
+	if err != nil {
+		return err
+	}
+	if epc.CurrentEpoch.Epoch < activationEpoch+spec.SHARD_COMMITTEE_PERIOD {
+		return nil
+	}
+	pendingBalance, err := pendingBalanceToWithdraw(spec, state, index)
+	if err != nil {
+		return err
+	}
+	if isFullExitRequest {
+		// Only exit validator if it has no pending withdrawals in the queue
+		if pendingBalance == 0 {
+			return initiateElectraValidatorExit(spec, epc, state, index)
+		}
+		return nil
+	}
+	creds, err := v.WithdrawalCredentials()
+	if err != nil {
+		return err
+	}
+	effectiveBalance, err := v.EffectiveBalance()
+	if err != nil {
+		return err
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	balance, err := bals.GetBalance(index)
+	if err != nil {
+		return err
+	}
+	if !spec_types.HasCompoundingWithdrawalCredential(creds) || effectiveBalance < spec.MIN_ACTIVATION_BALANCE ||
+		balance <= spec.MIN_ACTIVATION_BALANCE+pendingBalance {
+		return nil
+	}
+	toWithdraw := balance - spec.MIN_ACTIVATION_BALANCE - pendingBalance
+	if req.Amount < toWithdraw {
+		toWithdraw = req.Amount
+	}
+	exitQueueEpoch, err := computeExitEpochAndUpdateChurn(spec, epc, state, toWithdraw)
+	if err != nil {
+		return err
+	}
+	return spec_types.SetPendingPartialWithdrawals(spec, state, append(pendingPartials, common.PendingPartialWithdrawal{
+		ValidatorIndex:    index,
+		Amount:            toWithdraw,
+		WithdrawableEpoch: exitQueueEpoch + spec.MIN_VALIDATOR_WITHDRAWABILITY_DELAY,
+	}))
+}
+
+// processConsolidationRequest switches the validator to compounding credentials,
+// or exits the source validator to consolidate it into the target, like process_consolidation_request.
+func processConsolidationRequest(spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView, req *common.ConsolidationRequest) error {
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	sourceIndex, sourceExists, err := electraValidatorIndex(epc, state, req.SourcePubkey)
+	if err != nil {
+		return err
+	}
+	if req.SourcePubkey == req.TargetPubkey {
+		// a consolidation cannot be used as an exit, but it can switch the validator to compounding
+		if !sourceExists {
+			return nil
+		}
+		v, err := vals.Validator(sourceIndex)
+		if err != nil {
+			return err
+		}
+		if ok, err := executionSourceValidator(epc, v, req.SourceAddress); err != nil || !ok {
+			return err
+		}
+		creds, err := v.WithdrawalCredentials()
+		if err != nil {
+			return err
+		}
+		if creds[0] != common.ETH1_ADDRESS_WITHDRAWAL_PREFIX {
+			return nil
+		}
+		creds[0] = spec_types.COMPOUNDING_WITHDRAWAL_PREFIX
+		if err := v.SetWithdrawalCredentials(creds); err != nil {
+			return err
+		}
+		return spec_types.QueueExcessActiveBalance(spec, state, sourceIndex)
+	}
+	consolidations, err := spec_types.PendingConsolidations(spec, state)
+	if err != nil {
+		return err
+	}
+	// If the pending consolidations queue is full, consolidation requests are ignored
+	if uint64(len(consolidations)) == uint64(spec.PENDING_CONSOLIDATIONS_LIMIT) {
+		return nil
+	}
+	// If there is too little available consolidation churn limit, consolidation requests are ignored
+	if spec_types.ConsolidationChurnLimit(spec, epc.TotalActiveStake) <= spec.MIN_ACTIVATION_BALANCE {
+		return nil
+	}
+	targetIndex, targetExists, err := electraValidatorIndex(epc, state, req.TargetPubkey)
+	if err != nil {
+		return err
+	}
+	if !sourceExists || !targetExists {
+		return nil
+	}
+	source, err := vals.Validator(sourceIndex)
+	if err != nil {
+		return err
+	}
+	target, err := vals.Validator(targetIndex)
+	if err != nil {
+		return err
+	}
+	if ok, err := executionSourceValidator(epc, source, req.SourceAddress); err != nil || !ok {
+		return err
+	}
+	targetCreds, err := target.WithdrawalCredentials()
+	if err != nil {
+		return err
+	}
+	if !spec_types.HasCompoundingWithdrawalCredential(targetCreds) {
+		return nil
+	}
+	var targetFlat common.FlatValidator
+	if err := target.Flatten(&targetFlat); err != nil {
+		return err
+	}
+	if !targetFlat.IsActive(epc.CurrentEpoch.Epoch) || targetFlat.ExitEpoch != common.FAR_FUTURE_EPOCH {
+		return nil
+	}
+	var sourceFlat common.FlatValidator
+	if err := source.Flatten(&sourceFlat); err != nil {
+		return err
+	}
+	// Verify the source has been active long enough
+	if epc.CurrentEpoch.Epoch < sourceFlat.ActivationEpoch+spec.SHARD_COMMITTEE_PERIOD {
+		return nil
+	}
+	// Verify the source has no pending withdrawals in the queue
+	if pending, err := pendingBalanceToWithdraw(spec, state, sourceIndex); err != nil || pending > 0 {
+		return err
+	}
+	exitEpoch, err := computeConsolidationEpochAndUpdateChurn(spec, epc, state, sourceFlat.EffectiveBalance)
+	if err != nil {
+		return err
+	}
+	if err := source.SetExitEpoch(exitEpoch); err != nil {
+		return err
+	}
+	if err := source.SetWithdrawableEpoch(exitEpoch + spec.MIN_VALIDATOR_WITHDRAWABILITY_DELAY); err != nil {
+		return err
+	}
+	return spec_types.SetPendingConsolidations(spec, state, append(consolidations, common.PendingConsolidation{
+		SourceIndex: sourceIndex,
+		TargetIndex: targetIndex,
+	}))
+}
@@ -0,0 +1,382 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/electra"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+
+	"github.com/protolambda/zcli/spec_types"
+)
+
+// processElectraEpoch is process_epoch of Electra.
+func processElectraEpoch(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView) error {
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	flats, err := common.FlattenValidators(vals)
+	if err != nil {
+		return err
+	}
+	attesterData, err := altair.ComputeEpochAttesterData(ctx, spec, epc, flats, state)
+	if err != nil {
+		return err
+	}
+	just := phase0.JustificationStakeData{
+		CurrentEpoch:                  epc.CurrentEpoch.Epoch,
+		TotalActiveStake:              epc.TotalActiveStake,
+		PrevEpochUnslashedTargetStake: attesterData.PrevEpochUnslashedStake.TargetStake,
+		CurrEpochUnslashedTargetStake: attesterData.CurrEpochUnslashedTargetStake,
+	}
+	if err := phase0.ProcessEpochJustification(ctx, spec, &just, state); err != nil {
+		return err
+	}
+	if err := altair.ProcessInactivityUpdates(ctx, spec, attesterData, state); err != nil {
+		return err
+	}
+	if err := altair.ProcessEpochRewardsAndPenalties(ctx, spec, epc, attesterData, state); err != nil {
+		return err
+	}
+	if err := processElectraRegistryUpdates(ctx, spec, epc, state); err != nil {
+		return err
+	}
+	if err := processElectraSlashings(ctx, spec, epc, state); err != nil {
+		return err
+	}
+	if err := phase0.ProcessEth1DataReset(ctx, spec, epc, state); err != nil {
+		return err
+	}
+	if err := processPendingDeposits(ctx, spec, epc, state); err != nil {
+		return err
+	}
+	if err := processPendingConsolidations(ctx, spec, epc, state); err != nil {
+		return err
+	}
+	if err := processElectraEffectiveBalanceUpdates(ctx, spec, state); err != nil {
+		return err
+	}
+	if err := phase0.ProcessSlashingsReset(ctx, spec, epc, state); err != nil {
+		return err
+	}
+	if err := phase0.ProcessRandaoMixesReset(ctx, spec, epc, state); err != nil {
+		return err
+	}
+	if err := capella.ProcessHistoricalSummariesUpdate(ctx, spec, epc, state); err != nil {
+		return err
+	}
+	if err := altair.ProcessParticipationFlagUpdates(ctx, spec, state); err != nil {
+		return err
+	}
+	return processElectraSyncCommitteeUpdates(ctx, spec, epc, state)
+}
+
+// processElectraRegistryUpdates is process_registry_updates of Electra:
+// activation eligibility requires MIN_ACTIVATION_BALANCE, and activations are not churned anymore.
+func processElectraRegistryUpdates(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	flats, err := common.FlattenValidators(vals)
+	if err != nil {
+		return err
+	}
+	finalized, err := state.FinalizedCheckpoint()
+	if err != nil {
+		return err
+	}
+	currentEpoch := epc.CurrentEpoch.Epoch
+	activationEpoch := spec.ComputeActivationExitEpoch(currentEpoch)
+	for i := range flats {
+		flat := &flats[i]
+		index := common.ValidatorIndex(i)
+		if flat.ActivationEligibilityEpoch == common.FAR_FUTURE_EPOCH && flat.EffectiveBalance >= spec.MIN_ACTIVATION_BALANCE {
+			v, err := vals.Validator(index)
+			if err != nil {
+				return err
+			}
+			if err := v.SetActivationEligibilityEpoch(currentEpoch + 1); err != nil {
+				return err
+			}
+		} else if flat.IsActive(currentEpoch) && flat.EffectiveBalance <= spec.EJECTION_BALANCE {
+			if err := initiateElectraValidatorExit(spec, epc, state, index); err != nil {
+				return err
+			}
+		} else if flat.ActivationEligibilityEpoch <= finalized.Epoch && flat.ActivationEpoch == common.FAR_FUTURE_EPOCH {
+			v, err := vals.Validator(index)
+			if err != nil {
+				return err
+			}
+			if err := v.SetActivationEpoch(activationEpoch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// processElectraSlashings is process_slashings of Electra, with the penalty computed per effective balance increment.
+func processElectraSlashings(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	flats, err := common.FlattenValidators(vals)
+	if err != nil {
+		return err
+	}
+	slashings, err := state.Slashings()
+	if err != nil {
+		return err
+	}
+	slashingsSum, err := slashings.Total()
+	if err != nil {
+		return err
+	}
+	totalBalance := epc.TotalActiveStake
+	adjustedTotalSlashingBalance := slashingsSum * common.Gwei(spec.PROPORTIONAL_SLASHING_MULTIPLIER_BELLATRIX)
+	if adjustedTotalSlashingBalance > totalBalance {
+		adjustedTotalSlashingBalance = totalBalance
+	}
+	increment := spec.EFFECTIVE_BALANCE_INCREMENT
+	penaltyPerEffectiveBalanceIncrement := adjustedTotalSlashingBalance / (totalBalance / increment)
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	slashingsEpoch := epc.CurrentEpoch.Epoch + spec.EPOCHS_PER_SLASHINGS_VECTOR/2
+	for i := range flats {
+		flat := &flats[i]
+		if flat.Slashed && slashingsEpoch == flat.WithdrawableEpoch {
+			penalty := penaltyPerEffectiveBalanceIncrement * (flat.EffectiveBalance / increment)
+			if err := common.DecreaseBalance(bals, common.ValidatorIndex(i), penalty); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// processPendingDeposits applies the pending deposits within the activation churn, like process_pending_deposits.
+func processPendingDeposits(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	nextEpoch := epc.CurrentEpoch.Epoch + 1
+	depositBalanceToConsume, err := state.DepositBalanceToConsume()
+	if err != nil {
+		return err
+	}
+	availableForProcessing := depositBalanceToConsume + spec_types.ActivationExitChurnLimit(spec, epc.TotalActiveStake)
+	processedAmount := common.Gwei(0)
+	nextDepositIndex := 0
+	var depositsToPostpone common.PendingDeposits
+	isChurnLimitReached := false
+	finalized, err := state.FinalizedCheckpoint()
+	if err != nil {
+		return err
+	}
+	finalizedSlot, err := spec.EpochStartSlot(finalized.Epoch)
+	if err != nil {
+		return err
+	}
+	eth1DepositIndex, err := state.Eth1DepositIndex()
+	if err != nil {
+		return err
+	}
+	depositRequestsStartIndex, err := state.DepositRequestsStartIndex()
+	if err != nil {
+		return err
+	}
+	deposits, err := spec_types.PendingDeposits(spec, state)
+	if err != nil {
+		return err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	for i := range deposits {
+		deposit := &deposits[i]
+		// Do not process deposit requests if the Eth1 bridge deposits are not yet applied.
+		if deposit.Slot > common.GENESIS_SLOT && uint64(eth1DepositIndex) < uint64(depositRequestsStartIndex) {
+			break
+		}
+		// Check if the deposit has been finalized, otherwise stop processing.
+		if deposit.Slot > finalizedSlot {
+			break
+		}
+		// Check if the number of processed deposits has not reached the limit, otherwise stop processing.
+		if uint64(nextDepositIndex) >= uint64(spec.MAX_PENDING_DEPOSITS_PER_EPOCH) {
+			break
+		}
+		isValidatorExited := false
+		isValidatorWithdrawn := false
+		index, exists, err := electraValidatorIndex(epc, state, deposit.Pubkey)
+		if err != nil {
+			return err
+		}
+		if exists {
+			v, err := vals.Validator(index)
+			if err != nil {
+				return err
+			}
+			exitEpoch, err := v.ExitEpoch()
+			if err != nil {
+				return err
+			}
+			withdrawableEpoch, err := v.WithdrawableEpoch()
+			if err != nil {
+				return err
+			}
+			isValidatorExited = exitEpoch < common.FAR_FUTURE_EPOCH
+			isValidatorWithdrawn = withdrawableEpoch < nextEpoch
+		}
+		if isValidatorWithdrawn {
+			// Deposited balance will never become active, it is withdrawn without the churn.
+			if err := applyPendingDeposit(spec, epc, state, deposit); err != nil {
+				return err
+			}
+		} else if isValidatorExited {
+			// Validator is exiting, postpone the deposit until after the withdrawable epoch.
+			depositsToPostpone = append(depositsToPostpone, *deposit)
+		} else {
+			isChurnLimitReached = processedAmount+deposit.Amount > availableForProcessing
+			if isChurnLimitReached {
+				break
+			}
+			processedAmount += deposit.Amount
+			if err := applyPendingDeposit(spec, epc, state, deposit); err != nil {
+				return err
+			}
+		}
+		nextDepositIndex += 1
+	}
+	remaining := append(append(common.PendingDeposits{}, deposits[nextDepositIndex:]...), depositsToPostpone...)
+	if err := spec_types.SetPendingDeposits(spec, state, remaining); err != nil {
+		return err
+	}
+	if isChurnLimitReached {
+		return state.SetDepositBalanceToConsume(availableForProcessing - processedAmount)
+	}
+	return state.SetDepositBalanceToConsume(0)
+}
+
+// processPendingConsolidations moves the balances of the withdrawable consolidation sources to their targets,
+// like process_pending_consolidations.
+func processPendingConsolidations(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, state *electra.BeaconStateView) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	nextEpoch := epc.CurrentEpoch.Epoch + 1
+	consolidations, err := spec_types.PendingConsolidations(spec, state)
+	if err != nil {
+		return err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	nextPendingConsolidation := 0
+	for _, consolidation := range consolidations {
+		v, err := vals.Validator(consolidation.SourceIndex)
+		if err != nil {
+			return err
+		}
+		var source common.FlatValidator
+		if err := v.Flatten(&source); err != nil {
+			return err
+		}
+		if source.Slashed {
+			nextPendingConsolidation += 1
+			continue
+		}
+		if source.WithdrawableEpoch > nextEpoch {
+			break
+		}
+		// Calculate the consolidated balance
+		balance, err := bals.GetBalance(consolidation.SourceIndex)
+		if err != nil {
+			return err
+		}
+		sourceEffectiveBalance := source.EffectiveBalance
+		if balance < sourceEffectiveBalance {
+			sourceEffectiveBalance = balance
+		}
+		// Move active balance to target. Excess balance is withdrawable.
+		if err := common.DecreaseBalance(bals, consolidation.SourceIndex, sourceEffectiveBalance); err != nil {
+			return err
+		}
+		if err := common.IncreaseBalance(bals, consolidation.TargetIndex, sourceEffectiveBalance); err != nil {
+			return err
+		}
+		nextPendingConsolidation += 1
+	}
+	return spec_types.SetPendingConsolidations(spec, state, consolidations[nextPendingConsolidation:])
+}
+
+// processElectraEffectiveBalanceUpdates is process_effective_balance_updates of Electra,
+// with the maximum effective balance depending on the withdrawal credentials.
+func processElectraEffectiveBalanceUpdates(ctx context.Context, spec *common.Spec, state *electra.BeaconStateView) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	HYSTERESIS_INCREMENT := spec.EFFECTIVE_BALANCE_INCREMENT / common.Gwei(spec.HYSTERESIS_QUOTIENT)
+	DOWNWARD_THRESHOLD := HYSTERESIS_INCREMENT * common.Gwei(spec.HYSTERESIS_DOWNWARD_MULTIPLIER)
+	UPWARD_THRESHOLD := HYSTERESIS_INCREMENT * common.Gwei(spec.HYSTERESIS_UPWARD_MULTIPLIER)
+
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	balIterNext := bals.Iter()
+	for i := common.ValidatorIndex(0); true; i++ {
+		balance, ok, err := balIterNext()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		val, err := vals.Validator(i)
+		if err != nil {
+			return err
+		}
+		effBalance, err := val.EffectiveBalance()
+		if err != nil {
+			return err
+		}
+		if balance+DOWNWARD_THRESHOLD < effBalance || effBalance+UPWARD_THRESHOLD < balance {
+			creds, err := val.WithdrawalCredentials()
+			if err != nil {
+				return err
+			}
+			effBalance = balance - (balance % spec.EFFECTIVE_BALANCE_INCREMENT)
+			if max := spec_types.MaxEffectiveBalance(spec, creds); max < effBalance {
+				effBalance = max
+			}
+			if err := val.SetEffectiveBalance(effBalance); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
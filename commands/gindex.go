@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"github.com/protolambda/zcli/spec_types"
+	"github.com/protolambda/zcli/util"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+type GindexCmd struct{}
+
+func (c *GindexCmd) Help() string {
+	return "Compute generalized indices of paths into any spec object"
+}
+
+func (c *GindexCmd) Cmd(route string) (cmd interface{}, err error) {
+	phaseTypes, ok := spec_types.TypesByPhase[route]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized phase: %s", route)
+	}
+	return &GindexPhaseCmd{PhaseName: route, Types: phaseTypes}, nil
+}
+
+func (c *GindexCmd) Routes() []string {
+	return spec_types.Phases
+}
+
+type GindexPhaseCmd struct {
+	PhaseName string
+	Types     map[string]spec_types.SpecType
+}
+
+func (c *GindexPhaseCmd) Help() string {
+	return fmt.Sprintf("Compute generalized indices of paths into any spec object in %s", c.PhaseName)
+}
+
+func (c *GindexPhaseCmd) Cmd(route string) (cmd interface{}, err error) {
+	specType, ok := c.Types[route]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized spec object type: %s", route)
+	}
+	return &GindexObjCmd{PhaseName: c.PhaseName, TypeName: route, Type: specType}, nil
+}
+
+func (c *GindexPhaseCmd) Routes() []string {
+	return spec_types.TypeNames(c.Types)
+}
+
+type GindexObjCmd struct {
+	PhaseName           string
+	TypeName            string
+	Type                spec_types.SpecType
+	configs.SpecOptions `ask:"."`
+}
+
+func (c *GindexObjCmd) Help() string {
+	return fmt.Sprintf("Compute generalized indices of paths into type %s (%s), e.g. 'validators/1234/pubkey' or 'validators/__len__'", c.TypeName, c.PhaseName)
+}
+
+func (c *GindexObjCmd) Run(ctx context.Context, args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no paths specified")
+	}
+	spec, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	typ := c.Type.TypeDef(spec)
+	for _, arg := range args {
+		path, err := util.ParsePath(arg)
+		if err != nil {
+			return err
+		}
+		target, err := util.ResolvePath(typ, path)
+		if err != nil {
+			return err
+		}
+		if target.Packed {
+			fmt.Printf("%-20d %s (packed, element %d within the node)\n", target.Gindex, util.FormatPath(path), target.SubIndex)
+		} else {
+			fmt.Printf("%-20d %s\n", target.Gindex, util.FormatPath(path))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,731 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/bits"
+
+	"github.com/protolambda/ask"
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zcli/spec_types"
+	"github.com/protolambda/zcli/util"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+)
+
+// Phases with a sync committee, and thus light-client support
+var lightClientPhases = []string{"altair", "bellatrix", "capella", "deneb"}
+
+type LightClientCmd struct{}
+
+func (c *LightClientCmd) Help() string {
+	return "Create and process light-client objects"
+}
+
+func (c *LightClientCmd) Cmd(route string) (cmd interface{}, err error) {
+	switch route {
+	case "bootstrap":
+		return &LightClientBootstrapCmd{}, nil
+	case "update":
+		return &LightClientUpdateCmd{}, nil
+	case "process":
+		return &LightClientProcessCmd{}, nil
+	}
+	return nil, ask.UnrecognizedErr
+}
+
+func (c *LightClientCmd) Routes() []string {
+	return []string{"bootstrap", "update", "process"}
+}
+
+type LightClientBootstrapCmd struct{}
+
+func (c *LightClientBootstrapCmd) Help() string {
+	return "Create a light-client bootstrap from a beacon state and the block of that state"
+}
+
+func (c *LightClientBootstrapCmd) Cmd(route string) (cmd interface{}, err error) {
+	switch route {
+	case "altair", "bellatrix":
+		return &LightClientBootstrapPhaseCmd[spec_types.LightClientHeader, *spec_types.LightClientHeader]{Phase: route}, nil
+	case "capella":
+		return &LightClientBootstrapPhaseCmd[spec_types.CapellaLightClientHeader, *spec_types.CapellaLightClientHeader]{Phase: route}, nil
+	case "deneb":
+		return &LightClientBootstrapPhaseCmd[spec_types.DenebLightClientHeader, *spec_types.DenebLightClientHeader]{Phase: route}, nil
+	}
+	return nil, ask.UnrecognizedErr
+}
+
+func (c *LightClientBootstrapCmd) Routes() []string {
+	return lightClientPhases
+}
+
+type LightClientBootstrapPhaseCmd[H any, PH spec_types.LightClientHeaderPtr[H]] struct {
+	Phase               string
+	configs.SpecOptions `ask:"."`
+	State               util.StateInput `ask:"--state" help:"BeaconState, post-state of the block"`
+	Block               util.ObjInput   `ask:"--block" help:"SignedBeaconBlock to bootstrap from"`
+	Out                 util.ObjOutput  `ask:"--out" help:"LightClientBootstrap output, prefix with format, empty path for STDOUT"`
+}
+
+func (c *LightClientBootstrapPhaseCmd[H, PH]) Default() {
+	c.Out = "pretty:"
+}
+
+func (c *LightClientBootstrapPhaseCmd[H, PH]) Help() string {
+	return fmt.Sprintf("Create a light-client bootstrap (%s)", c.Phase)
+}
+
+func (c *LightClientBootstrapPhaseCmd[H, PH]) Run(ctx context.Context, args ...string) error {
+	spec, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	state, err := c.State.Read(spec, c.Phase)
+	if err != nil {
+		return fmt.Errorf("failed to read state: %v", err)
+	}
+	header, _, err := readLightClientBlock(spec, c.Phase, &c.Block)
+	if err != nil {
+		return fmt.Errorf("failed to read block: %v", err)
+	}
+	if err := checkBlockState(header.BeaconHeader(), state); err != nil {
+		return err
+	}
+	var bootstrap spec_types.LightClientBootstrap[H, PH]
+	bootstrap.Header = *header.(PH)
+	if err := stateBranch(state, []string{"current_sync_committee"}, spec.Wrap(&bootstrap.CurrentSyncCommittee), bootstrap.CurrentSyncCommitteeBranch[:]); err != nil {
+		return err
+	}
+	return c.Out.Write(spec.Wrap(&bootstrap))
+}
+
+type LightClientUpdateCmd struct{}
+
+func (c *LightClientUpdateCmd) Help() string {
+	return "Create a light-client update from an attested beacon state and the block that signs it"
+}
+
+func (c *LightClientUpdateCmd) Cmd(route string) (cmd interface{}, err error) {
+	switch route {
+	case "altair", "bellatrix":
+		return &LightClientUpdatePhaseCmd[spec_types.LightClientHeader, *spec_types.LightClientHeader]{Phase: route}, nil
+	case "capella":
+		return &LightClientUpdatePhaseCmd[spec_types.CapellaLightClientHeader, *spec_types.CapellaLightClientHeader]{Phase: route}, nil
+	case "deneb":
+		return &LightClientUpdatePhaseCmd[spec_types.DenebLightClientHeader, *spec_types.DenebLightClientHeader]{Phase: route}, nil
+	}
+	return nil, ask.UnrecognizedErr
+}
+
+func (c *LightClientUpdateCmd) Routes() []string {
+	return lightClientPhases
+}
+
+type LightClientUpdatePhaseCmd[H any, PH spec_types.LightClientHeaderPtr[H]] struct {
+	Phase                 string
+	configs.SpecOptions   `ask:"."`
+	AttestedState         util.StateInput `ask:"--attested-state" help:"BeaconState, post-state of the attested block"`
+	AttestedBlock         util.ObjInput   `ask:"--attested-block" help:"SignedBeaconBlock that is attested to by the sync committee"`
+	Block                 util.ObjInput   `ask:"--block" help:"SignedBeaconBlock with the sync aggregate, child of the attested block"`
+	FinalizedBlock        util.ObjInput   `ask:"--finalized-block" help:"SignedBeaconBlock of the finalized checkpoint of the attested state, required if the checkpoint root is not zero"`
+	FinalizedBlockChanged bool            `changed:"finalized-block"`
+	Out                   util.ObjOutput  `ask:"--out" help:"LightClientUpdate output, prefix with format, empty path for STDOUT"`
+}
+
+func (c *LightClientUpdatePhaseCmd[H, PH]) Default() {
+	c.Out = "pretty:"
+}
+
+func (c *LightClientUpdatePhaseCmd[H, PH]) Help() string {
+	return fmt.Sprintf("Create a light-client update (%s)", c.Phase)
+}
+
+func (c *LightClientUpdatePhaseCmd[H, PH]) Run(ctx context.Context, args ...string) error {
+	spec, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	lcHeader, syncAggregate, err := readLightClientBlock(spec, c.Phase, &c.Block)
+	if err != nil {
+		return fmt.Errorf("failed to read block: %v", err)
+	}
+	header := lcHeader.BeaconHeader()
+	participants := syncParticipants(syncAggregate)
+	if participants < uint64(spec.MIN_SYNC_COMMITTEE_PARTICIPANTS) {
+		return fmt.Errorf("block has %d sync committee participants, need at least %d", participants, spec.MIN_SYNC_COMMITTEE_PARTICIPANTS)
+	}
+	attestedState, err := c.AttestedState.Read(spec, c.Phase)
+	if err != nil {
+		return fmt.Errorf("failed to read attested state: %v", err)
+	}
+	attestedLCHeader, _, err := readLightClientBlock(spec, c.Phase, &c.AttestedBlock)
+	if err != nil {
+		return fmt.Errorf("failed to read attested block: %v", err)
+	}
+	attestedHeader := attestedLCHeader.BeaconHeader()
+	if err := checkBlockState(attestedHeader, attestedState); err != nil {
+		return err
+	}
+	hFn := tree.GetHashFn()
+	if root := attestedHeader.HashTreeRoot(hFn); root != header.ParentRoot {
+		return fmt.Errorf("attested block root %s does not match parent root %s of block", root, header.ParentRoot)
+	}
+
+	var update spec_types.LightClientUpdate[H, PH]
+	update.AttestedHeader = *attestedLCHeader.(PH)
+	update.SyncAggregate = *syncAggregate
+	update.SignatureSlot = header.Slot
+	signaturePeriod := spec.SlotToEpoch(header.Slot) / spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD
+	attestedPeriod := spec.SlotToEpoch(attestedHeader.Slot) / spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD
+	if attestedPeriod == signaturePeriod {
+		if err := stateBranch(attestedState, []string{"next_sync_committee"}, spec.Wrap(&update.NextSyncCommittee), update.NextSyncCommitteeBranch[:]); err != nil {
+			return err
+		}
+	} else {
+		// the next sync committee cannot be used by the light client, leave it empty
+		update.NextSyncCommittee.Pubkeys = make(common.SyncCommitteePubkeys, spec.SYNC_COMMITTEE_SIZE)
+	}
+	// the finality branch is derived from the attested state, the finalized block provides the header it proves.
+	// A zero root, before anything is finalized, is proven with an empty finalized header.
+	var finalizedRoot common.Root
+	if err := stateBranch(attestedState, []string{"finalized_checkpoint", "root"}, &finalizedRoot, update.FinalityBranch[:]); err != nil {
+		return err
+	}
+	if finalizedRoot != (common.Root{}) && !c.FinalizedBlockChanged {
+		return fmt.Errorf("attested state has finalized checkpoint root %s, the finalized block is needed for the finality update", finalizedRoot)
+	}
+	if c.FinalizedBlockChanged {
+		finalizedLCHeader, _, err := readLightClientBlock(spec, c.Phase, &c.FinalizedBlock)
+		if err != nil {
+			return fmt.Errorf("failed to read finalized block: %v", err)
+		}
+		finalizedHeader := finalizedLCHeader.BeaconHeader()
+		if finalizedHeader.Slot != common.GENESIS_SLOT {
+			if root := finalizedHeader.HashTreeRoot(hFn); root != finalizedRoot {
+				return fmt.Errorf("finalized block root %s does not match finalized checkpoint root %s of attested state", root, finalizedRoot)
+			}
+			update.FinalizedHeader = *finalizedLCHeader.(PH)
+		} else if finalizedRoot != (common.Root{}) {
+			return fmt.Errorf("finalized block is at genesis, but finalized checkpoint root of attested state is %s", finalizedRoot)
+		}
+	}
+	return c.Out.Write(spec.Wrap(&update))
+}
+
+// readLightClientBlock reads a signed beacon block, and returns the light-client header and sync aggregate of it.
+// From capella onwards the header includes the execution payload header, with a branch into the block body.
+func readLightClientBlock(spec *common.Spec, phase string, input *util.ObjInput) (spec_types.LightClientHeaderObj, *altair.SyncAggregate, error) {
+	switch phase {
+	case "altair":
+		var b altair.SignedBeaconBlock
+		if err := input.Read(spec.Wrap(&b)); err != nil {
+			return nil, nil, err
+		}
+		return &spec_types.LightClientHeader{Beacon: *b.Message.Header(spec)}, &b.Message.Body.SyncAggregate, nil
+	case "bellatrix":
+		var b bellatrix.SignedBeaconBlock
+		if err := input.Read(spec.Wrap(&b)); err != nil {
+			return nil, nil, err
+		}
+		return &spec_types.LightClientHeader{Beacon: *b.Message.Header(spec)}, &b.Message.Body.SyncAggregate, nil
+	case "capella":
+		var b capella.SignedBeaconBlock
+		if err := input.Read(spec.Wrap(&b)); err != nil {
+			return nil, nil, err
+		}
+		header := &spec_types.CapellaLightClientHeader{
+			Beacon:    *b.Message.Header(spec),
+			Execution: *b.Message.Body.ExecutionPayload.Header(spec),
+		}
+		body, err := util.TreeView(spec.Wrap(&b.Message.Body), capella.BeaconBlockBodyType(spec))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := fieldBranch(body, []string{"execution_payload"}, nil, header.ExecutionBranch[:]); err != nil {
+			return nil, nil, err
+		}
+		return header, &b.Message.Body.SyncAggregate, nil
+	case "deneb":
+		var b deneb.SignedBeaconBlock
+		if err := input.Read(spec.Wrap(&b)); err != nil {
+			return nil, nil, err
+		}
+		header := &spec_types.DenebLightClientHeader{
+			Beacon:    *b.Message.Header(spec),
+			Execution: *b.Message.Body.ExecutionPayload.Header(spec),
+		}
+		body, err := util.TreeView(spec.Wrap(&b.Message.Body), deneb.BeaconBlockBodyType(spec))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := fieldBranch(body, []string{"execution_payload"}, nil, header.ExecutionBranch[:]); err != nil {
+			return nil, nil, err
+		}
+		return header, &b.Message.Body.SyncAggregate, nil
+	default:
+		return nil, nil, fmt.Errorf("unrecognized phase: %s", phase)
+	}
+}
+
+// checkBlockState checks that the state is the post-state of the block.
+func checkBlockState(header *common.BeaconBlockHeader, state common.BeaconState) error {
+	root := state.HashTreeRoot(tree.GetHashFn())
+	if header.StateRoot != root {
+		return fmt.Errorf("block state root %s does not match state root %s", header.StateRoot, root)
+	}
+	return nil
+}
+
+// stateBranch decodes the value at the path in the state into dest,
+// and fills the branch with the merkle proof of the value, ordered from the bottom up.
+func stateBranch(state common.BeaconState, path []string, dest codec.Deserializable, branch []common.Root) error {
+	v, ok := state.(view.View)
+	if !ok {
+		return fmt.Errorf("state %T is not tree-backed", state)
+	}
+	return fieldBranch(v, path, dest, branch)
+}
+
+// fieldBranch is like stateBranch, for any view. If dest is nil, only the branch is filled.
+func fieldBranch(v view.View, path []string, dest codec.Deserializable, branch []common.Root) error {
+	target, err := util.ResolvePath(v.Type(), path)
+	if err != nil {
+		return err
+	}
+	gindices := util.BranchGindices(target.Gindex)
+	if len(gindices) != len(branch) {
+		return fmt.Errorf("expected a branch of %d nodes for %s, but it is at gindex %d", len(branch), util.FormatPath(path), target.Gindex)
+	}
+	node := v.Backing()
+	hFn := tree.GetHashFn()
+	for i, g := range gindices {
+		if branch[i], err = nodeRoot(node, g, hFn); err != nil {
+			return err
+		}
+	}
+	if dest == nil {
+		return nil
+	}
+	sub, err := target.View(node)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := sub.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		return err
+	}
+	return dest.Deserialize(codec.NewDecodingReader(&buf, uint64(buf.Len())))
+}
+
+type LightClientProcessCmd struct{}
+
+func (c *LightClientProcessCmd) Help() string {
+	return "Run a local light-client store from a bootstrap and a sequence of updates"
+}
+
+func (c *LightClientProcessCmd) Cmd(route string) (cmd interface{}, err error) {
+	switch route {
+	case "altair", "bellatrix":
+		return &LightClientProcessPhaseCmd[spec_types.LightClientHeader, *spec_types.LightClientHeader]{Phase: route}, nil
+	case "capella":
+		return &LightClientProcessPhaseCmd[spec_types.CapellaLightClientHeader, *spec_types.CapellaLightClientHeader]{Phase: route}, nil
+	case "deneb":
+		return &LightClientProcessPhaseCmd[spec_types.DenebLightClientHeader, *spec_types.DenebLightClientHeader]{Phase: route}, nil
+	}
+	return nil, ask.UnrecognizedErr
+}
+
+func (c *LightClientProcessCmd) Routes() []string {
+	return lightClientPhases
+}
+
+type LightClientProcessPhaseCmd[H any, PH spec_types.LightClientHeaderPtr[H]] struct {
+	Phase                 string
+	configs.SpecOptions   `ask:"."`
+	Bootstrap             util.ObjInput `ask:"--bootstrap" help:"LightClientBootstrap to initialize the store with"`
+	TrustedRoot           tree.Root     `ask:"--trusted-root" help:"Trusted block root to check the bootstrap header against. If not set, the bootstrap header is trusted"`
+	TrustedRootChanged    bool          `changed:"trusted-root"`
+	GenesisValidatorsRoot tree.Root     `ask:"--genesis-validators-root" help:"Genesis validators root of the chain, used in the sync committee signature domain"`
+	CurrentSlot           uint64        `ask:"--current-slot" help:"Current slot of the light client. If not set, updates are not checked against it"`
+	CurrentSlotChanged    bool          `changed:"current-slot"`
+}
+
+func (c *LightClientProcessPhaseCmd[H, PH]) Help() string {
+	return fmt.Sprintf("Process light-client updates, given as arguments in order (%s)", c.Phase)
+}
+
+func (c *LightClientProcessPhaseCmd[H, PH]) Run(ctx context.Context, args ...string) error {
+	spec, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	var bootstrap spec_types.LightClientBootstrap[H, PH]
+	if err := c.Bootstrap.Read(spec.Wrap(&bootstrap)); err != nil {
+		return fmt.Errorf("failed to read bootstrap: %v", err)
+	}
+	hFn := tree.GetHashFn()
+	bootstrapHeader := PH(&bootstrap.Header).BeaconHeader()
+	trusted := bootstrapHeader.HashTreeRoot(hFn)
+	if c.TrustedRootChanged && trusted != c.TrustedRoot {
+		return fmt.Errorf("bootstrap header root %s does not match trusted root %s", trusted, c.TrustedRoot)
+	}
+	store := &lightClientStore[H, PH]{
+		spec:                  spec,
+		stateType:             spec_types.TypesByPhase[c.Phase]["BeaconState"].TypeDef(spec),
+		genesisValidatorsRoot: c.GenesisValidatorsRoot,
+	}
+	if err := store.init(&bootstrap); err != nil {
+		return fmt.Errorf("invalid bootstrap: %v", err)
+	}
+	fmt.Printf("bootstrap: slot %d, root %s\n", bootstrapHeader.Slot, trusted)
+	for i, arg := range args {
+		var update spec_types.LightClientUpdate[H, PH]
+		input := util.ObjInput(arg)
+		if err := input.Read(spec.Wrap(&update)); err != nil {
+			return fmt.Errorf("failed to read update %d: %v", i, err)
+		}
+		currentSlot := update.SignatureSlot
+		if c.CurrentSlotChanged {
+			currentSlot = common.Slot(c.CurrentSlot)
+		}
+		applied, err := store.process(&update, currentSlot)
+		if err != nil {
+			return fmt.Errorf("invalid update %d (%s): %v", i, arg, err)
+		}
+		status := "optimistic"
+		if applied {
+			status = "applied"
+		}
+		fmt.Printf("update %d: signature slot %d, attested slot %d, finalized slot %d, participants %d/%d, %s\n",
+			i, update.SignatureSlot, PH(&update.AttestedHeader).BeaconHeader().Slot, PH(&update.FinalizedHeader).BeaconHeader().Slot,
+			syncParticipants(&update.SyncAggregate), spec.SYNC_COMMITTEE_SIZE, status)
+	}
+	finalized := PH(&store.finalizedHeader).BeaconHeader()
+	optimistic := PH(&store.optimisticHeader).BeaconHeader()
+	fmt.Printf("finalized:  slot %d, root %s\n", finalized.Slot, finalized.HashTreeRoot(hFn))
+	fmt.Printf("optimistic: slot %d, root %s\n", optimistic.Slot, optimistic.HashTreeRoot(hFn))
+	return nil
+}
+
+// lightClientStore is the light-client store of the sync protocol, without the force-update of the best valid update.
+type lightClientStore[H any, PH spec_types.LightClientHeaderPtr[H]] struct {
+	spec *common.Spec
+	// type of the beacon state that the headers commit to, to compute the gindices of branches
+	stateType             view.TypeDef
+	genesisValidatorsRoot common.Root
+
+	finalizedHeader      H
+	currentSyncCommittee common.SyncCommittee
+	// nil if not known yet
+	nextSyncCommittee *common.SyncCommittee
+	optimisticHeader  H
+
+	previousMaxActiveParticipants uint64
+	currentMaxActiveParticipants  uint64
+}
+
+func (s *lightClientStore[H, PH]) init(bootstrap *spec_types.LightClientBootstrap[H, PH]) error {
+	if err := validLightClientHeader(s.spec, PH(&bootstrap.Header)); err != nil {
+		return err
+	}
+	header := PH(&bootstrap.Header).BeaconHeader()
+	leaf := bootstrap.CurrentSyncCommittee.HashTreeRoot(s.spec, tree.GetHashFn())
+	if err := s.checkBranch(leaf, bootstrap.CurrentSyncCommitteeBranch[:], header.StateRoot, "current_sync_committee"); err != nil {
+		return err
+	}
+	s.finalizedHeader = bootstrap.Header
+	s.currentSyncCommittee = bootstrap.CurrentSyncCommittee
+	s.optimisticHeader = bootstrap.Header
+	return nil
+}
+
+func (s *lightClientStore[H, PH]) period(slot common.Slot) common.Epoch {
+	return s.spec.SlotToEpoch(slot) / s.spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD
+}
+
+// checkBranch checks the merkle branch of the leaf at the given path in the state.
+func (s *lightClientStore[H, PH]) checkBranch(leaf common.Root, branch []common.Root, stateRoot common.Root, path ...string) error {
+	return checkFieldBranch(s.stateType, leaf, branch, stateRoot, path...)
+}
+
+// checkFieldBranch checks the merkle branch of the leaf at the given path in an object of the given type.
+func checkFieldBranch(typ view.TypeDef, leaf common.Root, branch []common.Root, root common.Root, path ...string) error {
+	target, err := util.ResolvePath(typ, path)
+	if err != nil {
+		return err
+	}
+	computed, err := util.BranchRoot(leaf, target.Gindex, branch)
+	if err != nil {
+		return fmt.Errorf("invalid %s branch: %v", util.FormatPath(path), err)
+	}
+	if computed != root {
+		return fmt.Errorf("invalid %s branch: computed root %s, expected %s", util.FormatPath(path), computed, root)
+	}
+	return nil
+}
+
+// validLightClientHeader checks the execution payload header of the light-client header against the beacon block body root.
+// Headers before capella have no execution data, and headers before deneb commit to a capella execution payload header.
+func validLightClientHeader(spec *common.Spec, header spec_types.LightClientHeaderObj) error {
+	hFn := tree.GetHashFn()
+	var execRoot common.Root
+	var branch []common.Root
+	switch h := header.(type) {
+	case *spec_types.CapellaLightClientHeader:
+		branch = h.ExecutionBranch[:]
+		if spec.SlotToEpoch(h.Beacon.Slot) < spec.CAPELLA_FORK_EPOCH {
+			if h.Execution.HashTreeRoot(hFn) != new(capella.ExecutionPayloadHeader).HashTreeRoot(hFn) || !isZeroBranch(branch) {
+				return fmt.Errorf("header before capella must not have execution data")
+			}
+			return nil
+		}
+		execRoot = h.Execution.HashTreeRoot(hFn)
+	case *spec_types.DenebLightClientHeader:
+		branch = h.ExecutionBranch[:]
+		epoch := spec.SlotToEpoch(h.Beacon.Slot)
+		if epoch < spec.CAPELLA_FORK_EPOCH {
+			if h.Execution.HashTreeRoot(hFn) != new(deneb.ExecutionPayloadHeader).HashTreeRoot(hFn) || !isZeroBranch(branch) {
+				return fmt.Errorf("header before capella must not have execution data")
+			}
+			return nil
+		}
+		if epoch < spec.DENEB_FORK_EPOCH {
+			if h.Execution.BlobGasUsed != 0 || h.Execution.ExcessBlobGas != 0 {
+				return fmt.Errorf("header before deneb must not have blob gas data")
+			}
+			e := &h.Execution
+			execRoot = (&capella.ExecutionPayloadHeader{
+				ParentHash:       e.ParentHash,
+				FeeRecipient:     e.FeeRecipient,
+				StateRoot:        e.StateRoot,
+				ReceiptsRoot:     e.ReceiptsRoot,
+				LogsBloom:        e.LogsBloom,
+				PrevRandao:       e.PrevRandao,
+				BlockNumber:      e.BlockNumber,
+				GasLimit:         e.GasLimit,
+				GasUsed:          e.GasUsed,
+				Timestamp:        e.Timestamp,
+				ExtraData:        e.ExtraData,
+				BaseFeePerGas:    e.BaseFeePerGas,
+				BlockHash:        e.BlockHash,
+				TransactionsRoot: e.TransactionsRoot,
+				WithdrawalsRoot:  e.WithdrawalsRoot,
+			}).HashTreeRoot(hFn)
+		} else {
+			execRoot = h.Execution.HashTreeRoot(hFn)
+		}
+	default:
+		return nil
+	}
+	// the execution payload is at the same position in the capella and deneb block bodies
+	return checkFieldBranch(capella.BeaconBlockBodyType(spec), execRoot, branch, header.BeaconHeader().BodyRoot, "execution_payload")
+}
+
+func isZeroBranch(branch []common.Root) bool {
+	for _, r := range branch {
+		if r != (common.Root{}) {
+			return false
+		}
+	}
+	return true
+}
+
+func isEmptySyncCommittee(c *common.SyncCommittee) bool {
+	for _, p := range c.Pubkeys {
+		if p != (common.BLSPubkey{}) {
+			return false
+		}
+	}
+	return c.AggregatePubkey == (common.BLSPubkey{})
+}
+
+func isEmptyHeader[H any, PH spec_types.LightClientHeaderPtr[H]](h *H) bool {
+	hFn := tree.GetHashFn()
+	return PH(h).HashTreeRoot(hFn) == PH(new(H)).HashTreeRoot(hFn)
+}
+
+func syncParticipants(agg *altair.SyncAggregate) uint64 {
+	count := 0
+	for _, b := range agg.SyncCommitteeBits {
+		count += bits.OnesCount8(b)
+	}
+	return uint64(count)
+}
+
+func (s *lightClientStore[H, PH]) validate(update *spec_types.LightClientUpdate[H, PH], currentSlot common.Slot) error {
+	spec := s.spec
+	hFn := tree.GetHashFn()
+	attestedHeader := PH(&update.AttestedHeader).BeaconHeader()
+	finalizedHeader := PH(&update.FinalizedHeader).BeaconHeader()
+	storeFinalizedHeader := PH(&s.finalizedHeader).BeaconHeader()
+	participants := syncParticipants(&update.SyncAggregate)
+	if participants < uint64(spec.MIN_SYNC_COMMITTEE_PARTICIPANTS) {
+		return fmt.Errorf("%d sync committee participants, need at least %d", participants, spec.MIN_SYNC_COMMITTEE_PARTICIPANTS)
+	}
+	if err := validLightClientHeader(spec, PH(&update.AttestedHeader)); err != nil {
+		return fmt.Errorf("invalid attested header: %v", err)
+	}
+	if currentSlot < update.SignatureSlot {
+		return fmt.Errorf("signature slot %d is after current slot %d", update.SignatureSlot, currentSlot)
+	}
+	if update.SignatureSlot <= attestedHeader.Slot {
+		return fmt.Errorf("signature slot %d is not after attested slot %d", update.SignatureSlot, attestedHeader.Slot)
+	}
+	if attestedHeader.Slot < finalizedHeader.Slot {
+		return fmt.Errorf("attested slot %d is before finalized slot %d", attestedHeader.Slot, finalizedHeader.Slot)
+	}
+	storePeriod := s.period(storeFinalizedHeader.Slot)
+	signaturePeriod := s.period(update.SignatureSlot)
+	if s.nextSyncCommittee != nil {
+		if signaturePeriod != storePeriod && signaturePeriod != storePeriod+1 {
+			return fmt.Errorf("signature period %d is not the store period %d or the next", signaturePeriod, storePeriod)
+		}
+	} else if signaturePeriod != storePeriod {
+		return fmt.Errorf("signature period %d is not the store period %d, and the next sync committee is unknown", signaturePeriod, storePeriod)
+	}
+
+	isSyncCommitteeUpdate := !isZeroBranch(update.NextSyncCommitteeBranch[:])
+	isFinalityUpdate := !isZeroBranch(update.FinalityBranch[:])
+	attestedPeriod := s.period(attestedHeader.Slot)
+	hasNextSyncCommittee := s.nextSyncCommittee == nil && isSyncCommitteeUpdate && attestedPeriod == storePeriod
+	if attestedHeader.Slot <= storeFinalizedHeader.Slot && !hasNextSyncCommittee {
+		return fmt.Errorf("attested slot %d is not after store finalized slot %d, and the update has no new next sync committee",
+			attestedHeader.Slot, storeFinalizedHeader.Slot)
+	}
+
+	if !isFinalityUpdate {
+		if !isEmptyHeader[H, PH](&update.FinalizedHeader) {
+			return fmt.Errorf("finalized header is set without finality branch")
+		}
+	} else {
+		var finalizedRoot common.Root
+		if finalizedHeader.Slot == common.GENESIS_SLOT {
+			if !isEmptyHeader[H, PH](&update.FinalizedHeader) {
+				return fmt.Errorf("finalized header at genesis must be empty")
+			}
+		} else {
+			if err := validLightClientHeader(spec, PH(&update.FinalizedHeader)); err != nil {
+				return fmt.Errorf("invalid finalized header: %v", err)
+			}
+			finalizedRoot = finalizedHeader.HashTreeRoot(hFn)
+		}
+		if err := s.checkBranch(finalizedRoot, update.FinalityBranch[:], attestedHeader.StateRoot, "finalized_checkpoint", "root"); err != nil {
+			return err
+		}
+	}
+
+	if !isSyncCommitteeUpdate {
+		if !isEmptySyncCommittee(&update.NextSyncCommittee) {
+			return fmt.Errorf("next sync committee is set without branch")
+		}
+	} else {
+		leaf := update.NextSyncCommittee.HashTreeRoot(spec, hFn)
+		if attestedPeriod == storePeriod && s.nextSyncCommittee != nil {
+			if known := s.nextSyncCommittee.HashTreeRoot(spec, hFn); known != leaf {
+				return fmt.Errorf("next sync committee %s does not match known next sync committee %s", leaf, known)
+			}
+		}
+		if err := s.checkBranch(leaf, update.NextSyncCommitteeBranch[:], attestedHeader.StateRoot, "next_sync_committee"); err != nil {
+			return err
+		}
+	}
+
+	committee := &s.currentSyncCommittee
+	if signaturePeriod != storePeriod {
+		committee = s.nextSyncCommittee
+	}
+	pubkeys := make([]*blsu.Pubkey, 0, participants)
+	for i, p := range committee.Pubkeys {
+		if update.SyncAggregate.SyncCommitteeBits.GetBit(uint64(i)) {
+			pub, err := p.Pubkey()
+			if err != nil {
+				return fmt.Errorf("invalid sync committee pubkey %d: %v", i, err)
+			}
+			pubkeys = append(pubkeys, pub)
+		}
+	}
+	sig, err := update.SyncAggregate.SyncCommitteeSignature.Signature()
+	if err != nil {
+		return fmt.Errorf("invalid sync committee signature: %v", err)
+	}
+	prevSlot := update.SignatureSlot
+	if prevSlot > 0 {
+		prevSlot--
+	}
+	version := spec_types.ForkAtEpoch(spec, spec.SlotToEpoch(prevSlot)).Version(spec)
+	domain := common.ComputeDomain(common.DOMAIN_SYNC_COMMITTEE, version, s.genesisValidatorsRoot)
+	signingRoot := common.ComputeSigningRoot(attestedHeader.HashTreeRoot(hFn), domain)
+	if !blsu.FastAggregateVerify(pubkeys, signingRoot[:], sig) {
+		return fmt.Errorf("sync committee signature does not verify (fork version %s, genesis validators root %s)", version, s.genesisValidatorsRoot)
+	}
+	return nil
+}
+
+// process validates the update and applies it to the store. It returns true if the finalized header was updated.
+func (s *lightClientStore[H, PH]) process(update *spec_types.LightClientUpdate[H, PH], currentSlot common.Slot) (bool, error) {
+	if err := s.validate(update, currentSlot); err != nil {
+		return false, err
+	}
+	attestedHeader := PH(&update.AttestedHeader).BeaconHeader()
+	finalizedHeader := PH(&update.FinalizedHeader).BeaconHeader()
+	participants := syncParticipants(&update.SyncAggregate)
+	if participants > s.currentMaxActiveParticipants {
+		s.currentMaxActiveParticipants = participants
+	}
+	safetyThreshold := s.previousMaxActiveParticipants
+	if s.currentMaxActiveParticipants > safetyThreshold {
+		safetyThreshold = s.currentMaxActiveParticipants
+	}
+	safetyThreshold /= 2
+	if participants > safetyThreshold && attestedHeader.Slot > PH(&s.optimisticHeader).BeaconHeader().Slot {
+		s.optimisticHeader = update.AttestedHeader
+	}
+
+	isSyncCommitteeUpdate := !isZeroBranch(update.NextSyncCommitteeBranch[:])
+	isFinalityUpdate := !isZeroBranch(update.FinalityBranch[:])
+	hasFinalizedNextSyncCommittee := s.nextSyncCommittee == nil && isSyncCommitteeUpdate && isFinalityUpdate &&
+		s.period(finalizedHeader.Slot) == s.period(attestedHeader.Slot)
+	if participants*3 >= uint64(s.spec.SYNC_COMMITTEE_SIZE)*2 &&
+		(finalizedHeader.Slot > PH(&s.finalizedHeader).BeaconHeader().Slot || hasFinalizedNextSyncCommittee) {
+		return true, s.apply(update)
+	}
+	return false, nil
+}
+
+func (s *lightClientStore[H, PH]) apply(update *spec_types.LightClientUpdate[H, PH]) error {
+	finalizedSlot := PH(&update.FinalizedHeader).BeaconHeader().Slot
+	storePeriod := s.period(PH(&s.finalizedHeader).BeaconHeader().Slot)
+	finalizedPeriod := s.period(finalizedSlot)
+	// an empty next sync committee leaves it unknown
+	var next *common.SyncCommittee
+	if !isEmptySyncCommittee(&update.NextSyncCommittee) {
+		next = &update.NextSyncCommittee
+	}
+	if s.nextSyncCommittee == nil {
+		if finalizedPeriod != storePeriod {
+			return fmt.Errorf("finalized period %d is not the store period %d", finalizedPeriod, storePeriod)
+		}
+		s.nextSyncCommittee = next
+	} else if finalizedPeriod == storePeriod+1 {
+		s.currentSyncCommittee = *s.nextSyncCommittee
+		s.nextSyncCommittee = next
+		s.previousMaxActiveParticipants = s.currentMaxActiveParticipants
+		s.currentMaxActiveParticipants = 0
+	}
+	if finalizedSlot > PH(&s.finalizedHeader).BeaconHeader().Slot {
+		s.finalizedHeader = update.FinalizedHeader
+		if finalizedSlot > PH(&s.optimisticHeader).BeaconHeader().Slot {
+			s.optimisticHeader = s.finalizedHeader
+		}
+	}
+	return nil
+}
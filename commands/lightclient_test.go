@@ -0,0 +1,295 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zcli/spec_types"
+	"github.com/protolambda/zcli/util"
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/tree"
+)
+
+// branchRoot computes the root of the leaf at the gindex, with the branch ordered from the bottom up.
+func branchRoot(leaf common.Root, gindex tree.Gindex64, branch []common.Root) common.Root {
+	hFn := tree.GetHashFn()
+	for _, sibling := range branch {
+		if gindex&1 == 1 {
+			leaf = hFn(sibling, leaf)
+		} else {
+			leaf = hFn(leaf, sibling)
+		}
+		gindex >>= 1
+	}
+	return leaf
+}
+
+// lightClientChain is an altair genesis state, with a block on top of it, and a child block that signs it.
+type lightClientChain struct {
+	state       common.BeaconState
+	block       *altair.SignedBeaconBlock
+	child       *altair.SignedBeaconBlock
+	stateInput  string
+	blockInput  string
+	childInput  string
+	stateRoot   common.Root
+	blockHeader *common.BeaconBlockHeader
+}
+
+func newLightClientChain(t *testing.T) *lightClientChain {
+	t.Helper()
+	spec := configs.Minimal
+	state, _ := genesisState(t, "altair")
+	c := &lightClientChain{state: state, stateRoot: state.HashTreeRoot(tree.GetHashFn())}
+	c.block = &altair.SignedBeaconBlock{Message: altair.BeaconBlock{StateRoot: c.stateRoot}}
+	c.block.Message.Body.SyncAggregate.SyncCommitteeBits = make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8)
+	c.blockHeader = c.block.Message.Header(spec)
+	c.child = &altair.SignedBeaconBlock{Message: altair.BeaconBlock{
+		Slot:       1,
+		ParentRoot: c.blockHeader.HashTreeRoot(tree.GetHashFn()),
+	}}
+	bits := make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8)
+	for i := range bits {
+		bits[i] = 0xff
+	}
+	c.child.Message.Body.SyncAggregate.SyncCommitteeBits = bits
+	c.child.Message.Body.SyncAggregate.SyncCommitteeSignature = c.syncSignature(t)
+	c.stateInput = writeState(t, state)
+	c.blockInput = writeInput(t, "block", spec.Wrap(c.block))
+	c.childInput = writeInput(t, "child", spec.Wrap(c.child))
+	return c
+}
+
+// syncSignature signs the block with all members of the current sync committee of the state.
+func (c *lightClientChain) syncSignature(t *testing.T) common.BLSSignature {
+	t.Helper()
+	spec := configs.Minimal
+	state := c.state.(*altair.BeaconStateView)
+	committee, err := state.CurrentSyncCommittee()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkeysView, err := committee.Pubkeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkeys, err := pubkeysView.Flatten()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[common.BLSPubkey]*blsu.SecretKey)
+	for _, key := range testKeys(t) {
+		pub, err := blsu.SkToPk(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[pub.Serialize()] = key
+	}
+	genesisValidatorsRoot, err := state.GenesisValidatorsRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	domain := common.ComputeDomain(common.DOMAIN_SYNC_COMMITTEE, spec.GENESIS_FORK_VERSION, genesisValidatorsRoot)
+	signingRoot := common.ComputeSigningRoot(c.blockHeader.HashTreeRoot(tree.GetHashFn()), domain)
+	sigs := make([]*blsu.Signature, 0, len(pubkeys))
+	for _, pub := range pubkeys {
+		sigs = append(sigs, blsu.Sign(keys[pub], signingRoot[:]))
+	}
+	sig, err := blsu.Aggregate(sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig.Serialize()
+}
+
+func TestLightClientBootstrap(t *testing.T) {
+	spec := configs.Minimal
+	chain := newLightClientChain(t)
+	out := filepath.Join(t.TempDir(), "bootstrap.ssz")
+	args := minimalArgs("--state", chain.stateInput, "--block", chain.blockInput, "--out", "ssz:"+out)
+	if _, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "bootstrap", "altair"), args...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var bootstrap spec_types.LightClientBootstrap[spec_types.LightClientHeader, *spec_types.LightClientHeader]
+	input := util.ObjInput("ssz:" + out)
+	if err := input.Read(spec.Wrap(&bootstrap)); err != nil {
+		t.Fatal(err)
+	}
+	if bootstrap.Header.Beacon != *chain.blockHeader {
+		t.Fatalf("got header %v, expected %v", bootstrap.Header.Beacon, chain.blockHeader)
+	}
+	leaf := bootstrap.CurrentSyncCommittee.HashTreeRoot(spec, tree.GetHashFn())
+	if root := branchRoot(leaf, 54, bootstrap.CurrentSyncCommitteeBranch[:]); root != chain.stateRoot {
+		t.Fatalf("current sync committee branch computes root %s, expected state root %s", root, chain.stateRoot)
+	}
+
+	// the child block does not commit to the state
+	args = minimalArgs("--state", chain.stateInput, "--block", chain.childInput, "--out", "ssz:"+out)
+	if _, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "bootstrap", "altair"), args...); err == nil || !strings.Contains(err.Error(), "does not match state root") {
+		t.Fatalf("got error %v, expected the state root to mismatch", err)
+	}
+}
+
+func TestLightClientCapellaBootstrap(t *testing.T) {
+	spec := configs.Minimal
+	state, _ := genesisState(t, "capella")
+	stateRoot := state.HashTreeRoot(tree.GetHashFn())
+	block := &capella.SignedBeaconBlock{Message: capella.BeaconBlock{StateRoot: stateRoot}}
+	block.Message.Body.SyncAggregate.SyncCommitteeBits = make(altair.SyncCommitteeBits, spec.SYNC_COMMITTEE_SIZE/8)
+	block.Message.Body.ExecutionPayload.BlockNumber = 7
+	out := filepath.Join(t.TempDir(), "bootstrap.ssz")
+	args := minimalArgs("--state", writeState(t, state), "--block", writeInput(t, "block", spec.Wrap(block)), "--out", "ssz:"+out)
+	if _, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "bootstrap", "capella"), args...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var bootstrap spec_types.LightClientBootstrap[spec_types.CapellaLightClientHeader, *spec_types.CapellaLightClientHeader]
+	input := util.ObjInput("ssz:" + out)
+	if err := input.Read(spec.Wrap(&bootstrap)); err != nil {
+		t.Fatal(err)
+	}
+	header := &bootstrap.Header
+	if header.Execution.BlockNumber != 7 {
+		t.Fatalf("got execution block number %d, expected 7", header.Execution.BlockNumber)
+	}
+	// the execution payload is field 9 of the body, with a depth of 4
+	leaf := header.Execution.HashTreeRoot(tree.GetHashFn())
+	if root := branchRoot(leaf, 25, header.ExecutionBranch[:]); root != header.Beacon.BodyRoot {
+		t.Fatalf("execution branch computes root %s, expected body root %s", root, header.Beacon.BodyRoot)
+	}
+	leaf = bootstrap.CurrentSyncCommittee.HashTreeRoot(spec, tree.GetHashFn())
+	if root := branchRoot(leaf, 54, bootstrap.CurrentSyncCommitteeBranch[:]); root != stateRoot {
+		t.Fatalf("current sync committee branch computes root %s, expected state root %s", root, stateRoot)
+	}
+}
+
+func TestLightClientUpdate(t *testing.T) {
+	spec := configs.Minimal
+	chain := newLightClientChain(t)
+	out := filepath.Join(t.TempDir(), "update.ssz")
+	args := minimalArgs(
+		"--attested-state", chain.stateInput, "--attested-block", chain.blockInput,
+		"--block", chain.childInput, "--finalized-block", chain.blockInput, "--out", "ssz:"+out)
+	if _, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "update", "altair"), args...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var update spec_types.LightClientUpdate[spec_types.LightClientHeader, *spec_types.LightClientHeader]
+	input := util.ObjInput("ssz:" + out)
+	if err := input.Read(spec.Wrap(&update)); err != nil {
+		t.Fatal(err)
+	}
+	if update.AttestedHeader.Beacon != *chain.blockHeader || update.SignatureSlot != 1 {
+		t.Fatalf("got attested header %v at signature slot %d", update.AttestedHeader.Beacon, update.SignatureSlot)
+	}
+	leaf := update.NextSyncCommittee.HashTreeRoot(spec, tree.GetHashFn())
+	if root := branchRoot(leaf, 55, update.NextSyncCommitteeBranch[:]); root != chain.stateRoot {
+		t.Fatalf("next sync committee branch computes root %s, expected state root %s", root, chain.stateRoot)
+	}
+	// the finalized checkpoint of the genesis state is empty
+	if update.FinalizedHeader.Beacon != (common.BeaconBlockHeader{}) {
+		t.Fatalf("expected an empty finalized header at genesis, got %v", update.FinalizedHeader.Beacon)
+	}
+	if root := branchRoot(common.Root{}, 105, update.FinalityBranch[:]); root != chain.stateRoot {
+		t.Fatalf("finality branch computes root %s, expected state root %s", root, chain.stateRoot)
+	}
+
+	// the finality branch is derived from the attested state, also without the finalized block
+	args = minimalArgs(
+		"--attested-state", chain.stateInput, "--attested-block", chain.blockInput,
+		"--block", chain.childInput, "--out", "ssz:"+out)
+	if _, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "update", "altair"), args...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := input.Read(spec.Wrap(&update)); err != nil {
+		t.Fatal(err)
+	}
+	if root := branchRoot(common.Root{}, 105, update.FinalityBranch[:]); root != chain.stateRoot {
+		t.Fatalf("finality branch without finalized block computes root %s, expected state root %s", root, chain.stateRoot)
+	}
+
+	// the child block is not signed by the state
+	args = minimalArgs(
+		"--attested-state", chain.stateInput, "--attested-block", chain.childInput,
+		"--block", chain.childInput, "--out", "ssz:"+out)
+	if _, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "update", "altair"), args...); err == nil {
+		t.Fatal("expected an error for an attested block that does not match the attested state")
+	}
+}
+
+func TestLightClientProcess(t *testing.T) {
+	chain := newLightClientChain(t)
+	dir := t.TempDir()
+	bootstrap := "ssz:" + filepath.Join(dir, "bootstrap.ssz")
+	args := minimalArgs("--state", chain.stateInput, "--block", chain.blockInput, "--out", bootstrap)
+	if _, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "bootstrap", "altair"), args...); err != nil {
+		t.Fatal(err)
+	}
+	update := "ssz:" + filepath.Join(dir, "update.ssz")
+	args = minimalArgs("--attested-state", chain.stateInput, "--attested-block", chain.blockInput, "--block", chain.childInput, "--out", update)
+	if _, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "update", "altair"), args...); err != nil {
+		t.Fatal(err)
+	}
+	finalityUpdate := "ssz:" + filepath.Join(dir, "finality_update.ssz")
+	args = minimalArgs("--attested-state", chain.stateInput, "--attested-block", chain.blockInput, "--block", chain.childInput,
+		"--finalized-block", chain.blockInput, "--out", finalityUpdate)
+	if _, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "update", "altair"), args...); err != nil {
+		t.Fatal(err)
+	}
+	genesisValidatorsRoot, err := chain.state.GenesisValidatorsRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockRoot := chain.blockHeader.HashTreeRoot(tree.GetHashFn())
+
+	cases := []struct {
+		name string
+		args []string
+		// lines of the output, or the error
+		want []string
+		err  string
+	}{
+		{"bootstrap only", []string{"--bootstrap", bootstrap}, []string{
+			fmt.Sprintf("bootstrap: slot 0, root %s", blockRoot),
+			fmt.Sprintf("finalized:  slot 0, root %s", blockRoot),
+		}, ""},
+		{"trusted root", []string{"--bootstrap", bootstrap, "--trusted-root", blockRoot.String()}, []string{
+			fmt.Sprintf("bootstrap: slot 0, root %s", blockRoot),
+		}, ""},
+		{"untrusted root", []string{"--bootstrap", bootstrap, "--trusted-root", genesisValidatorsRoot.String()}, nil,
+			"does not match trusted root"},
+		// the zero finalized root of the genesis state is proven without a finalized block
+		{"sync committee update", []string{"--bootstrap", bootstrap, "--genesis-validators-root", genesisValidatorsRoot.String(), update}, []string{
+			"update 0: signature slot 1, attested slot 0, finalized slot 0, participants 32/32, applied",
+		}, ""},
+		{"finalized sync committee update", []string{"--bootstrap", bootstrap, "--genesis-validators-root", genesisValidatorsRoot.String(), finalityUpdate}, []string{
+			"update 0: signature slot 1, attested slot 0, finalized slot 0, participants 32/32, applied",
+		}, ""},
+		{"wrong signature domain", []string{"--bootstrap", bootstrap, update}, nil, "sync committee signature does not verify"},
+		{"future update", []string{"--bootstrap", bootstrap, "--genesis-validators-root", genesisValidatorsRoot.String(), "--current-slot", "0", update}, nil,
+			"signature slot 1 is after current slot 0"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := runCmd(t, routeCmd(t, &LightClientCmd{}, "process", "altair"), minimalArgs(c.args...)...)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, expected %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, line := range c.want {
+				if !strings.Contains(out, line+"\n") {
+					t.Fatalf("output does not contain %q:\n%s", line, out)
+				}
+			}
+		})
+	}
+}
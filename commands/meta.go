@@ -2,11 +2,18 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/protolambda/ask"
 	"github.com/protolambda/zcli/spec_types"
 	"github.com/protolambda/zcli/util"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
 	"github.com/protolambda/zrnt/eth2/configs"
 )
 
@@ -17,15 +24,14 @@ func (c *MetaCmd) Help() string {
 }
 
 func (c *MetaCmd) Cmd(route string) (cmd interface{}, err error) {
-	switch route {
-	case "phase0", "altair", "bellatrix", "capella":
-		return &MetaPhaseCmd{Phase: route}, nil
+	if !checkAny(spec_types.Phases, route) && route != util.AutoPhase {
+		return nil, ask.UnrecognizedErr
 	}
-	return nil, ask.UnrecognizedErr
+	return &MetaPhaseCmd{Phase: route}, nil
 }
 
 func (c *MetaCmd) Routes() []string {
-	return spec_types.Phases
+	return phaseRoutes()
 }
 
 type MetaPhaseCmd struct {
@@ -43,30 +49,147 @@ func (c *MetaPhaseCmd) Cmd(route string) (cmd interface{}, err error) {
 	case "proposers":
 		return &ProposersCmd{Phase: c.Phase}, nil
 	case "sync_committees", "sync-committees", "synccommittees":
-		if c.Phase != "altair" {
+		if !hasSyncCommittees(c.Phase) {
 			return nil, ask.UnrecognizedErr
 		}
 		return &SyncCommitteesCmd{Phase: c.Phase}, nil
+	case "duties":
+		return &DutiesCmd{Phase: c.Phase}, nil
+	case "subnets":
+		return &SubnetsCmd{Phase: c.Phase}, nil
+	case "validator":
+		return &ValidatorCmd{Phase: c.Phase}, nil
+	case "validator-diff", "validator_diff":
+		return &ValidatorDiffCmd{Phase: c.Phase}, nil
 	}
 	return nil, ask.UnrecognizedErr
 }
 
 func (c *MetaPhaseCmd) Routes() []string {
 	out := []string{"committees", "proposers"}
-	if c.Phase == "altair" {
+	if hasSyncCommittees(c.Phase) {
 		out = append(out, "sync-committees")
 	}
-	return out
+	return append(out, "duties", "subnets", "validator", "validator-diff")
+}
+
+// hasSyncCommittees checks if the phase is Altair or later, or auto.
+func hasSyncCommittees(phase string) bool {
+	if phase == util.AutoPhase {
+		return true
+	}
+	fork, err := spec_types.ForkByPhase(phase)
+	if err != nil {
+		return false
+	}
+	altair, err := spec_types.ForkByPhase("altair")
+	if err != nil {
+		return false
+	}
+	return fork == altair || fork.After(altair)
+}
+
+// MetaOutput is the output format shared by the meta commands.
+type MetaOutput struct {
+	Format util.RecordFormat `ask:"--format" help:"Output format: text, json, ndjson or csv"`
+}
+
+// Writer creates a writer of records to STDOUT, in the output format.
+func (o *MetaOutput) Writer() *util.RecordWriter {
+	return util.NewRecordWriter(os.Stdout, o.Format)
+}
+
+// optionalUint64 is a number flag that tracks if it was set.
+type optionalUint64 struct {
+	value uint64
+	set   bool
+}
+
+func (o *optionalUint64) String() string {
+	if !o.set {
+		return ""
+	}
+	return strconv.FormatUint(o.value, 10)
+}
+
+func (o *optionalUint64) Set(v string) error {
+	x, err := strconv.ParseUint(v, 0, 64)
+	if err != nil {
+		return err
+	}
+	o.value, o.set = x, true
+	return nil
+}
+
+func (o *optionalUint64) Type() string {
+	return "uint64"
+}
+
+// EpochSelection selects the epoch, or a single slot, to look up with a meta command.
+type EpochSelection struct {
+	Epoch optionalUint64 `ask:"--epoch" help:"Epoch to look up. Later epochs are computed by processing a copy of the state"`
+	Slot  optionalUint64 `ask:"--slot" help:"Slot to look up, instead of a full epoch"`
+}
+
+// Selected returns the selected epoch, and the selected slot if any. If nothing is selected, ok is false.
+func (s *EpochSelection) Selected(spec *common.Spec) (epoch common.Epoch, slot *common.Slot, ok bool, err error) {
+	if s.Epoch.set && s.Slot.set {
+		return 0, nil, false, errors.New("cannot select both an epoch and a slot")
+	}
+	if s.Slot.set {
+		sl := common.Slot(s.Slot.value)
+		return spec.SlotToEpoch(sl), &sl, true, nil
+	}
+	return common.Epoch(s.Epoch.value), nil, s.Epoch.set, nil
+}
+
+// epochLookup is a state, with its phase and epochs-context, to look up the data of an epoch with.
+type epochLookup struct {
+	phase string
+	state common.BeaconState
+	epc   *common.EpochsContext
+}
+
+// lookupEpoch prepares the lookup of an epoch. For a later epoch than the current epoch of the state,
+// a copy of the state is processed to the start of the epoch, which may upgrade it to a later fork.
+func lookupEpoch(ctx context.Context, spec *common.Spec, phase string, state common.BeaconState, epc *common.EpochsContext, epoch common.Epoch) (*epochLookup, error) {
+	if epoch <= epc.CurrentEpoch.Epoch {
+		phase, err := statePhase(phase, state)
+		if err != nil {
+			return nil, err
+		}
+		return &epochLookup{phase: phase, state: state, epc: epc}, nil
+	}
+	start, err := spec.EpochStartSlot(epoch)
+	if err != nil {
+		return nil, err
+	}
+	copied, err := state.CopyState()
+	if err != nil {
+		return nil, err
+	}
+	upgradeable := &upgradeableState{BeaconState: copied}
+	epc = epc.Clone()
+	if err := common.ProcessSlots(ctx, spec, epc, upgradeable, start); err != nil {
+		return nil, fmt.Errorf("failed to process the state to epoch %d: %v", epoch, err)
+	}
+	phase, err = util.StatePhase(upgradeable.BeaconState)
+	if err != nil {
+		return nil, err
+	}
+	return &epochLookup{phase: phase, state: upgradeable.BeaconState, epc: epc}, nil
 }
 
 type CommitteesCmd struct {
 	Phase               string
 	configs.SpecOptions `ask:"."`
+	MetaOutput          `ask:"."`
+	EpochSelection      `ask:"."`
 	State               util.StateInput `ask:"<state>" help:"BeaconState, prefix with format, empty path for STDIN"`
 }
 
 func (c *CommitteesCmd) Help() string {
-	return fmt.Sprintf("List previous/current/next beacon committees (phase %s)", c.Phase)
+	return fmt.Sprintf("List previous/current/next beacon committees, or those of the selected epoch or slot (phase %s)", c.Phase)
 }
 
 func (c *CommitteesCmd) Run(ctx context.Context, args ...string) error {
@@ -83,8 +206,25 @@ func (c *CommitteesCmd) Run(ctx context.Context, args ...string) error {
 		return fmt.Errorf("cannot compute state epochs context: %v", err)
 	}
 	currentEpoch := epc.CurrentEpoch.Epoch
+	first, last := currentEpoch.Previous(), currentEpoch+1
+	selected, selectedSlot, ok, err := c.Selected(spec)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if selected < currentEpoch.Previous() {
+			return fmt.Errorf("cannot look up committees of epoch %d, the state is at epoch %d", selected, currentEpoch)
+		}
+		lookup, err := lookupEpoch(ctx, spec, c.Phase, state, epc, selected)
+		if err != nil {
+			return err
+		}
+		epc = lookup.epc
+		first, last = selected, selected
+	}
 
-	for epoch := currentEpoch.Previous(); epoch <= currentEpoch+1; epoch++ {
+	out := c.Writer()
+	for epoch := first; epoch <= last; epoch++ {
 		committeesPerSlot, err := epc.GetCommitteeCountPerSlot(epoch)
 		if err != nil {
 			return err
@@ -98,27 +238,57 @@ func (c *CommitteesCmd) Run(ctx context.Context, args ...string) error {
 			return err
 		}
 		for slot := start; slot < end; slot++ {
+			if selectedSlot != nil && slot != *selectedSlot {
+				continue
+			}
 			for i := common.CommitteeIndex(0); i < common.CommitteeIndex(committeesPerSlot); i++ {
 				committee, err := epc.GetBeaconCommittee(slot, i)
 				if err != nil {
 					return fmt.Errorf("cannot get committee for slot %d committee index %d", slot, i)
 				}
-				fmt.Printf("epoch: %7d    slot: %9d    committee index: %4d (out of %2d)   size: %3d    indices: %v\n",
-					spec.SlotToEpoch(slot), slot, i, committeesPerSlot, len(committee), committee)
+				if err := out.Write(&committeeRecord{
+					Epoch:             epoch,
+					Slot:              slot,
+					CommitteeIndex:    i,
+					CommitteesPerSlot: committeesPerSlot,
+					ValidatorIndices:  committee,
+				}); err != nil {
+					return err
+				}
 			}
 		}
 	}
-	return nil
+	return out.Close()
+}
+
+type committeeRecord struct {
+	Epoch             common.Epoch            `json:"epoch"`
+	Slot              common.Slot             `json:"slot"`
+	CommitteeIndex    common.CommitteeIndex   `json:"committee_index"`
+	CommitteesPerSlot uint64                  `json:"committees_per_slot,string"`
+	ValidatorIndices  []common.ValidatorIndex `json:"validator_indices"`
+}
+
+func (r *committeeRecord) String() string {
+	return fmt.Sprintf("epoch: %7d    slot: %9d    committee index: %4d (out of %2d)   size: %3d    indices: %v",
+		r.Epoch, r.Slot, r.CommitteeIndex, r.CommitteesPerSlot, len(r.ValidatorIndices), r.ValidatorIndices)
 }
 
 type ProposersCmd struct {
 	Phase               string
 	configs.SpecOptions `ask:"."`
+	MetaOutput          `ask:"."`
+	EpochSelection      `ask:"."`
+	Epochs              uint64          `ask:"--epochs" help:"Number of epochs to list, starting at the current or selected epoch"`
 	State               util.StateInput `ask:"<state>" help:"BeaconState, prefix with format, empty path for STDIN"`
 }
 
+func (c *ProposersCmd) Default() {
+	c.Epochs = 1
+}
+
 func (c *ProposersCmd) Help() string {
-	return fmt.Sprintf("List current beacon propoosers (phase %s)", c.Phase)
+	return fmt.Sprintf("List current beacon proposers, or those of the selected epoch or slot (phase %s)", c.Phase)
 }
 
 func (c *ProposersCmd) Run(ctx context.Context, args ...string) error {
@@ -134,39 +304,123 @@ func (c *ProposersCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return fmt.Errorf("cannot compute state epochs context: %v", err)
 	}
-	currentEpoch := epc.CurrentEpoch.Epoch
-	start, err := spec.EpochStartSlot(currentEpoch)
+	epoch, selectedSlot, ok, err := c.Selected(spec)
 	if err != nil {
 		return err
 	}
-	end, err := spec.EpochStartSlot(currentEpoch + 1)
-	if err != nil {
-		return err
+	currentEpoch := epc.CurrentEpoch.Epoch
+	if !ok {
+		epoch = currentEpoch
 	}
-	for slot := start; slot < end; slot++ {
-		proposerIndex, err := epc.GetBeaconProposer(slot)
+	if epoch < currentEpoch {
+		return fmt.Errorf("cannot look up proposers of epoch %d, before the current epoch %d of the state", epoch, currentEpoch)
+	}
+	if c.Epochs == 0 {
+		return errors.New("need to list at least 1 epoch")
+	}
+	if selectedSlot != nil && c.Epochs > 1 {
+		return errors.New("cannot list multiple epochs of a single slot")
+	}
+	lookup := &epochLookup{phase: c.Phase, state: state, epc: epc}
+	out := c.Writer()
+	caveats := make(map[string]bool)
+	for end := epoch + common.Epoch(c.Epochs); epoch < end; epoch++ {
+		if lookup, err = lookupEpoch(ctx, spec, lookup.phase, lookup.state, lookup.epc, epoch); err != nil {
+			return err
+		}
+		caveat := proposerCaveat(spec, currentEpoch, epoch)
+		start, err := spec.EpochStartSlot(epoch)
 		if err != nil {
-			return fmt.Errorf("cannot compute proposer index for slot %d: %v", slot, err)
+			return err
+		}
+		for slot := start; slot < start+spec.SLOTS_PER_EPOCH; slot++ {
+			if selectedSlot != nil && slot != *selectedSlot {
+				continue
+			}
+			proposerIndex, err := beaconProposer(spec, lookup.epc, lookup.state, lookup.phase, slot)
+			if err != nil {
+				return fmt.Errorf("cannot compute proposer index for slot %d: %v", slot, err)
+			}
+			if err := out.Write(&proposerRecord{Epoch: epoch, Slot: slot, ProposerIndex: proposerIndex, Caveat: caveat}); err != nil {
+				return err
+			}
+			caveats[caveat] = true
+		}
+	}
+	if err := writeCaveatNotes(out, caveats); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+const (
+	proposerCaveatBalances = "effective_balances"
+	proposerCaveatRandao   = "randao"
+)
+
+var caveatMarkers = map[string]string{
+	proposerCaveatBalances: "*",
+	proposerCaveatRandao:   "**",
+}
+
+var caveatDescriptions = map[string]string{
+	proposerCaveatBalances: "may change with the effective balance updates of later epoch transitions",
+	proposerCaveatRandao:   "may change with the RANDAO reveals of blocks that are not in the state yet",
+}
+
+// proposerCaveat describes why the proposers of an epoch may change with the blocks after the current epoch of the state.
+// The proposer seed is final once the RANDAO mix of MIN_SEED_LOOKAHEAD+1 epochs before is, and the effective balances in the current epoch only.
+func proposerCaveat(spec *common.Spec, currentEpoch common.Epoch, epoch common.Epoch) string {
+	switch {
+	case epoch >= currentEpoch+spec.MIN_SEED_LOOKAHEAD+1:
+		return proposerCaveatRandao
+	case epoch > currentEpoch:
+		return proposerCaveatBalances
+	default:
+		return ""
+	}
+}
+
+// writeCaveatNotes writes the description of each of the caveats of the listed proposers, in the text format.
+func writeCaveatNotes(out *util.RecordWriter, caveats map[string]bool) error {
+	for _, caveat := range []string{proposerCaveatBalances, proposerCaveatRandao} {
+		if caveats[caveat] {
+			if err := out.Textf("(%s) %s", caveatMarkers[caveat], caveatDescriptions[caveat]); err != nil {
+				return err
+			}
 		}
-		fmt.Printf("epoch: %7d    slot: %9d    proposer index: %4d\n", spec.SlotToEpoch(slot), slot, proposerIndex)
 	}
 	return nil
 }
 
+type proposerRecord struct {
+	Epoch         common.Epoch          `json:"epoch"`
+	Slot          common.Slot           `json:"slot"`
+	ProposerIndex common.ValidatorIndex `json:"proposer_index"`
+	// empty if the proposer is final, otherwise what may still change it
+	Caveat string `json:"caveat,omitempty"`
+}
+
+func (r *proposerRecord) String() string {
+	line := fmt.Sprintf("epoch: %7d    slot: %9d    proposer index: %4d", r.Epoch, r.Slot, r.ProposerIndex)
+	if r.Caveat != "" {
+		line += " " + caveatMarkers[r.Caveat]
+	}
+	return line
+}
+
 type SyncCommitteesCmd struct {
 	Phase               string
 	configs.SpecOptions `ask:"."`
+	MetaOutput          `ask:"."`
 	State               util.StateInput `ask:"<state>" help:"BeaconState, prefix with format, empty path for STDIN"`
 }
 
 func (c *SyncCommitteesCmd) Help() string {
-	return fmt.Sprintf("List current/next sync-committee members (phase %s)", c.Phase)
+	return fmt.Sprintf("List current/next sync-committee members, or only the positions of the validators given by index or 0x-prefixed pubkey as remaining arguments (phase %s)", c.Phase)
 }
 
 func (c *SyncCommitteesCmd) Run(ctx context.Context, args ...string) error {
-	if c.Phase != "altair" {
-		return fmt.Errorf("only Altair is supported for looking up the sync committee indices, not %q", c.Phase)
-	}
 	spec, err := c.Spec()
 	if err != nil {
 		return err
@@ -175,17 +429,1022 @@ func (c *SyncCommitteesCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
+	syncState, ok := state.(common.SyncCommitteeBeaconState)
+	if !ok {
+		phase, _ := statePhase(c.Phase, state)
+		return fmt.Errorf("%s states do not have sync committees", phase)
+	}
 	epc, err := common.NewEpochsContext(spec, state)
 	if err != nil {
 		return fmt.Errorf("cannot compute state epochs context: %v", err)
 	}
-	fmt.Println("--- current sync committee ---")
-	for i, vi := range epc.CurrentSyncCommittee.Indices {
-		fmt.Printf("current[%4d] => %4d: %s\n", i, vi, epc.CurrentSyncCommittee.CachedPubkeys[i].Compressed.String())
+	var selected map[common.ValidatorIndex]bool
+	if len(args) > 0 {
+		selected = make(map[common.ValidatorIndex]bool)
+		for _, arg := range args {
+			index, err := parseValidatorRef(epc, arg)
+			if err != nil {
+				return err
+			}
+			selected[index] = true
+		}
+	}
+	currentView, err := syncState.CurrentSyncCommittee()
+	if err != nil {
+		return err
+	}
+	nextView, err := syncState.NextSyncCommittee()
+	if err != nil {
+		return err
+	}
+	period := uint64(epc.CurrentEpoch.Epoch / spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD)
+	subcommitteeSize := uint64(spec.SYNC_COMMITTEE_SIZE) / common.SYNC_COMMITTEE_SUBNET_COUNT
+
+	out := c.Writer()
+	var mismatches []string
+	for _, sc := range []struct {
+		name      string
+		period    uint64
+		committee *common.IndexedSyncCommittee
+		view      *common.SyncCommitteeView
+	}{{"current", period, epc.CurrentSyncCommittee, currentView}, {"next", period + 1, epc.NextSyncCommittee, nextView}} {
+		// the aggregate is only checked, and not recomputed, by the state transition
+		expected, err := sc.view.AggregatePubkey()
+		if err != nil {
+			return err
+		}
+		computed, err := common.IndicesToSyncCommittee(sc.committee.Indices, epc.ValidatorPubkeyCache)
+		if err != nil {
+			return fmt.Errorf("failed to aggregate %s sync committee pubkeys: %v", sc.name, err)
+		}
+		matches := computed.AggregatePubkey == expected
+		if !matches {
+			mismatches = append(mismatches, sc.name)
+		}
+
+		if err := out.Textf("--- %s sync committee (period %d) ---", sc.name, sc.period); err != nil {
+			return err
+		}
+		for i, vi := range sc.committee.Indices {
+			if selected != nil && !selected[vi] {
+				continue
+			}
+			if err := out.Write(&syncCommitteeRecord{
+				SyncCommittee:          sc.name,
+				Period:                 sc.period,
+				AggregatePubkey:        expected,
+				AggregatePubkeyMatches: matches,
+				Position:               i,
+				SubcommitteeIndex:      uint64(i) / subcommitteeSize,
+				ValidatorIndex:         vi,
+				Pubkey:                 sc.committee.CachedPubkeys[i].Compressed,
+			}); err != nil {
+				return err
+			}
+		}
+		if matches {
+			err = out.Textf("aggregate pubkey: %s (matches the members)", expected)
+		} else {
+			err = out.Textf("aggregate pubkey: %s (does not match the members, which aggregate to %s)", expected, computed.AggregatePubkey)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
 	}
-	fmt.Println("--- next sync committee ---")
-	for i, vi := range epc.NextSyncCommittee.Indices {
-		fmt.Printf("next[%4d] => %4d: %s\n", i, vi, epc.NextSyncCommittee.CachedPubkeys[i].Compressed.String())
+	if len(mismatches) > 0 {
+		return fmt.Errorf("aggregate pubkey of the %s sync committee does not match the members", strings.Join(mismatches, " and "))
 	}
 	return nil
 }
+
+type syncCommitteeRecord struct {
+	// SyncCommittee is "current" or "next"
+	SyncCommittee string `json:"sync_committee"`
+	Period        uint64 `json:"period,string"`
+	// the aggregate pubkey of the committee in the state, and if it matches the aggregate of the member pubkeys
+	AggregatePubkey        common.BLSPubkey      `json:"aggregate_pubkey"`
+	AggregatePubkeyMatches bool                  `json:"aggregate_pubkey_matches"`
+	Position               int                   `json:"position,string"`
+	SubcommitteeIndex      uint64                `json:"subcommittee_index,string"`
+	ValidatorIndex         common.ValidatorIndex `json:"validator_index"`
+	Pubkey                 common.BLSPubkey      `json:"pubkey"`
+}
+
+func (r *syncCommitteeRecord) String() string {
+	return fmt.Sprintf("%s[%4d]    subcommittee: %d    => %4d: %s", r.SyncCommittee, r.Position, r.SubcommitteeIndex, r.ValidatorIndex, r.Pubkey)
+}
+
+type DutiesCmd struct {
+	Phase               string
+	configs.SpecOptions `ask:"."`
+	MetaOutput          `ask:"."`
+	EpochSelection      `ask:"."`
+	State               util.StateInput `ask:"<state>" help:"BeaconState, prefix with format, empty path for STDIN"`
+}
+
+func (c *DutiesCmd) Help() string {
+	return fmt.Sprintf("List the attester, proposer and sync-committee duties of validators, given by index or 0x-prefixed pubkey as remaining arguments, in the current or selected epoch (phase %s)", c.Phase)
+}
+
+func (c *DutiesCmd) Run(ctx context.Context, args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no validator indices or pubkeys specified")
+	}
+	spec, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	state, err := c.State.Read(spec, c.Phase)
+	if err != nil {
+		return err
+	}
+	epc, err := common.NewEpochsContext(spec, state)
+	if err != nil {
+		return fmt.Errorf("cannot compute state epochs context: %v", err)
+	}
+	epoch, selectedSlot, ok, err := c.Selected(spec)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		epoch = epc.CurrentEpoch.Epoch
+	}
+	if epoch < epc.CurrentEpoch.Epoch {
+		return fmt.Errorf("cannot look up duties of epoch %d, before the current epoch %d of the state", epoch, epc.CurrentEpoch.Epoch)
+	}
+	requested := make(map[common.ValidatorIndex]bool)
+	var indices []common.ValidatorIndex
+	for _, arg := range args {
+		index, err := parseValidatorRef(epc, arg)
+		if err != nil {
+			return err
+		}
+		if _, ok := epc.ValidatorPubkeyCache.Pubkey(index); !ok {
+			return fmt.Errorf("unknown validator index %d", index)
+		}
+		if !requested[index] {
+			requested[index] = true
+			indices = append(indices, index)
+		}
+	}
+	lookup, err := lookupEpoch(ctx, spec, c.Phase, state, epc, epoch)
+	if err != nil {
+		return err
+	}
+	duty := func(kind string, index common.ValidatorIndex) *dutyRecord {
+		pub, _ := lookup.epc.ValidatorPubkeyCache.Pubkey(index)
+		return &dutyRecord{Duty: kind, Epoch: epoch, ValidatorIndex: index, Pubkey: pub.Compressed}
+	}
+
+	out := c.Writer()
+	assignments, err := committeeAssignments(spec, lookup.epc, epoch)
+	if err != nil {
+		return err
+	}
+	for _, index := range indices {
+		a, ok := assignments[index]
+		if !ok || (selectedSlot != nil && a.Slot != *selectedSlot) {
+			continue
+		}
+		d := duty("attester", index)
+		d.Slot = &a.Slot
+		d.CommitteeIndex = &a.CommitteeIndex
+		d.CommitteeLength = &a.CommitteeLength
+		d.CommitteesAtSlot = &a.CommitteesAtSlot
+		d.ValidatorCommitteeIndex = &a.Position
+		if err := out.Write(d); err != nil {
+			return err
+		}
+	}
+
+	start, err := spec.EpochStartSlot(epoch)
+	if err != nil {
+		return err
+	}
+	caveat := proposerCaveat(spec, epc.CurrentEpoch.Epoch, epoch)
+	caveats := make(map[string]bool)
+	for slot := start; slot < start+spec.SLOTS_PER_EPOCH; slot++ {
+		if selectedSlot != nil && slot != *selectedSlot {
+			continue
+		}
+		proposerIndex, err := beaconProposer(spec, lookup.epc, lookup.state, lookup.phase, slot)
+		if err != nil {
+			return fmt.Errorf("cannot compute proposer index for slot %d: %v", slot, err)
+		}
+		if !requested[proposerIndex] {
+			continue
+		}
+		d := duty("proposer", proposerIndex)
+		d.Slot = &slot
+		d.Caveat = caveat
+		if err := out.Write(d); err != nil {
+			return err
+		}
+		caveats[caveat] = true
+	}
+
+	// the state is in the epoch, so the current sync committee is the one of the epoch,
+	// unless the selected slot is signed by the next sync committee
+	sc := lookup.epc.CurrentSyncCommittee
+	if selectedSlot != nil {
+		sc = syncCommitteeAtSlot(spec, lookup.epc, *selectedSlot)
+	}
+	if sc != nil {
+		for _, index := range indices {
+			var positions []int
+			for i, vi := range sc.Indices {
+				if vi == index {
+					positions = append(positions, i)
+				}
+			}
+			if len(positions) == 0 {
+				continue
+			}
+			d := duty("sync", index)
+			d.Slot = selectedSlot
+			d.ValidatorSyncCommitteeIndices = positions
+			if err := out.Write(d); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writeCaveatNotes(out, caveats); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// syncCommitteeAtSlot returns the sync committee that signs the block root of the slot, of the epochs-context in the epoch of the slot.
+// The messages are included in the next block, and verified with the committee of the next slot,
+// so the last slot of a sync committee period is signed by the next sync committee.
+func syncCommitteeAtSlot(spec *common.Spec, epc *common.EpochsContext, slot common.Slot) *common.IndexedSyncCommittee {
+	period := spec.SlotToEpoch(slot) / spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD
+	if spec.SlotToEpoch(slot+1)/spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD != period {
+		return epc.NextSyncCommittee
+	}
+	return epc.CurrentSyncCommittee
+}
+
+// dutyRecord is a validator duty, with the fields of the beacon-API duties endpoints.
+type dutyRecord struct {
+	// attester, proposer or sync
+	Duty           string                `json:"duty"`
+	Epoch          common.Epoch          `json:"epoch"`
+	ValidatorIndex common.ValidatorIndex `json:"validator_index"`
+	Pubkey         common.BLSPubkey      `json:"pubkey"`
+	// attester and proposer duties, and sync duties of a selected slot
+	Slot *common.Slot `json:"slot,omitempty"`
+	// proposer duties: empty if the proposer is final, otherwise what may still change it
+	Caveat string `json:"caveat,omitempty"`
+	// attester duties
+	CommitteeIndex          *common.CommitteeIndex `json:"committee_index,omitempty"`
+	CommitteeLength         *int                   `json:"committee_length,string,omitempty"`
+	CommitteesAtSlot        *uint64                `json:"committees_at_slot,string,omitempty"`
+	ValidatorCommitteeIndex *int                   `json:"validator_committee_index,string,omitempty"`
+	// sync duties
+	ValidatorSyncCommitteeIndices []int `json:"validator_sync_committee_indices,omitempty"`
+}
+
+func (r *dutyRecord) String() string {
+	prefix := fmt.Sprintf("epoch: %7d    validator: %7d    ", r.Epoch, r.ValidatorIndex)
+	switch r.Duty {
+	case "attester":
+		return prefix + fmt.Sprintf("attester    slot: %9d    committee index: %4d (out of %2d)    position: %4d (out of %4d)",
+			*r.Slot, *r.CommitteeIndex, *r.CommitteesAtSlot, *r.ValidatorCommitteeIndex, *r.CommitteeLength)
+	case "proposer":
+		line := prefix + fmt.Sprintf("proposer    slot: %9d", *r.Slot)
+		if r.Caveat != "" {
+			line += " " + caveatMarkers[r.Caveat]
+		}
+		return line
+	default:
+		if r.Slot != nil {
+			return prefix + fmt.Sprintf("sync        slot: %9d    positions: %v", *r.Slot, r.ValidatorSyncCommitteeIndices)
+		}
+		return prefix + fmt.Sprintf("sync        positions: %v", r.ValidatorSyncCommitteeIndices)
+	}
+}
+
+type SubnetsCmd struct {
+	Phase               string
+	configs.SpecOptions `ask:"."`
+	MetaOutput          `ask:"."`
+	EpochSelection      `ask:"."`
+	State               util.StateInput `ask:"<state>" help:"BeaconState, prefix with format, empty path for STDIN"`
+}
+
+func (c *SubnetsCmd) Help() string {
+	return fmt.Sprintf("List the attestation subnets of the committees and the sync subnets of the sync-committee members in the current or selected epoch, "+
+		"or only those of the validators given by index or 0x-prefixed pubkey as remaining arguments (phase %s)", c.Phase)
+}
+
+func (c *SubnetsCmd) Run(ctx context.Context, args ...string) error {
+	spec, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	state, err := c.State.Read(spec, c.Phase)
+	if err != nil {
+		return err
+	}
+	epc, err := common.NewEpochsContext(spec, state)
+	if err != nil {
+		return fmt.Errorf("cannot compute state epochs context: %v", err)
+	}
+	epoch, selectedSlot, ok, err := c.Selected(spec)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		epoch = epc.CurrentEpoch.Epoch
+	}
+	if epoch < epc.CurrentEpoch.Epoch {
+		return fmt.Errorf("cannot look up subnets of epoch %d, before the current epoch %d of the state", epoch, epc.CurrentEpoch.Epoch)
+	}
+	var selected map[common.ValidatorIndex]bool
+	var indices []common.ValidatorIndex
+	if len(args) > 0 {
+		selected = make(map[common.ValidatorIndex]bool)
+		for _, arg := range args {
+			index, err := parseValidatorRef(epc, arg)
+			if err != nil {
+				return err
+			}
+			if !selected[index] {
+				selected[index] = true
+				indices = append(indices, index)
+			}
+		}
+	}
+	lookup, err := lookupEpoch(ctx, spec, c.Phase, state, epc, epoch)
+	if err != nil {
+		return err
+	}
+	// subscriptions of the selected validators
+	attnets := make(map[common.ValidatorIndex][]uint64)
+	syncnets := make(map[common.ValidatorIndex][]uint64)
+
+	out := c.Writer()
+	if err := out.Textf("--- attestation subnets ---"); err != nil {
+		return err
+	}
+	committeesPerSlot, err := lookup.epc.GetCommitteeCountPerSlot(epoch)
+	if err != nil {
+		return err
+	}
+	start, err := spec.EpochStartSlot(epoch)
+	if err != nil {
+		return err
+	}
+	for slot := start; slot < start+spec.SLOTS_PER_EPOCH; slot++ {
+		if selectedSlot != nil && slot != *selectedSlot {
+			continue
+		}
+		for i := common.CommitteeIndex(0); i < common.CommitteeIndex(committeesPerSlot); i++ {
+			committee, err := lookup.epc.GetBeaconCommittee(slot, i)
+			if err != nil {
+				return fmt.Errorf("cannot get committee for slot %d committee index %d", slot, i)
+			}
+			subnet, err := phase0.ComputeSubnetForAttestation(spec, committeesPerSlot, slot, i)
+			if err != nil {
+				return err
+			}
+			members := committee
+			if selected != nil {
+				members = nil
+				for _, vi := range committee {
+					if selected[vi] {
+						members = append(members, vi)
+						attnets[vi] = append(attnets[vi], subnet)
+					}
+				}
+				if len(members) == 0 {
+					continue
+				}
+			}
+			slot, i := slot, i
+			if err := out.Write(&subnetRecord{
+				Type:             "attestation",
+				Epoch:            epoch,
+				Subnet:           subnet,
+				Slot:             &slot,
+				CommitteeIndex:   &i,
+				ValidatorIndices: members,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// like compute_subnets_for_sync_committee, the sync committee of the next slot of the state, or of the selected slot
+	syncSlot, err := lookup.state.Slot()
+	if err != nil {
+		return err
+	}
+	if selectedSlot != nil {
+		syncSlot = *selectedSlot
+	}
+	if sc := syncCommitteeAtSlot(spec, lookup.epc, syncSlot); sc != nil {
+		period := spec.SlotToEpoch(syncSlot+1) / spec.EPOCHS_PER_SYNC_COMMITTEE_PERIOD
+		if err := out.Textf("--- sync subnets (period %d) ---", period); err != nil {
+			return err
+		}
+		subcommitteeSize := uint64(spec.SYNC_COMMITTEE_SIZE) / common.SYNC_COMMITTEE_SUBNET_COUNT
+		for i, vi := range sc.Indices {
+			if selected != nil && !selected[vi] {
+				continue
+			}
+			subnet := uint64(i) / subcommitteeSize
+			syncnets[vi] = append(syncnets[vi], subnet)
+			position := i
+			if err := out.Write(&subnetRecord{
+				Type:             "sync",
+				Epoch:            epoch,
+				Subnet:           subnet,
+				Position:         &position,
+				ValidatorIndices: []common.ValidatorIndex{vi},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if selected != nil {
+		if err := out.Textf("--- subscriptions ---"); err != nil {
+			return err
+		}
+		for _, index := range indices {
+			for _, sub := range []struct {
+				typ     string
+				subnets []uint64
+			}{{"attestation_subscription", attnets[index]}, {"sync_subscription", syncnets[index]}} {
+				for _, subnet := range uniqueSubnets(sub.subnets) {
+					if err := out.Write(&subnetRecord{
+						Type:             sub.typ,
+						Epoch:            epoch,
+						Subnet:           subnet,
+						ValidatorIndices: []common.ValidatorIndex{index},
+					}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return out.Close()
+}
+
+// uniqueSubnets sorts the subnets and removes duplicates.
+func uniqueSubnets(subnets []uint64) []uint64 {
+	sort.Slice(subnets, func(i, j int) bool {
+		return subnets[i] < subnets[j]
+	})
+	out := make([]uint64, 0, len(subnets))
+	for i, subnet := range subnets {
+		if i == 0 || subnet != subnets[i-1] {
+			out = append(out, subnet)
+		}
+	}
+	return out
+}
+
+type subnetRecord struct {
+	// attestation or sync, or attestation_subscription or sync_subscription for the subnets a selected validator subscribes to
+	Type   string       `json:"type"`
+	Epoch  common.Epoch `json:"epoch"`
+	Subnet uint64       `json:"subnet,string"`
+	// attestation subnets
+	Slot           *common.Slot           `json:"slot,omitempty"`
+	CommitteeIndex *common.CommitteeIndex `json:"committee_index,omitempty"`
+	// sync subnets, the position of the member in the sync committee
+	Position *int `json:"position,string,omitempty"`
+	// committee members, or the sync-committee member, filtered by the selected validators, or the subscribing validator
+	ValidatorIndices []common.ValidatorIndex `json:"validator_indices"`
+}
+
+func (r *subnetRecord) String() string {
+	switch r.Type {
+	case "attestation":
+		return fmt.Sprintf("epoch: %7d    slot: %9d    committee index: %4d    attestation subnet: %2d    indices: %v",
+			r.Epoch, *r.Slot, *r.CommitteeIndex, r.Subnet, r.ValidatorIndices)
+	case "attestation_subscription":
+		return fmt.Sprintf("epoch: %7d    validator: %7d    subscribes to attestation subnet: %2d", r.Epoch, r.ValidatorIndices[0], r.Subnet)
+	case "sync_subscription":
+		return fmt.Sprintf("epoch: %7d    validator: %7d    subscribes to sync subnet: %d", r.Epoch, r.ValidatorIndices[0], r.Subnet)
+	}
+	return fmt.Sprintf("epoch: %7d    sync committee position: %4d    sync subnet: %d    index: %v",
+		r.Epoch, *r.Position, r.Subnet, r.ValidatorIndices[0])
+}
+
+type ValidatorCmd struct {
+	Phase               string
+	configs.SpecOptions `ask:"."`
+	MetaOutput          `ask:"."`
+	State               util.StateInput `ask:"<state>" help:"BeaconState, prefix with format, empty path for STDIN"`
+}
+
+func (c *ValidatorCmd) Help() string {
+	return fmt.Sprintf("Look up validators by index or 0x-prefixed pubkey, given as remaining arguments (phase %s)", c.Phase)
+}
+
+func (c *ValidatorCmd) Run(ctx context.Context, args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no validator indices or pubkeys specified")
+	}
+	spec, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	state, err := c.State.Read(spec, c.Phase)
+	if err != nil {
+		return err
+	}
+	epc, err := common.NewEpochsContext(spec, state)
+	if err != nil {
+		return fmt.Errorf("cannot compute state epochs context: %v", err)
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	count, err := vals.ValidatorCount()
+	if err != nil {
+		return err
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	indices := make([]common.ValidatorIndex, 0, len(args))
+	for _, arg := range args {
+		index, err := parseValidatorRef(epc, arg)
+		if err != nil {
+			return err
+		}
+		if uint64(index) >= count {
+			return fmt.Errorf("validator index %d out of range, the registry has %d validators", index, count)
+		}
+		indices = append(indices, index)
+	}
+	currentEpoch := epc.CurrentEpoch.Epoch
+	current, err := committeeAssignments(spec, epc, currentEpoch)
+	if err != nil {
+		return err
+	}
+	next, err := committeeAssignments(spec, epc, currentEpoch+1)
+	if err != nil {
+		return err
+	}
+	out := c.Writer()
+	for _, index := range indices {
+		val, err := vals.Validator(index)
+		if err != nil {
+			return err
+		}
+		var flat common.FlatValidator
+		if err := val.Flatten(&flat); err != nil {
+			return err
+		}
+		pubkey, err := val.Pubkey()
+		if err != nil {
+			return err
+		}
+		creds, err := val.WithdrawalCredentials()
+		if err != nil {
+			return err
+		}
+		balance, err := bals.GetBalance(index)
+		if err != nil {
+			return err
+		}
+		record := &validatorRecord{
+			Index:                      index,
+			Pubkey:                     pubkey,
+			WithdrawalCredentials:      creds,
+			WithdrawalCredentialsType:  withdrawalCredentialsType(creds),
+			EffectiveBalance:           flat.EffectiveBalance,
+			Slashed:                    flat.Slashed,
+			ActivationEligibilityEpoch: flat.ActivationEligibilityEpoch,
+			ActivationEpoch:            flat.ActivationEpoch,
+			ExitEpoch:                  flat.ExitEpoch,
+			WithdrawableEpoch:          flat.WithdrawableEpoch,
+			Balance:                    balance,
+			Status:                     validatorStatus(&flat, balance, currentEpoch),
+			Epoch:                      currentEpoch,
+		}
+		if a, ok := current[index]; ok {
+			record.CurrentEpochCommittee = &a
+		}
+		if a, ok := next[index]; ok {
+			record.NextEpochCommittee = &a
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+type validatorRecord struct {
+	Index                      common.ValidatorIndex `json:"index"`
+	Pubkey                     common.BLSPubkey      `json:"pubkey"`
+	WithdrawalCredentials      common.Root           `json:"withdrawal_credentials"`
+	WithdrawalCredentialsType  string                `json:"withdrawal_credentials_type"`
+	EffectiveBalance           common.Gwei           `json:"effective_balance"`
+	Slashed                    bool                  `json:"slashed"`
+	ActivationEligibilityEpoch common.Epoch          `json:"activation_eligibility_epoch"`
+	ActivationEpoch            common.Epoch          `json:"activation_epoch"`
+	ExitEpoch                  common.Epoch          `json:"exit_epoch"`
+	WithdrawableEpoch          common.Epoch          `json:"withdrawable_epoch"`
+	Balance                    common.Gwei           `json:"balance"`
+	Status                     string                `json:"status"`
+	// Epoch of the status, the current epoch of the state
+	Epoch common.Epoch `json:"epoch"`
+	// nil if the validator is not in a committee
+	CurrentEpochCommittee *committeeAssignment `json:"current_epoch_committee"`
+	NextEpochCommittee    *committeeAssignment `json:"next_epoch_committee"`
+}
+
+func (r *validatorRecord) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- validator %d ---\n", r.Index)
+	fmt.Fprintf(&buf, "pubkey:                        %s\n", r.Pubkey)
+	fmt.Fprintf(&buf, "withdrawal credentials:        %s (%s)\n", r.WithdrawalCredentials, r.WithdrawalCredentialsType)
+	fmt.Fprintf(&buf, "effective balance:             %d\n", r.EffectiveBalance)
+	fmt.Fprintf(&buf, "slashed:                       %v\n", r.Slashed)
+	fmt.Fprintf(&buf, "activation eligibility epoch:  %d\n", r.ActivationEligibilityEpoch)
+	fmt.Fprintf(&buf, "activation epoch:              %d\n", r.ActivationEpoch)
+	fmt.Fprintf(&buf, "exit epoch:                    %d\n", r.ExitEpoch)
+	fmt.Fprintf(&buf, "withdrawable epoch:            %d\n", r.WithdrawableEpoch)
+	fmt.Fprintf(&buf, "balance:                       %d\n", r.Balance)
+	fmt.Fprintf(&buf, "status:                        %s", r.Status)
+	for i, a := range []*committeeAssignment{r.CurrentEpochCommittee, r.NextEpochCommittee} {
+		if a != nil {
+			fmt.Fprintf(&buf, "\ncommittee in epoch %7d:    slot: %9d    committee index: %4d    position: %4d", a.Epoch, a.Slot, a.CommitteeIndex, a.Position)
+		} else {
+			fmt.Fprintf(&buf, "\ncommittee in epoch %7d:    none", r.Epoch+common.Epoch(i))
+		}
+	}
+	return buf.String()
+}
+
+// parseValidatorRef parses a validator index, or looks up the index of a 0x-prefixed pubkey.
+func parseValidatorRef(epc *common.EpochsContext, arg string) (common.ValidatorIndex, error) {
+	if strings.HasPrefix(arg, "0x") {
+		var pubkey common.BLSPubkey
+		if err := pubkey.UnmarshalText([]byte(arg)); err != nil {
+			return 0, fmt.Errorf("invalid pubkey %q: %v", arg, err)
+		}
+		index, ok := epc.ValidatorPubkeyCache.ValidatorIndex(pubkey)
+		if !ok {
+			return 0, fmt.Errorf("unknown validator pubkey %s", arg)
+		}
+		return index, nil
+	}
+	index, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid validator index %q: %v", arg, err)
+	}
+	return common.ValidatorIndex(index), nil
+}
+
+type committeeAssignment struct {
+	Epoch            common.Epoch          `json:"epoch"`
+	Slot             common.Slot           `json:"slot"`
+	CommitteeIndex   common.CommitteeIndex `json:"committee_index"`
+	CommitteesAtSlot uint64                `json:"committees_at_slot,string"`
+	CommitteeLength  int                   `json:"committee_length,string"`
+	Position         int                   `json:"position,string"`
+}
+
+// committeeAssignments maps the validators to their beacon committee in the epoch,
+// which must be the previous, current or next epoch of the epochs-context.
+func committeeAssignments(spec *common.Spec, epc *common.EpochsContext, epoch common.Epoch) (map[common.ValidatorIndex]committeeAssignment, error) {
+	committeesPerSlot, err := epc.GetCommitteeCountPerSlot(epoch)
+	if err != nil {
+		return nil, err
+	}
+	start, err := spec.EpochStartSlot(epoch)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[common.ValidatorIndex]committeeAssignment)
+	for slot := start; slot < start+spec.SLOTS_PER_EPOCH; slot++ {
+		for i := common.CommitteeIndex(0); i < common.CommitteeIndex(committeesPerSlot); i++ {
+			committee, err := epc.GetBeaconCommittee(slot, i)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get committee for slot %d committee index %d", slot, i)
+			}
+			for pos, vi := range committee {
+				out[vi] = committeeAssignment{
+					Epoch:            epoch,
+					Slot:             slot,
+					CommitteeIndex:   i,
+					CommitteesAtSlot: committeesPerSlot,
+					CommitteeLength:  len(committee),
+					Position:         pos,
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// validatorStatus computes the status of a validator at the epoch, as in the validator status enum of the beacon-API.
+func validatorStatus(v *common.FlatValidator, balance common.Gwei, epoch common.Epoch) string {
+	switch {
+	case v.ActivationEligibilityEpoch == common.FAR_FUTURE_EPOCH:
+		return "pending_initialized"
+	case epoch < v.ActivationEpoch:
+		return "pending_queued"
+	case epoch < v.ExitEpoch:
+		if v.ExitEpoch == common.FAR_FUTURE_EPOCH {
+			return "active_ongoing"
+		}
+		if v.Slashed {
+			return "active_slashed"
+		}
+		return "active_exiting"
+	case epoch < v.WithdrawableEpoch:
+		if v.Slashed {
+			return "exited_slashed"
+		}
+		return "exited_unslashed"
+	case balance != 0:
+		return "withdrawal_possible"
+	default:
+		return "withdrawal_done"
+	}
+}
+
+// withdrawalCredentialsType describes the withdrawal credentials by their prefix byte.
+func withdrawalCredentialsType(creds common.Root) string {
+	switch creds[0] {
+	case common.BLS_WITHDRAWAL_PREFIX:
+		return "0x00, BLS withdrawal key hash"
+	case common.ETH1_ADDRESS_WITHDRAWAL_PREFIX:
+		return fmt.Sprintf("0x01, execution address 0x%x", creds[12:])
+	case 0x02:
+		return fmt.Sprintf("0x02, compounding, execution address 0x%x", creds[12:])
+	default:
+		return fmt.Sprintf("0x%02x, unknown type", creds[0])
+	}
+}
+
+type ValidatorDiffCmd struct {
+	Phase               string
+	configs.SpecOptions `ask:"."`
+	MetaOutput          `ask:"."`
+	Top                 int             `ask:"--top" help:"Number of top balance gainers and losers to list"`
+	StateA              util.StateInput `ask:"<state-a>" help:"BeaconState A, prefix with format"`
+	StateB              util.StateInput `ask:"<state-b>" help:"BeaconState B, prefix with format"`
+}
+
+func (c *ValidatorDiffCmd) Default() {
+	c.Top = 10
+}
+
+func (c *ValidatorDiffCmd) Help() string {
+	return fmt.Sprintf("Summarise the validator registry changes from state A to state B (phase %s)", c.Phase)
+}
+
+// registrySnapshot is the validator registry data of a state, as compared by ValidatorDiffCmd.
+type registrySnapshot struct {
+	epoch      common.Epoch
+	validators []common.FlatValidator
+	// first byte of the withdrawal credentials of each validator
+	credPrefixes []byte
+	balances     []common.Gwei
+}
+
+func readRegistrySnapshot(spec *common.Spec, state common.BeaconState) (*registrySnapshot, error) {
+	slot, err := state.Slot()
+	if err != nil {
+		return nil, err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return nil, err
+	}
+	flats, err := common.FlattenValidators(vals)
+	if err != nil {
+		return nil, err
+	}
+	prefixes := make([]byte, 0, len(flats))
+	next := vals.Iter()
+	for {
+		v, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		creds, err := v.WithdrawalCredentials()
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, creds[0])
+	}
+	bals, err := state.Balances()
+	if err != nil {
+		return nil, err
+	}
+	balances, err := bals.AllBalances()
+	if err != nil {
+		return nil, err
+	}
+	return &registrySnapshot{epoch: spec.SlotToEpoch(slot), validators: flats, credPrefixes: prefixes, balances: balances}, nil
+}
+
+func (c *ValidatorDiffCmd) Run(ctx context.Context, args ...string) error {
+	spec, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	stateA, err := c.StateA.Read(spec, c.Phase)
+	if err != nil {
+		return fmt.Errorf("failed to read state A: %v", err)
+	}
+	stateB, err := c.StateB.Read(spec, c.Phase)
+	if err != nil {
+		return fmt.Errorf("failed to read state B: %v", err)
+	}
+	a, err := readRegistrySnapshot(spec, stateA)
+	if err != nil {
+		return fmt.Errorf("failed to read validator registry of state A: %v", err)
+	}
+	b, err := readRegistrySnapshot(spec, stateB)
+	if err != nil {
+		return fmt.Errorf("failed to read validator registry of state B: %v", err)
+	}
+	if len(b.validators) < len(a.validators) {
+		return fmt.Errorf("state B has fewer validators (%d) than state A (%d), the registry only grows", len(b.validators), len(a.validators))
+	}
+
+	out := c.Writer()
+	if err := out.Textf("epoch: %d -> %d    validators: %d -> %d", a.epoch, b.epoch, len(a.validators), len(b.validators)); err != nil {
+		return err
+	}
+	change := func(kind string, i int, from, to interface{}) error {
+		index := common.ValidatorIndex(i)
+		return out.Write(&registryChange{Change: kind, ValidatorIndex: &index, From: fmt.Sprint(from), To: fmt.Sprint(to)})
+	}
+
+	if err := out.Textf("--- new deposits: %d ---", len(b.validators)-len(a.validators)); err != nil {
+		return err
+	}
+	for i := len(a.validators); i < len(b.validators); i++ {
+		if err := change("deposit", i, "", b.validators[i].EffectiveBalance); err != nil {
+			return err
+		}
+	}
+
+	// new validators are included with a zero-value record in A, to detect their changes
+	before := func(i int) common.FlatValidator {
+		if i < len(a.validators) {
+			return a.validators[i]
+		}
+		return common.FlatValidator{
+			ActivationEligibilityEpoch: common.FAR_FUTURE_EPOCH,
+			ActivationEpoch:            common.FAR_FUTURE_EPOCH,
+			ExitEpoch:                  common.FAR_FUTURE_EPOCH,
+			WithdrawableEpoch:          common.FAR_FUTURE_EPOCH,
+		}
+	}
+	var activations, exits, slashings, credChanges, effBalChanges []int
+	for i := range b.validators {
+		va, vb := before(i), b.validators[i]
+		if va.ActivationEpoch == common.FAR_FUTURE_EPOCH && vb.ActivationEpoch != common.FAR_FUTURE_EPOCH {
+			activations = append(activations, i)
+		}
+		if va.ExitEpoch == common.FAR_FUTURE_EPOCH && vb.ExitEpoch != common.FAR_FUTURE_EPOCH {
+			exits = append(exits, i)
+		}
+		if !va.Slashed && vb.Slashed {
+			slashings = append(slashings, i)
+		}
+		if i < len(a.validators) && a.credPrefixes[i] != b.credPrefixes[i] {
+			credChanges = append(credChanges, i)
+		}
+		if i < len(a.validators) && va.EffectiveBalance != vb.EffectiveBalance {
+			effBalChanges = append(effBalChanges, i)
+		}
+	}
+	for _, section := range []struct {
+		title   string
+		kind    string
+		indices []int
+		values  func(i int) (from, to interface{})
+	}{
+		{"activations", "activation", activations, func(i int) (interface{}, interface{}) {
+			return before(i).ActivationEpoch, b.validators[i].ActivationEpoch
+		}},
+		{"exits initiated", "exit", exits, func(i int) (interface{}, interface{}) {
+			return before(i).ExitEpoch, b.validators[i].ExitEpoch
+		}},
+		{"slashings", "slashing", slashings, func(i int) (interface{}, interface{}) {
+			return before(i).WithdrawableEpoch, b.validators[i].WithdrawableEpoch
+		}},
+		{"withdrawal credential changes", "withdrawal_credentials", credChanges, func(i int) (interface{}, interface{}) {
+			return fmt.Sprintf("0x%02x", a.credPrefixes[i]), fmt.Sprintf("0x%02x", b.credPrefixes[i])
+		}},
+		{"effective balance changes", "effective_balance", effBalChanges, func(i int) (interface{}, interface{}) {
+			return a.validators[i].EffectiveBalance, b.validators[i].EffectiveBalance
+		}},
+	} {
+		if err := out.Textf("--- %s: %d ---", section.title, len(section.indices)); err != nil {
+			return err
+		}
+		for _, i := range section.indices {
+			from, to := section.values(i)
+			if err := change(section.kind, i, from, to); err != nil {
+				return err
+			}
+		}
+	}
+
+	var totalA, totalB common.Gwei
+	for _, bal := range a.balances {
+		totalA += bal
+	}
+	for _, bal := range b.balances {
+		totalB += bal
+	}
+	if err := out.Textf("--- balances ---"); err != nil {
+		return err
+	}
+	if err := out.Write(&registryChange{Change: "total_balance", From: fmt.Sprint(totalA), To: fmt.Sprint(totalB),
+		delta: int64(totalB) - int64(totalA)}); err != nil {
+		return err
+	}
+	// only the validators in both states are ranked, new deposits are not gains
+	deltas := make([]balanceDelta, len(a.balances))
+	for i := range a.balances {
+		deltas[i] = balanceDelta{index: i, delta: int64(b.balances[i]) - int64(a.balances[i])}
+	}
+	sort.SliceStable(deltas, func(i, j int) bool {
+		return deltas[i].delta > deltas[j].delta
+	})
+	balanceChange := func(kind string, d balanceDelta) error {
+		index := common.ValidatorIndex(d.index)
+		return out.Write(&registryChange{Change: kind, ValidatorIndex: &index,
+			From: fmt.Sprint(a.balances[d.index]), To: fmt.Sprint(b.balances[d.index]), delta: d.delta})
+	}
+	if err := out.Textf("--- top gainers ---"); err != nil {
+		return err
+	}
+	for i := 0; i < c.Top && i < len(deltas) && deltas[i].delta > 0; i++ {
+		if err := balanceChange("top_gainer", deltas[i]); err != nil {
+			return err
+		}
+	}
+	if err := out.Textf("--- top losers ---"); err != nil {
+		return err
+	}
+	for i := 0; i < c.Top && i < len(deltas) && deltas[len(deltas)-1-i].delta < 0; i++ {
+		if err := balanceChange("top_loser", deltas[len(deltas)-1-i]); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// registryChange is a change of a validator from state A to state B, or of the total balance.
+type registryChange struct {
+	// deposit, activation, exit, slashing, withdrawal_credentials, effective_balance, total_balance, top_gainer or top_loser
+	Change string `json:"change"`
+	// nil for the total balance
+	ValidatorIndex *common.ValidatorIndex `json:"validator_index"`
+	From           string                 `json:"from"`
+	To             string                 `json:"to"`
+	// balance delta, for the text output
+	delta int64
+}
+
+func (r *registryChange) String() string {
+	switch r.Change {
+	case "total_balance":
+		return fmt.Sprintf("total: %s -> %s Gwei (%+d)", r.From, r.To, r.delta)
+	case "deposit":
+		return fmt.Sprintf("validator %7d    effective balance: %s", *r.ValidatorIndex, r.To)
+	case "activation":
+		return fmt.Sprintf("validator %7d    activation epoch: %s", *r.ValidatorIndex, r.To)
+	case "exit":
+		return fmt.Sprintf("validator %7d    exit epoch: %s", *r.ValidatorIndex, r.To)
+	case "slashing":
+		return fmt.Sprintf("validator %7d    withdrawable epoch: %s -> %s", *r.ValidatorIndex, r.From, r.To)
+	case "top_gainer", "top_loser":
+		return fmt.Sprintf("validator %7d    %s -> %s Gwei (%+d)", *r.ValidatorIndex, r.From, r.To, r.delta)
+	default:
+		return fmt.Sprintf("validator %7d    %s -> %s", *r.ValidatorIndex, r.From, r.To)
+	}
+}
+
+type balanceDelta struct {
+	index int
+	delta int64
+}
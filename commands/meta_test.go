@@ -0,0 +1,633 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/ask"
+	blsu "github.com/protolambda/bls12-381-util"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+)
+
+// checkOutput checks that the output contains the lines, in order.
+func checkOutput(t *testing.T, out string, lines ...string) {
+	t.Helper()
+	rest := out
+	for _, line := range lines {
+		i := strings.Index(rest, line+"\n")
+		if i < 0 {
+			t.Fatalf("missing line %q after the previous lines, in output:\n%s", line, out)
+		}
+		rest = rest[i+len(line)+1:]
+	}
+}
+
+// readRecords decodes NDJSON output into a new record of the type of dest for each line, and appends them to dest.
+func readRecords[T any](t *testing.T, out string, dest *[]T) {
+	t.Helper()
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		var record T
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("failed to decode record %q: %v", line, err)
+		}
+		*dest = append(*dest, record)
+	}
+}
+
+// processedEpochsContext processes a copy of the state to the start of the epoch, and returns the epochs-context of it.
+func processedEpochsContext(t *testing.T, state common.BeaconState, epc *common.EpochsContext, epoch common.Epoch) *common.EpochsContext {
+	t.Helper()
+	spec := configs.Minimal
+	copied, err := state.CopyState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	epc = epc.Clone()
+	upgradeable := &upgradeableState{BeaconState: copied}
+	if err := common.ProcessSlots(context.Background(), spec, epc, upgradeable, common.Slot(epoch)*spec.SLOTS_PER_EPOCH); err != nil {
+		t.Fatal(err)
+	}
+	return epc
+}
+
+func TestCommittees(t *testing.T) {
+	spec := configs.Minimal
+	state, epc := genesisState(t, "phase0")
+	input := writeState(t, state)
+	later := processedEpochsContext(t, state, epc, 2)
+	cases := []struct {
+		name  string
+		args  []string
+		epc   *common.EpochsContext
+		slots []common.Slot
+	}{
+		// the previous epoch of the genesis epoch is the genesis epoch
+		{"current", nil, epc, []common.Slot{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+		{"slot", []string{"--slot=3"}, epc, []common.Slot{3}},
+		{"later epoch", []string{"--epoch=2"}, later, []common.Slot{16, 17, 18, 19, 20, 21, 22, 23}},
+		{"later slot", []string{"--slot=20"}, later, []common.Slot{20}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			args := minimalArgs(append(append([]string{"--format=ndjson"}, c.args...), input)...)
+			out, err := runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "committees"), args...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var records []committeeRecord
+			readRecords(t, out, &records)
+			// 64 validators in committees of 4 are split in 2 committees per slot
+			if len(records) != 2*len(c.slots) {
+				t.Fatalf("got %d committees, expected %d", len(records), 2*len(c.slots))
+			}
+			for i, r := range records {
+				slot, index := c.slots[i/2], common.CommitteeIndex(i%2)
+				committee, err := c.epc.GetBeaconCommittee(slot, index)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := committeeRecord{Epoch: spec.SlotToEpoch(slot), Slot: slot, CommitteeIndex: index, CommitteesPerSlot: 2, ValidatorIndices: committee}
+				if !reflect.DeepEqual(r, want) {
+					t.Fatalf("committee %d: got %+v, expected %+v", i, r, want)
+				}
+			}
+		})
+	}
+
+	if _, err := runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "committees"), minimalArgs("--epoch=1", "--slot=8", input)...); err == nil {
+		t.Fatal("expected error when selecting both an epoch and a slot")
+	}
+}
+
+func TestProposers(t *testing.T) {
+	spec := configs.Minimal
+	state, epc := genesisState(t, "phase0")
+	input := writeState(t, state)
+	epcs := []*common.EpochsContext{epc, processedEpochsContext(t, state, epc, 1), processedEpochsContext(t, state, epc, 2)}
+	slots := func(start, end common.Slot) (out []common.Slot) {
+		for slot := start; slot < end; slot++ {
+			out = append(out, slot)
+		}
+		return out
+	}
+	cases := []struct {
+		name  string
+		args  []string
+		slots []common.Slot
+	}{
+		{"current", nil, slots(0, 8)},
+		{"slot", []string{"--slot=3"}, slots(3, 4)},
+		{"later epoch", []string{"--epoch=2"}, slots(16, 24)},
+		{"epochs", []string{"--epochs=3"}, slots(0, 24)},
+	}
+	// the next epoch depends on effective balance updates, the epoch after also on RANDAO reveals
+	caveats := []string{"", proposerCaveatBalances, proposerCaveatRandao}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			args := minimalArgs(append(append([]string{"--format=ndjson"}, c.args...), input)...)
+			out, err := runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "proposers"), args...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var records []proposerRecord
+			readRecords(t, out, &records)
+			if len(records) != len(c.slots) {
+				t.Fatalf("got %d proposers, expected %d", len(records), len(c.slots))
+			}
+			for i, r := range records {
+				slot := c.slots[i]
+				epoch := spec.SlotToEpoch(slot)
+				proposer, err := epcs[epoch].GetBeaconProposer(slot)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := proposerRecord{Epoch: epoch, Slot: slot, ProposerIndex: proposer, Caveat: caveats[epoch]}
+				if r != want {
+					t.Fatalf("got proposer %+v, expected %+v", r, want)
+				}
+			}
+		})
+	}
+
+	out, err := runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "proposers"), minimalArgs("--epochs=2", input)...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	proposer, err := epcs[1].GetBeaconProposer(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOutput(t, out,
+		fmt.Sprintf("epoch:       1    slot:         8    proposer index: %4d *", proposer),
+		"(*) "+caveatDescriptions[proposerCaveatBalances],
+	)
+	if strings.Contains(out, "(**)") {
+		t.Fatalf("got RANDAO caveat in output of 2 epochs:\n%s", out)
+	}
+
+	for _, args := range [][]string{{"--epochs=0"}, {"--slot=3", "--epochs=2"}} {
+		if _, err := runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "proposers"), minimalArgs(append(args, input)...)...); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
+
+func TestDuties(t *testing.T) {
+	state, _ := genesisState(t, "altair")
+	input := writeState(t, state)
+	// the epochs-context of the upgrade has no sync committees
+	epc, err := common.NewEpochsContext(configs.Minimal, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposer, err := epc.GetBeaconProposer(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignments, err := committeeAssignments(configs.Minimal, epc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := assignments[proposer]
+	var syncPositions []int
+	for i, vi := range epc.CurrentSyncCommittee.Indices {
+		if vi == proposer {
+			syncPositions = append(syncPositions, i)
+		}
+	}
+	if len(syncPositions) == 0 {
+		t.Fatalf("proposer %d is not in the sync committee", proposer)
+	}
+
+	out, err := runCmd(t, routeCmd(t, &MetaCmd{}, "altair", "duties"),
+		minimalArgs("--format=ndjson", input, fmt.Sprint(proposer), fmt.Sprint(proposer))...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var records []dutyRecord
+	readRecords(t, out, &records)
+	var duties []string
+	for _, r := range records {
+		if r.ValidatorIndex != proposer || r.Epoch != 0 {
+			t.Fatalf("got duty of validator %d in epoch %d, expected validator %d in epoch 0", r.ValidatorIndex, r.Epoch, proposer)
+		}
+		switch r.Duty {
+		case "attester":
+			if *r.Slot != a.Slot || *r.CommitteeIndex != a.CommitteeIndex || *r.ValidatorCommitteeIndex != a.Position ||
+				*r.CommitteeLength != a.CommitteeLength || *r.CommitteesAtSlot != 2 {
+				t.Fatalf("got attester duty %+v, expected %+v", r, a)
+			}
+		case "proposer":
+			if *r.Slot != 3 {
+				t.Fatalf("got proposer duty at slot %d, expected slot 3", *r.Slot)
+			}
+		case "sync":
+			if !reflect.DeepEqual(r.ValidatorSyncCommitteeIndices, syncPositions) {
+				t.Fatalf("got sync committee positions %v, expected %v", r.ValidatorSyncCommitteeIndices, syncPositions)
+			}
+		}
+		duties = append(duties, r.Duty)
+	}
+	// the attester duty is listed first, and the duplicate validator is listed once
+	if len(duties) < 3 || duties[0] != "attester" || duties[len(duties)-1] != "sync" {
+		t.Fatalf("got duties %v, expected attester, proposer(s) and sync", duties)
+	}
+
+	// other slots only have the sync duty
+	out, err = runCmd(t, routeCmd(t, &MetaCmd{}, "altair", "duties"),
+		minimalArgs("--format=ndjson", fmt.Sprintf("--slot=%d", (a.Slot+1)%8), input, fmt.Sprint(proposer))...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records = nil
+	readRecords(t, out, &records)
+	for _, r := range records {
+		if r.Duty == "attester" {
+			t.Fatalf("got attester duty at slot %d, outside the selected slot", *r.Slot)
+		}
+	}
+
+	// the proposers of later epochs may still change
+	later := processedEpochsContext(t, state, epc, 1)
+	laterProposer, err := later.GetBeaconProposer(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = runCmd(t, routeCmd(t, &MetaCmd{}, "altair", "duties"), minimalArgs("--format=ndjson", "--slot=8", input, fmt.Sprint(laterProposer))...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records = nil
+	readRecords(t, out, &records)
+	var proposerDuties int
+	for _, r := range records {
+		switch r.Duty {
+		case "proposer":
+			if *r.Slot != 8 || r.Caveat != proposerCaveatBalances {
+				t.Fatalf("got proposer duty at slot %d with caveat %q, expected slot 8 with caveat %q", *r.Slot, r.Caveat, proposerCaveatBalances)
+			}
+			proposerDuties++
+		case "sync":
+			// the sync duties of a selected slot are of that slot
+			if r.Slot == nil || *r.Slot != 8 {
+				t.Fatalf("got sync duty %+v, expected it at slot 8", r)
+			}
+		}
+	}
+	if proposerDuties != 1 {
+		t.Fatalf("got %d proposer duties, expected 1", proposerDuties)
+	}
+
+	if _, err := runCmd(t, routeCmd(t, &MetaCmd{}, "altair", "duties"), minimalArgs(input, "64")...); err == nil ||
+		!strings.Contains(err.Error(), "unknown validator index 64") {
+		t.Fatalf("got error %v, expected unknown validator", err)
+	}
+}
+
+func TestSyncCommitteeAtSlot(t *testing.T) {
+	spec := configs.Minimal
+	epc := &common.EpochsContext{CurrentSyncCommittee: &common.IndexedSyncCommittee{}, NextSyncCommittee: &common.IndexedSyncCommittee{}}
+	// a period of the minimal preset is 8 epochs of 8 slots
+	for _, c := range []struct {
+		slot common.Slot
+		next bool
+	}{{0, false}, {62, false}, {63, true}, {64, false}, {127, true}} {
+		if got := syncCommitteeAtSlot(spec, epc, c.slot); (got == epc.NextSyncCommittee) != c.next {
+			t.Fatalf("slot %d: got next sync committee: %v, expected %v", c.slot, got == epc.NextSyncCommittee, c.next)
+		}
+	}
+}
+
+func TestValidatorDiff(t *testing.T) {
+	spec := configs.Minimal
+	a, _ := genesisState(t, "phase0")
+	b, _ := genesisState(t, "phase0")
+	check := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(b.SetSlot(2 * spec.SLOTS_PER_EPOCH))
+	vals, err := b.Validators()
+	check(err)
+	validator := func(i common.ValidatorIndex) common.Validator {
+		v, err := vals.Validator(i)
+		check(err)
+		return v
+	}
+	slashed := validator(3)
+	check(slashed.MakeSlashed())
+	check(slashed.SetExitEpoch(5))
+	check(slashed.SetWithdrawableEpoch(10))
+	check(validator(7).SetWithdrawalCredentials(common.Root{0x01}))
+	check(validator(8).SetEffectiveBalance(spec.MAX_EFFECTIVE_BALANCE - spec.EFFECTIVE_BALANCE_INCREMENT))
+	bals, err := b.Balances()
+	check(err)
+	check(bals.SetBalance(5, spec.MAX_EFFECTIVE_BALANCE+1000))
+	check(bals.SetBalance(6, spec.MAX_EFFECTIVE_BALANCE-2000))
+	check(b.AddValidator(spec, common.BLSPubkey{0xaa}, common.Root{}, spec.MAX_EFFECTIVE_BALANCE))
+
+	inputA, inputB := writeState(t, a), writeState(t, b)
+	out, err := runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "validator-diff"), minimalArgs("--top=1", inputA, inputB)...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkOutput(t, out,
+		"epoch: 0 -> 2    validators: 64 -> 65",
+		"--- new deposits: 1 ---",
+		"validator      64    effective balance: 32000000000",
+		"--- activations: 0 ---",
+		"--- exits initiated: 1 ---",
+		"validator       3    exit epoch: 5",
+		"--- slashings: 1 ---",
+		"validator       3    withdrawable epoch: 18446744073709551615 -> 10",
+		"--- withdrawal credential changes: 1 ---",
+		"validator       7    0x00 -> 0x01",
+		"--- effective balance changes: 1 ---",
+		"validator       8    32000000000 -> 31000000000",
+		"--- balances ---",
+		"total: 2048000000000 -> 2079999999000 Gwei (+31999999000)",
+		"--- top gainers ---",
+		"validator       5    32000000000 -> 32000001000 Gwei (+1000)",
+		"--- top losers ---",
+		"validator       6    32000000000 -> 31999998000 Gwei (-2000)",
+	)
+
+	out, err = runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "validator-diff"), minimalArgs("--format=ndjson", "--top=1", inputA, inputB)...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkOutput(t, out,
+		`{"change":"deposit","validator_index":"64","from":"","to":"32000000000"}`,
+		`{"change":"exit","validator_index":"3","from":"18446744073709551615","to":"5"}`,
+		`{"change":"total_balance","validator_index":null,"from":"2048000000000","to":"2079999999000"}`,
+		`{"change":"top_loser","validator_index":"6","from":"32000000000","to":"31999998000"}`,
+	)
+
+	// the registry cannot shrink
+	if _, err := runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "validator-diff"), minimalArgs(inputB, inputA)...); err == nil || !strings.Contains(err.Error(), "fewer validators") {
+		t.Fatalf("got error %v, expected fewer validators in state B", err)
+	}
+}
+
+func TestValidatorStatus(t *testing.T) {
+	far := common.FAR_FUTURE_EPOCH
+	cases := []struct {
+		name    string
+		v       common.FlatValidator
+		balance common.Gwei
+		want    string
+	}{
+		{"deposited", common.FlatValidator{ActivationEligibilityEpoch: far, ActivationEpoch: far, ExitEpoch: far, WithdrawableEpoch: far},
+			32, "pending_initialized"},
+		{"queued", common.FlatValidator{ActivationEligibilityEpoch: 3, ActivationEpoch: 11, ExitEpoch: far, WithdrawableEpoch: far},
+			32, "pending_queued"},
+		{"active", common.FlatValidator{ActivationEpoch: 10, ExitEpoch: far, WithdrawableEpoch: far}, 32, "active_ongoing"},
+		{"exiting", common.FlatValidator{ActivationEpoch: 0, ExitEpoch: 11, WithdrawableEpoch: 20}, 32, "active_exiting"},
+		{"slashed", common.FlatValidator{Slashed: true, ExitEpoch: 11, WithdrawableEpoch: 20}, 32, "active_slashed"},
+		{"exited", common.FlatValidator{ExitEpoch: 10, WithdrawableEpoch: 20}, 32, "exited_unslashed"},
+		{"exited slashed", common.FlatValidator{Slashed: true, ExitEpoch: 10, WithdrawableEpoch: 20}, 32, "exited_slashed"},
+		{"withdrawable", common.FlatValidator{ExitEpoch: 5, WithdrawableEpoch: 10}, 32, "withdrawal_possible"},
+		{"withdrawn", common.FlatValidator{ExitEpoch: 5, WithdrawableEpoch: 10}, 0, "withdrawal_done"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := validatorStatus(&c.v, c.balance, 10); got != c.want {
+				t.Fatalf("got status %s, expected %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidatorLookup(t *testing.T) {
+	state, epc := genesisState(t, "phase0")
+	input := writeState(t, state)
+	pub, err := blsu.SkToPk(testKeys(t)[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkey := common.BLSPubkey(pub.Serialize())
+	committee := func(epoch common.Epoch) string {
+		assignments, err := committeeAssignments(configs.Minimal, epc, epoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, ok := assignments[5]
+		if !ok {
+			t.Fatalf("validator 5 has no committee in epoch %d", epoch)
+		}
+		committee, err := epc.GetBeaconCommittee(a.Slot, a.CommitteeIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if committee[a.Position] != 5 {
+			t.Fatalf("validator 5 is not at position %d of committee %d at slot %d", a.Position, a.CommitteeIndex, a.Slot)
+		}
+		return fmt.Sprintf("committee in epoch %7d:    slot: %9d    committee index: %4d    position: %4d", epoch, a.Slot, a.CommitteeIndex, a.Position)
+	}
+	for _, ref := range []string{"5", pubkey.String()} {
+		t.Run(ref, func(t *testing.T) {
+			out, err := runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "validator"), minimalArgs(input, ref)...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkOutput(t, out,
+				"--- validator 5 ---",
+				"pubkey:                        "+pubkey.String(),
+				"effective balance:             32000000000",
+				"status:                        active_ongoing",
+				committee(0),
+				committee(1),
+			)
+		})
+	}
+
+	for _, c := range []struct{ ref, err string }{
+		{"64", "out of range"},
+		{"x", "invalid validator index"},
+		{"0x1234", "invalid pubkey"},
+		{common.BLSPubkey{0xaa}.String(), "unknown validator pubkey"},
+	} {
+		if _, err := runCmd(t, routeCmd(t, &MetaCmd{}, "phase0", "validator"), minimalArgs(input, c.ref)...); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("got error %v for %q, expected %q", err, c.ref, c.err)
+		}
+	}
+}
+
+func TestSyncCommittees(t *testing.T) {
+	spec := configs.Minimal
+	for _, phase := range genesisPhases[1:] {
+		t.Run(phase, func(t *testing.T) {
+			state, _ := genesisState(t, phase)
+			input := writeState(t, state)
+			epc, err := common.NewEpochsContext(spec, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			committees := []*common.IndexedSyncCommittee{epc.CurrentSyncCommittee, epc.NextSyncCommittee}
+			syncState := state.(common.SyncCommitteeBeaconState)
+			current, err := syncState.CurrentSyncCommittee()
+			if err != nil {
+				t.Fatal(err)
+			}
+			next, err := syncState.NextSyncCommittee()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var aggregates [2]common.BLSPubkey
+			for i, v := range []*common.SyncCommitteeView{current, next} {
+				if aggregates[i], err = v.AggregatePubkey(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			member := epc.CurrentSyncCommittee.Indices[9]
+			for _, args := range [][]string{nil, {fmt.Sprint(member)}} {
+				out, err := runCmd(t, routeCmd(t, &MetaCmd{}, phase, "sync-committees"),
+					minimalArgs(append([]string{"--format=ndjson", input}, args...)...)...)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				var records []syncCommitteeRecord
+				readRecords(t, out, &records)
+				var want []syncCommitteeRecord
+				for period, name := range []string{"current", "next"} {
+					for i, vi := range committees[period].Indices {
+						if args != nil && vi != member {
+							continue
+						}
+						// the 32 members are split in 4 subcommittees
+						want = append(want, syncCommitteeRecord{SyncCommittee: name, Period: uint64(period),
+							AggregatePubkey: aggregates[period], AggregatePubkeyMatches: true, Position: i,
+							SubcommitteeIndex: uint64(i / 8), ValidatorIndex: vi, Pubkey: committees[period].CachedPubkeys[i].Compressed})
+					}
+				}
+				if !reflect.DeepEqual(records, want) {
+					t.Fatalf("got sync committee members %+v, expected %+v", records, want)
+				}
+			}
+			out, err := runCmd(t, routeCmd(t, &MetaCmd{}, phase, "sync-committees"), minimalArgs(input)...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkOutput(t, out, "--- current sync committee (period 0) ---", "--- next sync committee (period 1) ---")
+			if strings.Count(out, "(matches the members)") != 2 {
+				t.Fatalf("expected the aggregate pubkeys to match, got output:\n%s", out)
+			}
+
+			// a wrong aggregate pubkey is reported
+			pubkeys, err := next.Pubkeys()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sc := common.SyncCommittee{AggregatePubkey: common.BLSPubkey{0xc0}}
+			if sc.Pubkeys, err = pubkeys.Flatten(); err != nil {
+				t.Fatal(err)
+			}
+			wrong, err := sc.View(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := syncState.SetNextSyncCommittee(wrong); err != nil {
+				t.Fatal(err)
+			}
+			out, err = runCmd(t, routeCmd(t, &MetaCmd{}, phase, "sync-committees"), minimalArgs("--format=ndjson", writeState(t, state), fmt.Sprint(member))...)
+			if err == nil || !strings.Contains(err.Error(), "aggregate pubkey of the next sync committee does not match") {
+				t.Fatalf("got error %v, expected aggregate pubkey mismatch", err)
+			}
+			var records []syncCommitteeRecord
+			readRecords(t, out, &records)
+			for _, r := range records {
+				if r.AggregatePubkeyMatches != (r.SyncCommittee == "current") {
+					t.Fatalf("got aggregate pubkey match %v for the %s sync committee", r.AggregatePubkeyMatches, r.SyncCommittee)
+				}
+			}
+			if len(records) == 0 || records[len(records)-1].AggregatePubkey != sc.AggregatePubkey {
+				t.Fatalf("got records %+v, expected the wrong aggregate pubkey of the next sync committee", records)
+			}
+		})
+	}
+
+	if _, err := (&MetaPhaseCmd{Phase: "phase0"}).Cmd("sync-committees"); err != ask.UnrecognizedErr {
+		t.Fatalf("got %v, expected phase0 sync committees to be unrecognized", err)
+	}
+}
+
+func TestSubnets(t *testing.T) {
+	state, _ := genesisState(t, "altair")
+	input := writeState(t, state)
+	epc, err := common.NewEpochsContext(configs.Minimal, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := runCmd(t, routeCmd(t, &MetaCmd{}, "altair", "subnets"), minimalArgs("--format=ndjson", input)...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var records []subnetRecord
+	readRecords(t, out, &records)
+	// 8 slots with 2 committees each, and 32 sync-committee members
+	if len(records) != 16+32 {
+		t.Fatalf("got %d subnet records, expected %d", len(records), 16+32)
+	}
+	for i, r := range records[:16] {
+		slot, index := common.Slot(i/2), common.CommitteeIndex(i%2)
+		committee, err := epc.GetBeaconCommittee(slot, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// compute_subnet_for_attestation: the committees since the start of the epoch, modulo ATTESTATION_SUBNET_COUNT
+		subnet := uint64(i) % 64
+		if r.Type != "attestation" || *r.Slot != slot || *r.CommitteeIndex != index || r.Subnet != subnet ||
+			!reflect.DeepEqual(r.ValidatorIndices, committee) {
+			t.Fatalf("attestation subnet record %d: got %+v, expected subnet %d of committee %d at slot %d", i, r, subnet, index, slot)
+		}
+	}
+	for i, r := range records[16:] {
+		// the 32 members are split in 4 subcommittees, one per sync subnet
+		subnet := uint64(i / 8)
+		if r.Type != "sync" || *r.Position != i || r.Subnet != subnet ||
+			!reflect.DeepEqual(r.ValidatorIndices, []common.ValidatorIndex{epc.CurrentSyncCommittee.Indices[i]}) {
+			t.Fatalf("sync subnet record %d: got %+v, expected subnet %d of position %d", i, r, subnet, i)
+		}
+	}
+
+	// the subscriptions of a validator
+	member := epc.CurrentSyncCommittee.Indices[9]
+	assignments, err := committeeAssignments(configs.Minimal, epc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := assignments[member]
+	var syncnets []uint64
+	for i, vi := range epc.CurrentSyncCommittee.Indices {
+		if vi == member && (len(syncnets) == 0 || syncnets[len(syncnets)-1] != uint64(i/8)) {
+			syncnets = append(syncnets, uint64(i/8))
+		}
+	}
+	out, err = runCmd(t, routeCmd(t, &MetaCmd{}, "altair", "subnets"), minimalArgs(input, fmt.Sprint(member))...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := []string{"--- attestation subnets ---", "--- sync subnets (period 0) ---", "--- subscriptions ---",
+		fmt.Sprintf("epoch:       0    validator: %7d    subscribes to attestation subnet: %2d", member, 2*uint64(a.Slot)+uint64(a.CommitteeIndex))}
+	for _, subnet := range syncnets {
+		lines = append(lines, fmt.Sprintf("epoch:       0    validator: %7d    subscribes to sync subnet: %d", member, subnet))
+	}
+	checkOutput(t, out, lines...)
+
+	// the last slot of a sync committee period is signed by the next sync committee
+	out, err = runCmd(t, routeCmd(t, &MetaCmd{}, "altair", "subnets"), minimalArgs("--slot=63", input, fmt.Sprint(member))...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkOutput(t, out, "--- sync subnets (period 1) ---")
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/protolambda/zcli/spec_types"
+	"github.com/protolambda/zcli/util"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+// phaseRoutes lists the phases, followed by the "auto" phase.
+func phaseRoutes() []string {
+	return append(append([]string{}, spec_types.Phases...), util.AutoPhase)
+}
+
+// phaseTypes returns the spec types of the phase.
+// The "auto" phase only has the types that the phase can be detected of, these are resolved with resolveType.
+func phaseTypes(phase string) (map[string]spec_types.SpecType, error) {
+	if phase == util.AutoPhase {
+		out := make(map[string]spec_types.SpecType, len(util.AutoTypeNames))
+		for _, name := range util.AutoTypeNames {
+			out[name] = spec_types.SpecType{}
+		}
+		return out, nil
+	}
+	types, ok := spec_types.TypesByPhase[phase]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized phase: %s", phase)
+	}
+	return types, nil
+}
+
+// resolveType detects the phase of the input if the phase is "auto", and returns the phase and type to decode the input with.
+func resolveType(spec *common.Spec, phase string, typeName string, typ spec_types.SpecType, input *util.ObjInput) (string, spec_types.SpecType, error) {
+	if phase != util.AutoPhase {
+		return phase, typ, nil
+	}
+	phase, err := input.DetectPhase(spec, typeName)
+	if err != nil {
+		return "", spec_types.SpecType{}, err
+	}
+	typ, ok := spec_types.TypesByPhase[phase][typeName]
+	if !ok {
+		return "", spec_types.SpecType{}, fmt.Errorf("detected phase %s has no type %s", phase, typeName)
+	}
+	return phase, typ, nil
+}
+
+// statePhase resolves the "auto" phase to the phase of the state.
+func statePhase(phase string, state common.BeaconState) (string, error) {
+	if phase != util.AutoPhase {
+		return phase, nil
+	}
+	return util.StatePhase(state)
+}
+
+// readSpecObj reads the input into a new object of the type.
+// If a BeaconState does not decode, it is checked against the known presets, and read again if another preset matches.
+func readSpecObj(spec *common.Spec, phase string, typeName string, typ spec_types.SpecType, input *util.ObjInput) (common.SSZObj, error) {
+	obj := typ.Alloc(spec)
+	err := input.Read(obj)
+	if err != nil && typeName == "BeaconState" {
+		if changed, perr := input.CheckStatePreset(spec, phase); perr != nil {
+			return nil, perr
+		} else if changed {
+			obj = typ.Alloc(spec)
+			err = input.Read(obj)
+		}
+	}
+	return obj, err
+}
@@ -15,15 +15,15 @@ func (c *PrettyCmd) Help() string {
 }
 
 func (c *PrettyCmd) Cmd(route string) (cmd interface{}, err error) {
-	phaseTypes, ok := spec_types.TypesByPhase[route]
-	if !ok {
-		return nil, fmt.Errorf("unrecognized phase: %s", route)
+	phaseTypes, err := phaseTypes(route)
+	if err != nil {
+		return nil, err
 	}
 	return &PrettyPhaseCmd{PhaseName: route, Types: phaseTypes}, nil
 }
 
 func (c *PrettyCmd) Routes() []string {
-	return spec_types.Phases
+	return phaseRoutes()
 }
 
 type PrettyPhaseCmd struct {
@@ -50,6 +50,7 @@ type PrettyObjCmd struct {
 	configs.SpecOptions `ask:"."`
 	Input               util.ObjInput `ask:"<input>" help:"Input path, prefix with format, empty path for STDIN"`
 	Output              string        `ask:"[output]" help:"Output path, empty path for STDOUT"`
+	Path                util.PathFlag `ask:"--path" help:"Path to a sub-object, e.g. 'validators/1234/pubkey', to print"`
 }
 
 func (c *PrettyObjCmd) Run(ctx context.Context, args ...string) error {
@@ -57,11 +58,29 @@ func (c *PrettyObjCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	obj := c.Type.Alloc(spec)
-	if err := c.Input.Read(obj); err != nil {
+	c.PhaseName, c.Type, err = resolveType(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
+		return err
+	}
+	obj, err := readSpecObj(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
 		return fmt.Errorf("failed to read input: %v", err)
 	}
 	out := util.ObjOutput("pretty:" + c.Output)
+	if len(c.Path) > 0 {
+		v, err := util.TreeView(obj, c.Type.TypeDef(spec))
+		if err != nil {
+			return err
+		}
+		sub, err := c.Path.Select(v)
+		if err != nil {
+			return err
+		}
+		if err := out.Write(util.ViewJSON{View: sub}); err != nil {
+			return fmt.Errorf("failed to write output: %v", err)
+		}
+		return nil
+	}
 	if err := out.Write(obj); err != nil {
 		return fmt.Errorf("failed to write output: %v", err)
 	}
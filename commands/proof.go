@@ -1,34 +1,33 @@
 package commands
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"github.com/protolambda/zcli/spec_types"
 	"github.com/protolambda/zcli/util"
 	"github.com/protolambda/zrnt/eth2/configs"
-	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
-	"github.com/protolambda/ztyp/view"
-	"sort"
 )
 
 type ProofCmd struct{}
 
 func (c *ProofCmd) Help() string {
-	return "Create SSZ merkle proofs over any spec object"
+	return "Create and verify SSZ merkle proofs over any spec object"
 }
 
 func (c *ProofCmd) Cmd(route string) (cmd interface{}, err error) {
-	phaseTypes, ok := spec_types.TypesByPhase[route]
-	if !ok {
-		return nil, fmt.Errorf("unrecognized phase: %s", route)
+	if route == "verify" {
+		return &ProofVerifyCmd{}, nil
+	}
+	phaseTypes, err := phaseTypes(route)
+	if err != nil {
+		return nil, err
 	}
 	return &ProofPhaseCmd{PhaseName: route, Types: phaseTypes}, nil
 }
 
 func (c *ProofCmd) Routes() []string {
-	return spec_types.Phases
+	return append([]string{"verify"}, phaseRoutes()...)
 }
 
 type ProofPhaseCmd struct {
@@ -58,8 +57,12 @@ type ProofObjCmd struct {
 	Type                spec_types.SpecType
 	configs.SpecOptions `ask:"."`
 	Input               util.ObjInput     `ask:"<input>" help:"Input, prefix with format, empty path for STDIN"`
-	Gindices            util.GindicesFlag `ask:"--gindices" help:"Gindices of leaf values to put in multi-proof"`
-	// TODO: path
+	Gindices            util.GindicesFlag `ask:"--gindices" help:"Gindices or paths of leaf values to put in multi-proof"`
+	Path                util.PathFlag     `ask:"--path" help:"Path to a sub-object, e.g. 'validators/1234', to prove against instead of the full object"`
+	Out                 util.ObjOutput    `ask:"--out" help:"Output the proof as JSON, YAML or SSZ instead of text, prefix with format, empty path for STDOUT"`
+	OutChanged          bool              `changed:"out"`
+	Branch              bool              `ask:"--branch" help:"Output a single leaf proof as branch, ordered from the bottom up, like light-client branch fields"`
+	Compact             bool              `ask:"--compact" help:"Output the proof in compact multi-proof encoding, with descriptor bits and nodes"`
 }
 
 func (c *ProofObjCmd) Help() string {
@@ -71,75 +74,94 @@ func (c *ProofObjCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	objA := c.Type.Alloc(spec)
-	if err := c.Input.Read(objA); err != nil {
+	c.PhaseName, c.Type, err = resolveType(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
+		return err
+	}
+	objA, err := readSpecObj(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
 		return fmt.Errorf("failed to read input: %v", err)
 	}
 
-	var v view.View
-	// Hack to convert flat-structure input to tree-structure
-	{
-		var buf bytes.Buffer
-		if err := objA.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
-			return err
+	// convert flat-structure input to tree-structure
+	v, err := util.TreeView(objA, c.Type.TypeDef(spec))
+	if err != nil {
+		return err
+	}
+	v, err = c.Path.Select(v)
+	if err != nil {
+		return err
+	}
+
+	gindices, err := c.Gindices.Resolve(v.Type())
+	if err != nil {
+		return err
+	}
+
+	leavesSorted := util.SortGindices(gindices)
+	witnessSorted := util.HelperIndices(leavesSorted)
+
+	node := v.Backing()
+	hFn := tree.GetHashFn()
+	root := node.MerkleRoot(hFn)
+
+	if c.Branch {
+		if !c.OutChanged {
+			c.Out = "pretty:"
 		}
-		data := buf.Bytes()
-		dec := codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))
-		treeType := c.Type.TypeDef(spec)
-		v, err = treeType.Deserialize(dec)
-		if err != nil {
+		if len(leavesSorted) != 1 {
+			return fmt.Errorf("branch output requires exactly 1 leaf, got %d", len(leavesSorted))
+		}
+		leaf := leavesSorted[0]
+		proof := util.SingleProof{Root: root, LeafIndex: leaf}
+		if proof.Leaf, err = nodeRoot(node, leaf, hFn); err != nil {
 			return err
 		}
+		for _, g := range util.BranchGindices(leaf) {
+			r, err := nodeRoot(node, g, hFn)
+			if err != nil {
+				return err
+			}
+			proof.Branch = append(proof.Branch, r)
+		}
+		return c.Out.Write(&proof)
 	}
 
-	// deduplicate
-	leaves := make(map[tree.Gindex64]struct{})
-	for _, g := range c.Gindices {
-		leaves[g] = struct{}{}
-	}
-	leavesSorted := make([]tree.Gindex64, 0, len(leaves))
-	for g := range leaves {
-		leavesSorted = append(leavesSorted, g)
+	if c.Compact {
+		if !c.OutChanged {
+			c.Out = "pretty:"
+		}
+		descriptor, included := util.CompactDescriptor(leavesSorted)
+		proof := util.CompactProof{Root: root, Descriptor: descriptor}
+		for _, g := range included {
+			r, err := nodeRoot(node, g, hFn)
+			if err != nil {
+				return err
+			}
+			proof.Nodes = append(proof.Nodes, r)
+		}
+		return c.Out.Write(&proof)
 	}
-	sort.Slice(leavesSorted, func(i, j int) bool {
-		return leavesSorted[i] < leavesSorted[j]
-	})
 
-	// mark every gindex that is between the root and the leaves
-	interest := make(map[tree.Gindex64]struct{})
-	for _, g := range leavesSorted {
-		iter, _ := g.BitIter()
-		n := tree.Gindex64(1)
-		for {
-			right, ok := iter.Next()
-			if !ok {
-				break
-			}
-			n *= 2
-			if right {
-				n += 1
+	if c.OutChanged {
+		proof := util.MultiProof{Root: root, Gindices: leavesSorted, WitnessGindices: witnessSorted}
+		for _, g := range leavesSorted {
+			r, err := nodeRoot(node, g, hFn)
+			if err != nil {
+				return err
 			}
-			interest[n] = struct{}{}
+			proof.Leaves = append(proof.Leaves, r)
 		}
-	}
-	witness := make(map[tree.Gindex64]struct{})
-	// for every gindex that is covered, check if the sibling is covered, and if not, it's a witness
-	for g := range interest {
-		if _, ok := interest[g^1]; !ok {
-			witness[g^1] = struct{}{}
+		for _, g := range witnessSorted {
+			r, err := nodeRoot(node, g, hFn)
+			if err != nil {
+				return err
+			}
+			proof.Witness = append(proof.Witness, r)
 		}
+		return c.Out.Write(&proof)
 	}
-	witnessSorted := make([]tree.Gindex64, 0, len(witness))
-	for g := range witness {
-		witnessSorted = append(witnessSorted, g)
-	}
-	sort.Slice(witnessSorted, func(i, j int) bool {
-		return witnessSorted[i] < witnessSorted[j]
-	})
 
-	node := v.Backing()
-	hFn := tree.GetHashFn()
-	root := node.MerkleRoot(hFn)
 	fmt.Printf("root %6b: %s\n", 1, root)
 
 	for _, g := range leavesSorted {
@@ -161,3 +183,79 @@ func (c *ProofObjCmd) Run(ctx context.Context, args ...string) error {
 
 	return nil
 }
+
+func nodeRoot(node tree.Node, g tree.Gindex64, hFn tree.HashFn) (tree.Root, error) {
+	n, err := node.Getter(g)
+	if err != nil {
+		return tree.Root{}, fmt.Errorf("node %d is not available: %v", g, err)
+	}
+	return n.MerkleRoot(hFn), nil
+}
+
+type ProofVerifyCmd struct {
+	Root        tree.Root      `ask:"--root" help:"Expected root of the proof, required"`
+	RootChanged bool           `changed:"root"`
+	Leaves      util.NodesFlag `ask:"--leaves" help:"Leaf nodes to verify, as 'gindex:root' pairs"`
+	Witness     util.NodesFlag `ask:"--witness" help:"Witness nodes of the proof, as 'gindex:root' pairs"`
+	Proof       util.ObjInput  `ask:"--proof" help:"Multi-proof, as output by the proof command with --out, prefix with format. Replaces the leaves and witness flags, the root of it is not trusted"`
+	Compact     bool           `ask:"--compact" help:"Read the proof in compact multi-proof encoding. Leaves, if any, are checked to be included in the proof"`
+}
+
+func (c *ProofVerifyCmd) Help() string {
+	return "Verify a SSZ merkle multi-proof against a root"
+}
+
+func (c *ProofVerifyCmd) Run(ctx context.Context, args ...string) error {
+	// the root in the proof is not trusted, the proof must be checked against a known root
+	if !c.RootChanged {
+		return fmt.Errorf("no root specified")
+	}
+	if c.Compact {
+		if c.Proof == "" {
+			return fmt.Errorf("compact proof verification requires a proof input")
+		}
+		var proof util.CompactProof
+		if err := c.Proof.Read(&proof); err != nil {
+			return fmt.Errorf("failed to read proof: %v", err)
+		}
+		root, nodes, err := proof.Merkleize()
+		if err != nil {
+			return fmt.Errorf("invalid proof: %v", err)
+		}
+		if root != c.Root {
+			return fmt.Errorf("invalid proof: computed root %s, expected %s", root, c.Root)
+		}
+		for g, leaf := range c.Leaves {
+			if r, ok := nodes[g]; !ok {
+				return fmt.Errorf("invalid proof: leaf %d is not included", g)
+			} else if r != leaf {
+				return fmt.Errorf("invalid proof: leaf %d is %s, expected %s", g, r, leaf)
+			}
+		}
+		fmt.Printf("valid proof, root: %s\n", root)
+		return nil
+	}
+	if c.Proof != "" {
+		var proof util.MultiProof
+		if err := c.Proof.Read(&proof); err != nil {
+			return fmt.Errorf("failed to read proof: %v", err)
+		}
+		leaves, witness, err := proof.Nodes()
+		if err != nil {
+			return fmt.Errorf("invalid proof: %v", err)
+		}
+		c.Leaves, c.Witness = leaves, witness
+	}
+	if len(c.Leaves) == 0 {
+		return fmt.Errorf("no leaves specified")
+	}
+	root, err := util.MultiProofRoot(c.Leaves, c.Witness)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %v", err)
+	}
+	if root != c.Root {
+		return fmt.Errorf("invalid proof: computed root %s, expected %s", root, c.Root)
+	}
+	fmt.Printf("valid proof, root: %s\n", root)
+	return nil
+}
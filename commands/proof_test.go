@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/protolambda/zcli/util"
+	"github.com/protolambda/ztyp/tree"
+)
+
+func TestProofVerify(t *testing.T) {
+	// a tree of depth 2, with a proof of leaf 4
+	hFn := tree.GetHashFn()
+	leaves := []tree.Root{{4}, {5}, {6}, {7}}
+	node2, node3 := hFn(leaves[0], leaves[1]), hFn(leaves[2], leaves[3])
+	root := hFn(node2, node3)
+	proof := &util.MultiProof{
+		Root:            root,
+		Gindices:        util.GindexList{4},
+		Leaves:          util.RootList{leaves[0]},
+		WitnessGindices: util.GindexList{3, 5},
+		Witness:         util.RootList{node3, leaves[1]},
+	}
+	input := writeInput(t, "proof", proof)
+	// a forged proof of another leaf, with a root that matches it
+	forged := &util.MultiProof{
+		Root:            hFn(hFn(tree.Root{0xff}, leaves[1]), node3),
+		Gindices:        util.GindexList{4},
+		Leaves:          util.RootList{{0xff}},
+		WitnessGindices: util.GindexList{3, 5},
+		Witness:         util.RootList{node3, leaves[1]},
+	}
+	forgedInput := writeInput(t, "forged", forged)
+	nodes := map[tree.Gindex64]tree.Root{1: root, 2: node2, 3: node3, 4: leaves[0], 5: leaves[1], 6: leaves[2], 7: leaves[3]}
+	descriptor, included := util.CompactDescriptor([]tree.Gindex64{4})
+	compact := &util.CompactProof{Root: root, Descriptor: descriptor}
+	forgedCompact := &util.CompactProof{Root: forged.Root, Descriptor: descriptor}
+	for _, g := range included {
+		compact.Nodes = append(compact.Nodes, nodes[g])
+		if g == 4 {
+			forgedCompact.Nodes = append(forgedCompact.Nodes, tree.Root{0xff})
+		} else {
+			forgedCompact.Nodes = append(forgedCompact.Nodes, nodes[g])
+		}
+	}
+	compactInput := writeInput(t, "compact", compact)
+	forgedCompactInput := writeInput(t, "forged_compact", forgedCompact)
+	flags := []string{"--leaves", "4:" + leaves[0].String(), "--witness", "3:" + node3.String() + ",5:" + leaves[1].String()}
+
+	cases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"flags", append([]string{"--root", root.String()}, flags...), ""},
+		{"flags without root", flags, "no root specified"},
+		{"proof", []string{"--root", root.String(), "--proof", input}, ""},
+		{"proof without root", []string{"--proof", input}, "no root specified"},
+		{"forged proof without root", []string{"--proof", forgedInput}, "no root specified"},
+		{"forged proof", []string{"--root", root.String(), "--proof", forgedInput}, "invalid proof: computed root"},
+		{"compact proof", []string{"--compact", "--root", root.String(), "--proof", compactInput}, ""},
+		{"compact proof without root", []string{"--compact", "--proof", compactInput}, "no root specified"},
+		{"forged compact proof without root", []string{"--compact", "--proof", forgedCompactInput}, "no root specified"},
+		{"forged compact proof", []string{"--compact", "--root", root.String(), "--proof", forgedCompactInput}, "invalid proof: computed root"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := runCmd(t, routeCmd(t, &ProofCmd{}, "verify"), c.args...)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, expected %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out != "valid proof, root: "+root.String()+"\n" {
+				t.Fatalf("unexpected output: %q", out)
+			}
+		})
+	}
+}
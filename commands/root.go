@@ -16,15 +16,15 @@ func (c *RootCmd) Help() string {
 }
 
 func (c *RootCmd) Cmd(route string) (cmd interface{}, err error) {
-	phaseTypes, ok := spec_types.TypesByPhase[route]
-	if !ok {
-		return nil, fmt.Errorf("unrecognized phase: %s", route)
+	phaseTypes, err := phaseTypes(route)
+	if err != nil {
+		return nil, err
 	}
 	return &RootPhaseCmd{PhaseName: route, Types: phaseTypes}, nil
 }
 
 func (c *RootCmd) Routes() []string {
-	return spec_types.Phases
+	return phaseRoutes()
 }
 
 type RootPhaseCmd struct {
@@ -54,7 +54,7 @@ type RootObjCmd struct {
 	Type                spec_types.SpecType
 	configs.SpecOptions `ask:"."`
 	Input               util.ObjInput `ask:"<input>" help:"Input, prefix with format, empty path for STDIN"`
-	// TODO: path
+	Path                util.PathFlag `ask:"--path" help:"Path to a sub-object, e.g. 'validators/1234/pubkey', to compute the root of"`
 }
 
 func (c *RootObjCmd) Help() string {
@@ -66,11 +66,28 @@ func (c *RootObjCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	objA := c.Type.Alloc(spec)
-	if err := c.Input.Read(objA); err != nil {
+	c.PhaseName, c.Type, err = resolveType(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
+		return err
+	}
+	objA, err := readSpecObj(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
 		return fmt.Errorf("failed to read input: %v", err)
 	}
-	root := objA.HashTreeRoot(tree.GetHashFn())
+	if len(c.Path) == 0 {
+		root := objA.HashTreeRoot(tree.GetHashFn())
+		fmt.Println(root.String())
+		return nil
+	}
+	v, err := util.TreeView(objA, c.Type.TypeDef(spec))
+	if err != nil {
+		return err
+	}
+	sub, err := c.Path.Select(v)
+	if err != nil {
+		return err
+	}
+	root := sub.HashTreeRoot(tree.GetHashFn())
 	fmt.Println(root.String())
 	return nil
 }
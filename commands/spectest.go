@@ -0,0 +1,563 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/golang/snappy"
+	"github.com/protolambda/ask"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	"gopkg.in/yaml.v3"
+
+	"github.com/protolambda/zcli/spec_types"
+	"github.com/protolambda/zcli/util"
+)
+
+type SpectestCmd struct{}
+
+func (c *SpectestCmd) Help() string {
+	return "Run consensus-spec-tests vectors"
+}
+
+func (c *SpectestCmd) Cmd(route string) (cmd interface{}, err error) {
+	switch route {
+	case "run":
+		return &SpectestRunCmd{}, nil
+	}
+	return nil, ask.UnrecognizedErr
+}
+
+func (c *SpectestCmd) Routes() []string {
+	return []string{"run"}
+}
+
+type SpectestRunCmd struct {
+	Quiet bool   `ask:"--quiet" help:"Only print the failed test cases, and the summary"`
+	Path  string `ask:"<path>" help:"Test case directory, or a directory to walk for test cases, e.g. 'tests/minimal/deneb/sanity'"`
+}
+
+func (c *SpectestRunCmd) Help() string {
+	return "Run the consensus-spec-tests cases in the directory, laid out like tests/<preset>/<fork>/<runner>/<handler>/<suite>/<case>"
+}
+
+func (c *SpectestRunCmd) Run(ctx context.Context, args ...string) error {
+	dirs, err := findTestCases(c.Path)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("no test cases found in %s", c.Path)
+	}
+	type counts struct{ pass, fail, skip int }
+	summary := make(map[string]*counts)
+	var failed int
+	for _, dir := range dirs {
+		tc, err := parseTestCase(dir)
+		var key string
+		if err == nil {
+			key = strings.Join([]string{tc.Preset, tc.Fork, tc.Runner, tc.Handler}, "/")
+			err = tc.run(ctx)
+		} else {
+			key = "(unrecognized)"
+		}
+		if summary[key] == nil {
+			summary[key] = new(counts)
+		}
+		var skip skipTest
+		switch {
+		case err == nil:
+			summary[key].pass++
+			if !c.Quiet {
+				fmt.Printf("PASS  %s\n", dir)
+			}
+		case errors.As(err, &skip):
+			summary[key].skip++
+			if !c.Quiet {
+				fmt.Printf("SKIP  %s: %v\n", dir, err)
+			}
+		default:
+			summary[key].fail++
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", dir, err)
+		}
+	}
+
+	keys := make([]string, 0, len(summary))
+	for k := range summary {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "tests\tpass\tfail\tskip\t")
+	var total counts
+	for _, k := range keys {
+		s := summary[k]
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", k, s.pass, s.fail, s.skip)
+		total.pass += s.pass
+		total.fail += s.fail
+		total.skip += s.skip
+	}
+	_, _ = fmt.Fprintf(w, "total\t%d\t%d\t%d\t\n", total.pass, total.fail, total.skip)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d out of %d test cases failed", failed, len(dirs))
+	}
+	return nil
+}
+
+// findTestCases finds the test case directories: the directories with files in them.
+func findTestCases(root string) ([]string, error) {
+	var out []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				out = append(out, path)
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// skipTest is returned for test cases that cannot be run by zcli.
+type skipTest string
+
+func (s skipTest) Error() string {
+	return string(s)
+}
+
+// specTestCase is a test case directory of the consensus-spec-tests.
+type specTestCase struct {
+	Dir     string
+	Preset  string
+	Fork    string
+	Runner  string
+	Handler string
+	Suite   string
+	Case    string
+}
+
+func parseTestCase(dir string) (*specTestCase, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(filepath.ToSlash(abs), "/")
+	if len(parts) < 6 {
+		return nil, skipTest("test case path is not like <preset>/<fork>/<runner>/<handler>/<suite>/<case>")
+	}
+	parts = parts[len(parts)-6:]
+	return &specTestCase{
+		Dir:     dir,
+		Preset:  parts[0],
+		Fork:    parts[1],
+		Runner:  parts[2],
+		Handler: parts[3],
+		Suite:   parts[4],
+		Case:    parts[5],
+	}, nil
+}
+
+func (tc *specTestCase) file(name string) string {
+	return filepath.Join(tc.Dir, name)
+}
+
+func (tc *specTestCase) exists(name string) bool {
+	_, err := os.Stat(tc.file(name))
+	return err == nil
+}
+
+func (tc *specTestCase) input(name string) util.ObjInput {
+	return util.ObjInput("ssz_snappy:" + tc.file(name))
+}
+
+func (tc *specTestCase) readYAML(name string, dest interface{}) error {
+	data, err := os.ReadFile(tc.file(name))
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", name, err)
+	}
+	return nil
+}
+
+func (tc *specTestCase) readState(spec *common.Spec, name string) (common.BeaconState, error) {
+	input := util.StateInput("ssz_snappy:" + tc.file(name))
+	state, err := input.Read(spec, tc.Fork)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	return state, nil
+}
+
+func (tc *specTestCase) run(ctx context.Context) error {
+	var spec common.Spec
+	switch tc.Preset {
+	case "minimal":
+		spec = *configs.Minimal
+	case "mainnet":
+		spec = *configs.Mainnet
+	default:
+		return skipTest(fmt.Sprintf("unsupported preset %s", tc.Preset))
+	}
+	if !checkAny(spec_types.Phases, tc.Fork) {
+		return skipTest(fmt.Sprintf("unsupported fork %s", tc.Fork))
+	}
+	if err := tc.checkBLSSetting(); err != nil {
+		return err
+	}
+	switch tc.Runner {
+	case "sanity":
+		switch tc.Handler {
+		case "blocks":
+			return tc.runBlocks(ctx, &spec)
+		case "slots":
+			return tc.runSlots(ctx, &spec)
+		}
+	case "finality", "random":
+		return tc.runBlocks(ctx, &spec)
+	case "operations":
+		return tc.runOperation(ctx, &spec)
+	case "epoch_processing":
+		return tc.runEpochProcessing(ctx, &spec)
+	case "ssz_static":
+		return tc.runSSZStatic(&spec)
+	case "shuffling":
+		return tc.runShuffling(&spec)
+	}
+	return skipTest(fmt.Sprintf("unsupported test runner %s/%s", tc.Runner, tc.Handler))
+}
+
+// checkPost checks the result of processing against the post-state.
+// If there is no post-state, then processing is expected to fail.
+func (tc *specTestCase) checkPost(spec *common.Spec, post common.BeaconState, processErr error) error {
+	if !tc.exists("post.ssz_snappy") {
+		if processErr == nil {
+			return errors.New("expected processing to fail, but it succeeded")
+		}
+		return nil
+	}
+	if processErr != nil {
+		return fmt.Errorf("processing failed: %v", processErr)
+	}
+	expected, err := tc.readState(spec, "post.ssz_snappy")
+	if err != nil {
+		return err
+	}
+	diffs, err := diffStates(post, expected, 1)
+	if err != nil {
+		return err
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("post-state differs, first at %s (computed != expected)", diffs[0])
+	}
+	return nil
+}
+
+// blsIgnored is the bls_setting of test cases that are only valid with BLS verification turned off.
+const blsIgnored = 2
+
+// checkBLSSetting skips test cases that need BLS verification to be turned off, zcli always verifies signatures.
+func (tc *specTestCase) checkBLSSetting() error {
+	if !tc.exists("meta.yaml") {
+		return nil
+	}
+	var meta struct {
+		BLSSetting int `yaml:"bls_setting"`
+	}
+	if err := tc.readYAML("meta.yaml", &meta); err != nil {
+		return err
+	}
+	if meta.BLSSetting == blsIgnored {
+		return skipTest("test case needs BLS verification turned off (bls_setting: 2)")
+	}
+	return nil
+}
+
+func (tc *specTestCase) runBlocks(ctx context.Context, spec *common.Spec) error {
+	var meta struct {
+		BlocksCount int `yaml:"blocks_count"`
+	}
+	if err := tc.readYAML("meta.yaml", &meta); err != nil {
+		return err
+	}
+	pre, err := tc.readState(spec, "pre.ssz_snappy")
+	if err != nil {
+		return err
+	}
+	blocks := make([]util.ObjInput, meta.BlocksCount)
+	for i := range blocks {
+		blocks[i] = tc.input(fmt.Sprintf("blocks_%d.ssz_snappy", i))
+	}
+	cmd := &TransitionBlocksCmd{PreFork: tc.Fork, VerifyStateRoot: true}
+	post, err := cmd.Process(ctx, spec, pre, blocks)
+	return tc.checkPost(spec, post, err)
+}
+
+func (tc *specTestCase) runSlots(ctx context.Context, spec *common.Spec) error {
+	var slots uint64
+	if err := tc.readYAML("slots.yaml", &slots); err != nil {
+		return err
+	}
+	pre, err := tc.readState(spec, "pre.ssz_snappy")
+	if err != nil {
+		return err
+	}
+	cmd := &TransitionSlotsCmd{PreFork: tc.Fork, Slots: slots}
+	post, err := cmd.Process(ctx, spec, pre)
+	return tc.checkPost(spec, post, err)
+}
+
+func (tc *specTestCase) runEpochProcessing(ctx context.Context, spec *common.Spec) error {
+	state, err := tc.readState(spec, "pre.ssz_snappy")
+	if err != nil {
+		return err
+	}
+	cmd := &TransitionEpochSubCmd{PreFork: tc.Fork, Transition: tc.Handler}
+	err = cmd.Process(ctx, spec, state)
+	if err == ask.UnrecognizedErr {
+		return skipTest(fmt.Sprintf("unsupported epoch sub-process %s", tc.Handler))
+	}
+	return tc.checkPost(spec, state, err)
+}
+
+// operationFiles maps the operations handlers to the name of the operation file in the test case.
+var operationFiles = map[string]string{
+	"attestation":             "attestation",
+	"attester_slashing":       "attester_slashing",
+	"block_header":            "block",
+	"deposit":                 "deposit",
+	"proposer_slashing":       "proposer_slashing",
+	"voluntary_exit":          "voluntary_exit",
+	"sync_aggregate":          "sync_aggregate",
+	"execution_payload":       "body",
+	"withdrawals":             "execution_payload",
+	"bls_to_execution_change": "address_change",
+	"deposit_request":         "deposit_request",
+	"withdrawal_request":      "withdrawal_request",
+	"consolidation_request":   "consolidation_request",
+}
+
+func (tc *specTestCase) runOperation(ctx context.Context, spec *common.Spec) error {
+	name, ok := operationFiles[tc.Handler]
+	if !ok {
+		return skipTest(fmt.Sprintf("unsupported operation %s", tc.Handler))
+	}
+	state, err := tc.readState(spec, "pre.ssz_snappy")
+	if err != nil {
+		return err
+	}
+	cmd := &TransitionBlockSubCmd{PreFork: tc.Fork, Transition: tc.Handler}
+	input := tc.input(name + ".ssz_snappy")
+	if tc.exists("execution.yaml") {
+		var execMeta struct {
+			ExecutionValid bool `yaml:"execution_valid"`
+		}
+		if err := tc.readYAML("execution.yaml", &execMeta); err != nil {
+			return err
+		}
+		if !execMeta.ExecutionValid {
+			cmd.engine = invalidExecutionEngine{}
+		}
+	}
+	err = cmd.Process(ctx, spec, state, &input)
+	if err == ask.UnrecognizedErr {
+		return skipTest(fmt.Sprintf("unsupported operation %s", tc.Handler))
+	}
+	return tc.checkPost(spec, state, err)
+}
+
+func (tc *specTestCase) runSSZStatic(spec *common.Spec) error {
+	typ, ok := spec_types.TypesByPhase[tc.Fork][tc.Handler]
+	if !ok {
+		return skipTest(fmt.Sprintf("unsupported type %s", tc.Handler))
+	}
+	compressed, err := os.ReadFile(tc.file("serialized.ssz_snappy"))
+	if err != nil {
+		return err
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return fmt.Errorf("failed to uncompress serialized.ssz_snappy: %v", err)
+	}
+	var roots struct {
+		Root common.Root `yaml:"root"`
+	}
+	if err := tc.readYAML("roots.yaml", &roots); err != nil {
+		return err
+	}
+	obj := typ.Alloc(spec)
+	if err := obj.Deserialize(codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", tc.Handler, err)
+	}
+	if root := obj.HashTreeRoot(tree.GetHashFn()); root != roots.Root {
+		return fmt.Errorf("hash-tree-root %s != %s (computed != expected)", root, roots.Root)
+	}
+	var buf bytes.Buffer
+	if err := obj.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		return errors.New("re-encoded SSZ does not match the serialized input")
+	}
+	return nil
+}
+
+func (tc *specTestCase) runShuffling(spec *common.Spec) error {
+	var meta struct {
+		Seed    common.Root `yaml:"seed"`
+		Count   uint64      `yaml:"count"`
+		Mapping []uint64    `yaml:"mapping"`
+	}
+	if err := tc.readYAML("mapping.yaml", &meta); err != nil {
+		return err
+	}
+	if uint64(len(meta.Mapping)) != meta.Count {
+		return fmt.Errorf("mapping has %d entries, expected %d", len(meta.Mapping), meta.Count)
+	}
+	for i, expected := range meta.Mapping {
+		got := common.PermuteIndex(uint8(spec.SHUFFLE_ROUND_COUNT), common.ValidatorIndex(i), meta.Count, meta.Seed)
+		if uint64(got) != expected {
+			return fmt.Errorf("mapping[%d]: %d != %d (computed != expected)", i, got, expected)
+		}
+	}
+	return nil
+}
+
+// invalidExecutionEngine rejects all execution payloads, for the tests with invalid execution.
+type invalidExecutionEngine struct{}
+
+func (invalidExecutionEngine) BellatrixNotifyNewPayload(ctx context.Context, executionPayload *bellatrix.ExecutionPayload) (bool, error) {
+	return false, nil
+}
+
+func (invalidExecutionEngine) BellatrixIsValidBlockHash(ctx context.Context, payload *bellatrix.ExecutionPayload) (bool, error) {
+	return false, nil
+}
+
+func (invalidExecutionEngine) CapellaNotifyNewPayload(ctx context.Context, executionPayload *capella.ExecutionPayload) (bool, error) {
+	return false, nil
+}
+
+func (invalidExecutionEngine) CapellaIsValidBlockHash(ctx context.Context, payload *capella.ExecutionPayload) (bool, error) {
+	return false, nil
+}
+
+func (invalidExecutionEngine) DenebNotifyNewPayload(ctx context.Context, executionPayload *deneb.ExecutionPayload, parentBeaconBlockRoot common.Root) (bool, error) {
+	return false, nil
+}
+
+func (invalidExecutionEngine) DenebIsValidVersionedHashes(ctx context.Context, payload *deneb.ExecutionPayload, versionedHashes []common.Hash32) (bool, error) {
+	return false, nil
+}
+
+func (invalidExecutionEngine) DenebIsValidBlockHash(ctx context.Context, payload *deneb.ExecutionPayload, parentBeaconBlockRoot common.Root) (bool, error) {
+	return false, nil
+}
+
+// testEmitter writes a test case in the layout of the consensus-spec-tests.
+type testEmitter struct {
+	spec *common.Spec
+	dir  string
+}
+
+// newTestEmitter creates the test case directory, and writes the pre-state to it.
+// The pre-state is written right away, since sub-processes modify the state in-place.
+func newTestEmitter(spec *common.Spec, dir string, pre common.BeaconState) (*testEmitter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create test case directory: %v", err)
+	}
+	e := &testEmitter{spec: spec, dir: dir}
+	if err := e.writeState("pre", pre); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *testEmitter) path(name string) string {
+	return filepath.Join(e.dir, name)
+}
+
+func (e *testEmitter) writeState(name string, state common.BeaconState) error {
+	out := util.StateOutput("ssz_snappy:" + e.path(name+".ssz_snappy"))
+	if err := out.Write(e.spec, state); err != nil {
+		return fmt.Errorf("failed to write %s state of test case: %v", name, err)
+	}
+	return nil
+}
+
+func (e *testEmitter) writeObj(name string, obj common.SSZObj) error {
+	out := util.ObjOutput("ssz_snappy:" + e.path(name+".ssz_snappy"))
+	if err := out.Write(obj); err != nil {
+		return fmt.Errorf("failed to write %s of test case: %v", name, err)
+	}
+	return nil
+}
+
+func (e *testEmitter) writeYAML(name string, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(e.path(name+".yaml"), data, 0644)
+}
+
+// finish writes the post-state, or removes it if processing failed, and the meta-data of the test case.
+func (e *testEmitter) finish(post common.BeaconState, processErr error, meta map[string]interface{}) error {
+	if processErr == nil {
+		if err := e.writeState("post", post); err != nil {
+			return err
+		}
+	} else if err := os.Remove(e.path("post.ssz_snappy")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if meta == nil {
+		meta = make(map[string]interface{})
+	}
+	// signatures are always verified
+	meta["bls_setting"] = 1
+	return e.writeYAML("meta", meta)
+}
+
+// emittingOp writes the operation to the test case after reading it.
+type emittingOp struct {
+	objReader
+	emit *testEmitter
+	name string
+}
+
+func (o *emittingOp) Read(dest common.SSZObj) error {
+	if err := o.objReader.Read(dest); err != nil {
+		return err
+	}
+	return o.emit.writeObj(o.name, dest)
+}
@@ -7,15 +7,16 @@ import (
 	"time"
 
 	"github.com/protolambda/ask"
-	"github.com/protolambda/zrnt/eth2/beacon"
 	"github.com/protolambda/zrnt/eth2/beacon/altair"
 	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
 	"github.com/protolambda/zrnt/eth2/beacon/capella"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/electra"
 	"github.com/protolambda/zrnt/eth2/beacon/phase0"
 	"github.com/protolambda/zrnt/eth2/configs"
 	"github.com/protolambda/zrnt/eth2/execution"
+	"github.com/protolambda/ztyp/view"
 
 	"github.com/protolambda/zcli/spec_types"
 	"github.com/protolambda/zcli/util"
@@ -28,16 +29,14 @@ func (c *TransitionCmd) Help() string {
 }
 
 func (c *TransitionCmd) Cmd(route string) (cmd interface{}, err error) {
-	switch route {
-	case "phase0", "altair", "bellatrix", "capella", "deneb":
-		return &TransitionSubCmd{PreFork: route}, nil
-	default:
+	if !checkAny(spec_types.Phases, route) && route != util.AutoPhase {
 		return nil, ask.UnrecognizedErr
 	}
+	return &TransitionSubCmd{PreFork: route}, nil
 }
 
 func (c *TransitionCmd) Routes() []string {
-	return spec_types.Phases
+	return phaseRoutes()
 }
 
 type TransitionSubCmd struct {
@@ -56,14 +55,33 @@ func (c *TransitionSubCmd) Cmd(route string) (cmd interface{}, err error) {
 		return &TransitionEpochCmd{PreFork: c.PreFork}, nil
 	case "blocks":
 		return &TransitionBlocksCmd{PreFork: c.PreFork}, nil
+	case "upgrade":
+		if c.PreFork == latestPhase() {
+			return nil, ask.UnrecognizedErr
+		}
+		return &TransitionUpgradeCmd{PreFork: c.PreFork}, nil
 	case "sub":
+		// the available sub-processes depend on the phase
+		if c.PreFork == util.AutoPhase {
+			return nil, ask.UnrecognizedErr
+		}
 		return &TransitionSubRouterCmd{PreFork: c.PreFork}, nil
 	}
 	return nil, ask.UnrecognizedErr
 }
 
 func (c *TransitionSubCmd) Routes() []string {
-	return []string{"slots", "epoch", "blocks", "sub"}
+	if c.PreFork == util.AutoPhase {
+		return []string{"slots", "epoch", "blocks", "upgrade"}
+	}
+	if c.PreFork == latestPhase() {
+		return []string{"slots", "epoch", "blocks", "sub"}
+	}
+	return []string{"slots", "epoch", "blocks", "upgrade", "sub"}
+}
+
+func latestPhase() string {
+	return spec_types.Phases[len(spec_types.Phases)-1]
 }
 
 type TransitionEpochCmd struct {
@@ -72,6 +90,7 @@ type TransitionEpochCmd struct {
 	configs.SpecOptions `ask:"."`
 	Pre                 util.StateInput  `ask:"--pre" help:"Pre-state"`
 	Post                util.StateOutput `ask:"--post" help:"Post-state"`
+	Expect              util.StateInput  `ask:"--expect" help:"Expected post-state to compare with, the post-state is then only written if --post is set"`
 }
 
 func (c *TransitionEpochCmd) Help() string {
@@ -80,7 +99,9 @@ func (c *TransitionEpochCmd) Help() string {
 
 func (c *TransitionEpochCmd) Run(ctx context.Context, args ...string) error {
 	if c.Timeout != 0 {
-		ctx, _ = context.WithTimeout(ctx, c.Timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
 	}
 	spec, err := c.Spec()
 	if err != nil {
@@ -90,7 +111,7 @@ func (c *TransitionEpochCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	state := &beacon.StandardUpgradeableBeaconState{BeaconState: pre}
+	state := &upgradeableState{BeaconState: pre}
 	epc, err := common.NewEpochsContext(spec, pre)
 	if err != nil {
 		return err
@@ -98,7 +119,7 @@ func (c *TransitionEpochCmd) Run(ctx context.Context, args ...string) error {
 	if err := state.ProcessEpoch(ctx, spec, epc); err != nil {
 		return err
 	}
-	return c.Post.Write(spec, state)
+	return writePost(spec, state.BeaconState, &c.Post, &c.Expect)
 }
 
 type TransitionSlotsCmd struct {
@@ -108,7 +129,8 @@ type TransitionSlotsCmd struct {
 	configs.SpecOptions `ask:"."`
 	Pre                 util.StateInput  `ask:"--pre" help:"Pre-state"`
 	Post                util.StateOutput `ask:"--post" help:"Post-state"`
-	// TODO: maybe fork-override, to transition between forks?
+	Expect              util.StateInput  `ask:"--expect" help:"Expected post-state to compare with, the post-state is then only written if --post is set"`
+	EmitTest            string           `ask:"--emit-test" help:"Directory to write the pre-state, slots and post-state to, as a consensus-spec-tests case"`
 }
 
 func (c *TransitionSlotsCmd) Help() string {
@@ -117,7 +139,9 @@ func (c *TransitionSlotsCmd) Help() string {
 
 func (c *TransitionSlotsCmd) Run(ctx context.Context, args ...string) error {
 	if c.Timeout != 0 {
-		ctx, _ = context.WithTimeout(ctx, c.Timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
 	}
 	spec, err := c.Spec()
 	if err != nil {
@@ -127,19 +151,42 @@ func (c *TransitionSlotsCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	state := &beacon.StandardUpgradeableBeaconState{BeaconState: pre}
-	epc, err := common.NewEpochsContext(spec, pre)
+	var emit *testEmitter
+	if c.EmitTest != "" {
+		if emit, err = newTestEmitter(spec, c.EmitTest, pre); err != nil {
+			return err
+		}
+	}
+	post, err := c.Process(ctx, spec, pre)
+	if emit != nil {
+		if err := emit.writeYAML("slots", c.Slots); err != nil {
+			return err
+		}
+		if err := emit.finish(post, err, nil); err != nil {
+			return err
+		}
+	}
 	if err != nil {
 		return err
 	}
+	return writePost(spec, post, &c.Post, &c.Expect)
+}
+
+// Process processes the empty slots on top of the pre-state, and returns the post-state.
+func (c *TransitionSlotsCmd) Process(ctx context.Context, spec *common.Spec, pre common.BeaconState) (common.BeaconState, error) {
+	state := &upgradeableState{BeaconState: pre}
+	epc, err := common.NewEpochsContext(spec, pre)
+	if err != nil {
+		return nil, err
+	}
 	slot, err := state.Slot()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := common.ProcessSlots(ctx, spec, epc, state, slot+common.Slot(c.Slots)); err != nil {
-		return err
+		return nil, err
 	}
-	return c.Post.Write(spec, state)
+	return state.BeaconState, nil
 }
 
 type TransitionBlocksCmd struct {
@@ -149,7 +196,13 @@ type TransitionBlocksCmd struct {
 	configs.SpecOptions `ask:"."`
 	Pre                 util.StateInput  `ask:"--pre" help:"Pre-state"`
 	Post                util.StateOutput `ask:"--post" help:"Post-state"`
-	// TODO: maybe fork-override, to transition between forks?
+	Expect              util.StateInput  `ask:"--expect" help:"Expected post-state to compare with, the post-state is then only written if --post is set"`
+	EmitTest            string           `ask:"--emit-test" help:"Directory to write the pre-state, blocks and post-state to, as a consensus-spec-tests case"`
+
+	emit *testEmitter
+	// emitted is the number of blocks written to the test case,
+	// the blocks after a block that fails to process are not written.
+	emitted int
 }
 
 func (c *TransitionBlocksCmd) Help() string {
@@ -158,60 +211,130 @@ func (c *TransitionBlocksCmd) Help() string {
 
 func (c *TransitionBlocksCmd) Run(ctx context.Context, args ...string) error {
 	if c.Timeout != 0 {
-		ctx, _ = context.WithTimeout(ctx, c.Timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
 	}
 	spec, err := c.Spec()
 	if err != nil {
 		return err
 	}
-	spec.ExecutionEngine = new(execution.NoOpExecutionEngine)
 	pre, err := c.Pre.Read(spec, c.PreFork)
 	if err != nil {
 		return err
 	}
-	state := &beacon.StandardUpgradeableBeaconState{BeaconState: pre}
-	epc, err := common.NewEpochsContext(spec, pre)
+	blocks := make([]util.ObjInput, len(args))
+	for i, arg := range args {
+		blocks[i] = util.ObjInput(arg)
+	}
+	if c.EmitTest != "" {
+		if c.emit, err = newTestEmitter(spec, c.EmitTest, pre); err != nil {
+			return err
+		}
+	}
+	post, err := c.Process(ctx, spec, pre, blocks)
+	if c.emit != nil {
+		if err := c.emit.finish(post, err, map[string]interface{}{"blocks_count": c.emitted}); err != nil {
+			return err
+		}
+	}
 	if err != nil {
 		return err
 	}
+	return writePost(spec, post, &c.Post, &c.Expect)
+}
+
+// Process applies the blocks, in order, to the pre-state, and returns the post-state.
+func (c *TransitionBlocksCmd) Process(ctx context.Context, spec *common.Spec, pre common.BeaconState, blocks []util.ObjInput) (common.BeaconState, error) {
+	spec.ExecutionEngine = new(execution.NoOpExecutionEngine)
+	state := &upgradeableState{BeaconState: pre}
+	prePhase, err := util.StatePhase(pre)
+	if err != nil {
+		return nil, err
+	}
+	epc, err := newPhaseEpochsContext(spec, pre, prePhase)
+	if err != nil {
+		return nil, err
+	}
 	genesisValRoot, err := state.GenesisValidatorsRoot()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	phase := c.PreFork
-	for i, arg := range args {
-		var obj interface {
-			common.EnvelopeBuilder
-			common.SpecObj
+	for i := range blocks {
+		input := &blocks[i]
+		slot, err := input.BlockSlot("SignedBeaconBlock")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read slot of block %d: %v", i, err)
 		}
-		var digest common.ForkDigest
-		switch phase {
-		case "phase0":
-			obj = new(phase0.SignedBeaconBlock)
-			digest = common.ComputeForkDigest(spec.GENESIS_FORK_VERSION, genesisValRoot)
-		case "altair":
-			obj = new(altair.SignedBeaconBlock)
-			digest = common.ComputeForkDigest(spec.ALTAIR_FORK_VERSION, genesisValRoot)
-		case "bellatrix":
-			obj = new(bellatrix.SignedBeaconBlock)
-			digest = common.ComputeForkDigest(spec.BELLATRIX_FORK_VERSION, genesisValRoot)
-		case "capella":
-			obj = new(capella.SignedBeaconBlock)
-			digest = common.ComputeForkDigest(spec.CAPELLA_FORK_VERSION, genesisValRoot)
-		case "deneb":
-			obj = new(deneb.SignedBeaconBlock)
-			digest = common.ComputeForkDigest(spec.DENEB_FORK_VERSION, genesisValRoot)
+		// the state is upgraded while processing the slots up to the block, the block is of the fork at that slot
+		fork, err := spec_types.ForkOfState(state.BeaconState)
+		if err != nil {
+			return nil, err
+		}
+		if blockFork := spec_types.ForkAtEpoch(spec, spec.SlotToEpoch(slot)); blockFork.After(fork) {
+			fork = blockFork
 		}
-		input := util.ObjInput(arg)
+		obj := fork.NewSignedBlock()
+		digest := common.ComputeForkDigest(fork.Version(spec), genesisValRoot)
 		if err := input.Read(spec.Wrap(obj)); err != nil {
-			return fmt.Errorf("failed to read block %d: %v", i, err)
+			return nil, fmt.Errorf("failed to read block %d: %v", i, err)
+		}
+		if c.emit != nil {
+			if err := c.emit.writeObj(fmt.Sprintf("blocks_%d", i), spec.Wrap(obj)); err != nil {
+				return nil, err
+			}
+			c.emitted++
 		}
 		benv := obj.Envelope(spec, digest)
 		if err := common.StateTransition(ctx, spec, epc, state, benv, c.VerifyStateRoot); err != nil {
-			return fmt.Errorf("failed to process block %d: %v", i, err)
+			return nil, fmt.Errorf("failed to process block %d: %v", i, err)
 		}
 	}
-	return c.Post.Write(spec, state)
+	return state.BeaconState, nil
+}
+
+type TransitionUpgradeCmd struct {
+	PreFork             string
+	configs.SpecOptions `ask:"."`
+	Pre                 util.StateInput  `ask:"--pre" help:"Pre-state"`
+	Post                util.StateOutput `ask:"--post" help:"Post-state"`
+	Expect              util.StateInput  `ask:"--expect" help:"Expected post-state to compare with, the post-state is then only written if --post is set"`
+}
+
+func (c *TransitionUpgradeCmd) Help() string {
+	return fmt.Sprintf("Upgrade the state to the next fork (%s pre-state), regardless of the fork epoch", c.PreFork)
+}
+
+func (c *TransitionUpgradeCmd) Run(ctx context.Context, args ...string) error {
+	spec, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	pre, err := c.Pre.Read(spec, c.PreFork)
+	if err != nil {
+		return err
+	}
+	phase, err := statePhase(c.PreFork, pre)
+	if err != nil {
+		return err
+	}
+	fork, err := spec_types.ForkByPhase(phase)
+	if err != nil {
+		return err
+	}
+	next := spec_types.NextFork(fork)
+	if next == nil {
+		return fmt.Errorf("there is no fork after %s to upgrade to", phase)
+	}
+	epc, err := common.NewEpochsContext(spec, pre)
+	if err != nil {
+		return err
+	}
+	post, err := next.Upgrade(spec, epc, pre)
+	if err != nil {
+		return fmt.Errorf("failed to upgrade %s to %s state: %v", phase, next.Phase, err)
+	}
+	return writePost(spec, post, &c.Post, &c.Expect)
 }
 
 type TransitionSubRouterCmd struct {
@@ -252,6 +375,8 @@ type TransitionEpochSubCmd struct {
 	configs.SpecOptions `ask:"."`
 	Pre                 util.StateInput  `ask:"--pre" help:"Pre-state"`
 	Post                util.StateOutput `ask:"--post" help:"Post-state"`
+	Expect              util.StateInput  `ask:"--expect" help:"Expected post-state to compare with, the post-state is then only written if --post is set"`
+	EmitTest            string           `ask:"--emit-test" help:"Directory to write the pre-state and post-state to, as a consensus-spec-tests case"`
 }
 
 func (c *TransitionEpochSubCmd) Help() string {
@@ -260,7 +385,9 @@ func (c *TransitionEpochSubCmd) Help() string {
 
 func (c *TransitionEpochSubCmd) Run(ctx context.Context, args ...string) error {
 	if c.Timeout != 0 {
-		ctx, _ = context.WithTimeout(ctx, c.Timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
 	}
 	spec, err := c.Spec()
 	if err != nil {
@@ -270,6 +397,26 @@ func (c *TransitionEpochSubCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
+	var emit *testEmitter
+	if c.EmitTest != "" {
+		if emit, err = newTestEmitter(spec, c.EmitTest, state); err != nil {
+			return err
+		}
+	}
+	err = c.Process(ctx, spec, state)
+	if emit != nil {
+		if err := emit.finish(state, err, nil); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return writePost(spec, state, &c.Post, &c.Expect)
+}
+
+// Process runs the epoch-sub-process on the state, the state is modified in-place.
+func (c *TransitionEpochSubCmd) Process(ctx context.Context, spec *common.Spec, state common.BeaconState) error {
 	epc, err := common.NewEpochsContext(spec, state)
 	if err != nil {
 		return err
@@ -282,12 +429,6 @@ func (c *TransitionEpochSubCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	maybeOutput := func(err error) error {
-		if err != nil {
-			return err
-		}
-		return c.Post.Write(spec, state)
-	}
 	switch c.Transition {
 	case "justification_and_finalization", "inactivity_updates", "rewards_and_penalties":
 		switch c.PreFork {
@@ -304,13 +445,13 @@ func (c *TransitionEpochSubCmd) Run(ctx context.Context, args ...string) error {
 					PrevEpochUnslashedTargetStake: attesterData.PrevEpochUnslashedStake.TargetStake,
 					CurrEpochUnslashedTargetStake: attesterData.CurrEpochUnslashedTargetStake,
 				}
-				return maybeOutput(phase0.ProcessEpochJustification(ctx, spec, &just, state))
+				return phase0.ProcessEpochJustification(ctx, spec, &just, state)
 			case "inactivity_updates":
 				return errors.New("inactivity_updates only runs in Altair")
 			case "rewards_and_penalties":
-				return maybeOutput(phase0.ProcessEpochRewardsAndPenalties(ctx, spec, epc, attesterData, state.(common.BeaconState)))
+				return phase0.ProcessEpochRewardsAndPenalties(ctx, spec, epc, attesterData, state.(common.BeaconState))
 			}
-		case "altair", "bellatrix", "capella":
+		case "altair", "bellatrix", "capella", "deneb", "electra":
 			attesterData, err := altair.ComputeEpochAttesterData(ctx, spec, epc, flats, state.(altair.AltairLikeBeaconState))
 			if err != nil {
 				return err
@@ -323,16 +464,22 @@ func (c *TransitionEpochSubCmd) Run(ctx context.Context, args ...string) error {
 					PrevEpochUnslashedTargetStake: attesterData.PrevEpochUnslashedStake.TargetStake,
 					CurrEpochUnslashedTargetStake: attesterData.CurrEpochUnslashedTargetStake,
 				}
-				return maybeOutput(phase0.ProcessEpochJustification(ctx, spec, &just, state))
+				return phase0.ProcessEpochJustification(ctx, spec, &just, state)
 			case "inactivity_updates":
-				return maybeOutput(altair.ProcessInactivityUpdates(ctx, spec, attesterData, state.(altair.AltairLikeBeaconState)))
+				return altair.ProcessInactivityUpdates(ctx, spec, attesterData, state.(altair.AltairLikeBeaconState))
 			case "rewards_and_penalties":
-				return maybeOutput(altair.ProcessEpochRewardsAndPenalties(ctx, spec, epc, attesterData, state.(altair.AltairLikeBeaconState)))
+				return altair.ProcessEpochRewardsAndPenalties(ctx, spec, epc, attesterData, state.(altair.AltairLikeBeaconState))
 			}
 		}
 	case "registry_updates":
+		if c.PreFork == "electra" {
+			return processElectraRegistryUpdates(ctx, spec, epc, state.(*electra.BeaconStateView))
+		}
 		return phase0.ProcessEpochRegistryUpdates(ctx, spec, epc, flats, state)
 	case "slashings":
+		if c.PreFork == "electra" {
+			return processElectraSlashings(ctx, spec, epc, state.(*electra.BeaconStateView))
+		}
 		return phase0.ProcessEpochSlashings(ctx, spec, epc, flats, state)
 	case "final_updates": // legacy combination of below processes
 		if c.PreFork != "phase0" {
@@ -353,19 +500,32 @@ func (c *TransitionEpochSubCmd) Run(ctx context.Context, args ...string) error {
 		if err := phase0.ProcessHistoricalRootsUpdate(ctx, spec, epc, state); err != nil {
 			return err
 		}
-		return maybeOutput(phase0.ProcessParticipationRecordUpdates(ctx, spec, epc, state.(phase0.Phase0PendingAttestationsBeaconState)))
+		return phase0.ProcessParticipationRecordUpdates(ctx, spec, epc, state.(phase0.Phase0PendingAttestationsBeaconState))
 	case "eth1_data_reset":
-		return maybeOutput(phase0.ProcessEth1DataReset(ctx, spec, epc, state))
+		return phase0.ProcessEth1DataReset(ctx, spec, epc, state)
+	case "pending_deposits":
+		if c.PreFork != "electra" {
+			return errors.New("pending_deposits is only available after Deneb")
+		}
+		return processPendingDeposits(ctx, spec, epc, state.(*electra.BeaconStateView))
+	case "pending_consolidations":
+		if c.PreFork != "electra" {
+			return errors.New("pending_consolidations is only available after Deneb")
+		}
+		return processPendingConsolidations(ctx, spec, epc, state.(*electra.BeaconStateView))
 	case "effective_balance_updates":
-		return maybeOutput(phase0.ProcessEffectiveBalanceUpdates(ctx, spec, epc, flats, state))
+		if c.PreFork == "electra" {
+			return processElectraEffectiveBalanceUpdates(ctx, spec, state.(*electra.BeaconStateView))
+		}
+		return phase0.ProcessEffectiveBalanceUpdates(ctx, spec, epc, flats, state)
 	case "slashings_reset":
-		return maybeOutput(phase0.ProcessSlashingsReset(ctx, spec, epc, state))
+		return phase0.ProcessSlashingsReset(ctx, spec, epc, state)
 	case "randao_mixes_reset":
-		return maybeOutput(phase0.ProcessRandaoMixesReset(ctx, spec, epc, state))
+		return phase0.ProcessRandaoMixesReset(ctx, spec, epc, state)
 	case "historical_roots_update":
 		switch c.PreFork {
 		case "phase0", "altair", "bellatrix":
-			return maybeOutput(phase0.ProcessHistoricalRootsUpdate(ctx, spec, epc, state))
+			return phase0.ProcessHistoricalRootsUpdate(ctx, spec, epc, state)
 		default:
 			return errors.New("historical_roots_update is only available before Capella")
 		}
@@ -373,23 +533,26 @@ func (c *TransitionEpochSubCmd) Run(ctx context.Context, args ...string) error {
 		if c.PreFork != "phase0" {
 			return errors.New("participation_record_updates was removed after Phase0")
 		}
-		return maybeOutput(phase0.ProcessParticipationRecordUpdates(ctx, spec, epc, state.(phase0.Phase0PendingAttestationsBeaconState)))
+		return phase0.ProcessParticipationRecordUpdates(ctx, spec, epc, state.(phase0.Phase0PendingAttestationsBeaconState))
 	case "participation_flag_updates":
 		if c.PreFork == "phase0" {
 			return errors.New("participation_flag_updates was introduced after Phase0")
 		}
-		return maybeOutput(altair.ProcessParticipationFlagUpdates(ctx, spec, state.(*altair.BeaconStateView)))
+		return altair.ProcessParticipationFlagUpdates(ctx, spec, state.(altair.AltairLikeBeaconState))
 	case "sync_committee_updates":
 		if c.PreFork == "phase0" {
 			return errors.New("sync_committee_updates is only available after Phase0")
 		}
-		return maybeOutput(altair.ProcessSyncCommitteeUpdates(ctx, spec, epc, state.(*altair.BeaconStateView)))
+		if c.PreFork == "electra" {
+			return processElectraSyncCommitteeUpdates(ctx, spec, epc, state.(common.SyncCommitteeBeaconState))
+		}
+		return altair.ProcessSyncCommitteeUpdates(ctx, spec, epc, state.(common.SyncCommitteeBeaconState))
 	case "historical_summaries_update":
 		switch c.PreFork {
 		case "phase0", "altair", "bellatrix":
 			return errors.New("historical_summaries_update is only available after Bellatrix")
 		default:
-			return maybeOutput(capella.ProcessHistoricalSummariesUpdate(ctx, spec, epc, state.(capella.HistoricalSummariesBeaconState)))
+			return capella.ProcessHistoricalSummariesUpdate(ctx, spec, epc, state.(capella.HistoricalSummariesBeaconState))
 		}
 	}
 	return ask.UnrecognizedErr
@@ -403,6 +566,10 @@ type TransitionBlockSubCmd struct {
 	Pre                 util.StateInput  `ask:"--pre" help:"Pre-state"`
 	Op                  util.ObjInput    `ask:"<op>" help:"Block operation input"`
 	Post                util.StateOutput `ask:"--post" help:"Post-state"`
+	Expect              util.StateInput  `ask:"--expect" help:"Expected post-state to compare with, the post-state is then only written if --post is set"`
+	EmitTest            string           `ask:"--emit-test" help:"Directory to write the pre-state, operation and post-state to, as a consensus-spec-tests case"`
+
+	engine executionEngine
 }
 
 func (c *TransitionBlockSubCmd) Help() string {
@@ -411,7 +578,9 @@ func (c *TransitionBlockSubCmd) Help() string {
 
 func (c *TransitionBlockSubCmd) Run(ctx context.Context, args ...string) error {
 	if c.Timeout != 0 {
-		ctx, _ = context.WithTimeout(ctx, c.Timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
 	}
 	spec, err := c.Spec()
 	if err != nil {
@@ -421,15 +590,31 @@ func (c *TransitionBlockSubCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	epc, err := common.NewEpochsContext(spec, state)
-	if err != nil {
-		return err
+	var op objReader = &c.Op
+	var emit *testEmitter
+	if c.EmitTest != "" {
+		if emit, err = newTestEmitter(spec, c.EmitTest, state); err != nil {
+			return err
+		}
+		op = &emittingOp{objReader: op, emit: emit, name: operationFiles[c.Transition]}
 	}
-	maybeOutput := func(err error) error {
-		if err != nil {
+	err = c.Process(ctx, spec, state, op)
+	if emit != nil {
+		if err := emit.finish(state, err, nil); err != nil {
 			return err
 		}
-		return c.Post.Write(spec, state)
+	}
+	if err != nil {
+		return err
+	}
+	return writePost(spec, state, &c.Post, &c.Expect)
+}
+
+// Process runs the block-sub-process with the operation on the state, the state is modified in-place.
+func (c *TransitionBlockSubCmd) Process(ctx context.Context, spec *common.Spec, state common.BeaconState, op objReader) error {
+	epc, err := newPhaseEpochsContext(spec, state, c.PreFork)
+	if err != nil {
+		return err
 	}
 	switch c.Transition {
 	case "block_header":
@@ -437,111 +622,176 @@ func (c *TransitionBlockSubCmd) Run(ctx context.Context, args ...string) error {
 		if err != nil {
 			return err
 		}
-		proposerIndex, err := epc.GetBeaconProposer(slot)
+		proposerIndex, err := beaconProposer(spec, epc, state, c.PreFork, slot)
 		if err != nil {
 			return err
 		}
-		var header common.BeaconBlockHeader
-		if err := c.Op.Read(&header); err != nil {
+		block := spec_types.TypesByPhase[c.PreFork]["BeaconBlock"].Alloc(spec)
+		if err := op.Read(block); err != nil {
 			return err
 		}
-		return maybeOutput(common.ProcessHeader(ctx, spec, state, &header, proposerIndex))
+		header, err := blockHeader(spec, block)
+		if err != nil {
+			return err
+		}
+		return common.ProcessHeader(ctx, spec, state, header, proposerIndex)
 	case "randao":
 		var reveal common.BLSSignature
-		if err := c.Op.Read(&reveal); err != nil {
+		if err := op.Read(&reveal); err != nil {
 			return err
 		}
-		return maybeOutput(phase0.ProcessRandaoReveal(ctx, spec, epc, state, reveal))
+		return phase0.ProcessRandaoReveal(ctx, spec, epc, state, reveal)
 	case "eth1_data":
 		var eth1Data common.Eth1Data
-		if err := c.Op.Read(&eth1Data); err != nil {
+		if err := op.Read(&eth1Data); err != nil {
 			return err
 		}
-		return maybeOutput(phase0.ProcessEth1Vote(ctx, spec, epc, state, eth1Data))
+		return phase0.ProcessEth1Vote(ctx, spec, epc, state, eth1Data)
 	case "proposer_slashing":
 		var propSl phase0.ProposerSlashing
-		if err := c.Op.Read(&propSl); err != nil {
+		if err := op.Read(&propSl); err != nil {
 			return err
 		}
-		return maybeOutput(phase0.ProcessProposerSlashing(spec, epc, state, &propSl))
+		if c.PreFork == "electra" {
+			return processElectraProposerSlashing(spec, epc, state.(*electra.BeaconStateView), &propSl)
+		}
+		return phase0.ProcessProposerSlashing(spec, epc, state, &propSl)
 	case "attester_slashing":
+		if c.PreFork == "electra" {
+			var attSl electra.AttesterSlashing
+			if err := op.Read(spec.Wrap(&attSl)); err != nil {
+				return err
+			}
+			return processElectraAttesterSlashing(spec, epc, state.(*electra.BeaconStateView), &attSl)
+		}
 		var attSl phase0.AttesterSlashing
-		if err := c.Op.Read(spec.Wrap(&attSl)); err != nil {
+		if err := op.Read(spec.Wrap(&attSl)); err != nil {
 			return err
 		}
-		return maybeOutput(phase0.ProcessAttesterSlashing(spec, epc, state, &attSl))
+		return phase0.ProcessAttesterSlashing(spec, epc, state, &attSl)
 	case "attestation":
 		switch c.PreFork {
 		case "phase0":
 			var att phase0.Attestation
-			if err := c.Op.Read(spec.Wrap(&att)); err != nil {
+			if err := op.Read(spec.Wrap(&att)); err != nil {
 				return err
 			}
-			return maybeOutput(phase0.ProcessAttestation(spec, epc, state.(phase0.Phase0PendingAttestationsBeaconState), &att))
+			return phase0.ProcessAttestation(spec, epc, state.(phase0.Phase0PendingAttestationsBeaconState), &att)
 		case "altair", "bellatrix", "capella":
 			var att phase0.Attestation
-			if err := c.Op.Read(spec.Wrap(&att)); err != nil {
+			if err := op.Read(spec.Wrap(&att)); err != nil {
+				return err
+			}
+			return altair.ProcessAttestation(spec, epc, state.(altair.AltairLikeBeaconState), &att)
+		case "deneb":
+			var att phase0.Attestation
+			if err := op.Read(spec.Wrap(&att)); err != nil {
+				return err
+			}
+			return deneb.ProcessAttestation(spec, epc, state.(altair.AltairLikeBeaconState), &att)
+		case "electra":
+			var att electra.Attestation
+			if err := op.Read(spec.Wrap(&att)); err != nil {
 				return err
 			}
-			return maybeOutput(altair.ProcessAttestation(spec, epc, state.(*altair.BeaconStateView), &att))
+			return processElectraAttestation(spec, epc, state.(*electra.BeaconStateView), &att)
 		}
 	case "deposit":
 		var dep common.Deposit
-		if err := c.Op.Read(&dep); err != nil {
+		if err := op.Read(&dep); err != nil {
 			return err
 		}
-		return maybeOutput(phase0.ProcessDeposit(spec, epc, state, &dep, false))
+		if c.PreFork == "electra" {
+			return processElectraDeposit(spec, epc, state.(*electra.BeaconStateView), &dep)
+		}
+		return phase0.ProcessDeposit(spec, epc, state, &dep, false)
 	case "voluntary_exit":
 		var exit phase0.SignedVoluntaryExit
-		if err := c.Op.Read(&exit); err != nil {
+		if err := op.Read(&exit); err != nil {
 			return err
 		}
-		return maybeOutput(phase0.ProcessVoluntaryExit(spec, epc, state, &exit))
+		if c.PreFork == "electra" {
+			return processElectraVoluntaryExit(spec, epc, state.(*electra.BeaconStateView), &exit)
+		}
+		return phase0.ProcessVoluntaryExit(spec, epc, state, &exit)
 	case "bls_to_execution_change":
 		switch c.PreFork {
 		case "phase0", "altair", "bellatrix":
 			return fmt.Errorf("fork %s does not have bls_to_execution_change processing", c.PreFork)
-		case "capella", "deneb":
+		case "capella", "deneb", "electra":
 			var change common.SignedBLSToExecutionChange
-			if err := c.Op.Read(&change); err != nil {
+			if err := op.Read(&change); err != nil {
 				return err
 			}
-			return maybeOutput(capella.ProcessBLSToExecutionChange(ctx, spec, nil, state, &change))
+			return capella.ProcessBLSToExecutionChange(ctx, spec, nil, state, &change)
+		}
+	case "deposit_request":
+		if c.PreFork != "electra" {
+			return fmt.Errorf("fork %s does not have deposit_request processing", c.PreFork)
+		}
+		var req common.DepositRequest
+		if err := op.Read(&req); err != nil {
+			return err
 		}
+		return processDepositRequest(spec, state.(*electra.BeaconStateView), &req)
+	case "withdrawal_request":
+		if c.PreFork != "electra" {
+			return fmt.Errorf("fork %s does not have withdrawal_request processing", c.PreFork)
+		}
+		var req common.WithdrawalRequest
+		if err := op.Read(&req); err != nil {
+			return err
+		}
+		return processWithdrawalRequest(spec, epc, state.(*electra.BeaconStateView), &req)
+	case "consolidation_request":
+		if c.PreFork != "electra" {
+			return fmt.Errorf("fork %s does not have consolidation_request processing", c.PreFork)
+		}
+		var req common.ConsolidationRequest
+		if err := op.Read(&req); err != nil {
+			return err
+		}
+		return processConsolidationRequest(spec, epc, state.(*electra.BeaconStateView), &req)
 	case "sync_aggregate":
 		if c.PreFork == "phase0" {
 			return fmt.Errorf("fork %s does not have sync_aggregate processing", c.PreFork)
 		}
 		var agg altair.SyncAggregate
-		if err := c.Op.Read(spec.Wrap(&agg)); err != nil {
+		if err := op.Read(spec.Wrap(&agg)); err != nil {
 			return err
 		}
-		return maybeOutput(altair.ProcessSyncAggregate(ctx, spec, epc, state.(*altair.BeaconStateView), &agg))
+		return altair.ProcessSyncAggregate(ctx, spec, epc, state, &agg)
 	case "execution_payload":
 		switch c.PreFork {
 		case "phase0", "altair":
 			return fmt.Errorf("fork %s does not have execution_payload processing", c.PreFork)
 		case "bellatrix":
 			var body bellatrix.BeaconBlockBody
-			if err := c.Op.Read(spec.Wrap(&body)); err != nil {
+			if err := op.Read(spec.Wrap(&body)); err != nil {
 				return err
 			}
-			return maybeOutput(bellatrix.ProcessExecutionPayload(ctx, spec, state.(bellatrix.ExecutionTrackingBeaconState),
-				&body.ExecutionPayload, new(execution.NoOpExecutionEngine)))
+			return bellatrix.ProcessExecutionPayload(ctx, spec, state.(bellatrix.ExecutionTrackingBeaconState),
+				&body.ExecutionPayload, c.executionEngine())
 		case "capella":
 			var body capella.BeaconBlockBody
-			if err := c.Op.Read(spec.Wrap(&body)); err != nil {
+			if err := op.Read(spec.Wrap(&body)); err != nil {
 				return err
 			}
-			return maybeOutput(capella.ProcessExecutionPayload(ctx, spec, state.(capella.ExecutionTrackingBeaconState),
-				&body.ExecutionPayload, new(execution.NoOpExecutionEngine)))
+			return capella.ProcessExecutionPayload(ctx, spec, state.(capella.ExecutionTrackingBeaconState),
+				&body.ExecutionPayload, c.executionEngine())
 		case "deneb":
 			var body deneb.BeaconBlockBody
-			if err := c.Op.Read(spec.Wrap(&body)); err != nil {
+			if err := op.Read(spec.Wrap(&body)); err != nil {
+				return err
+			}
+			return deneb.ProcessExecutionPayload(ctx, spec, state.(deneb.ExecutionTrackingBeaconState),
+				&body, c.executionEngine())
+		case "electra":
+			var body electra.BeaconBlockBody
+			if err := op.Read(spec.Wrap(&body)); err != nil {
 				return err
 			}
-			return maybeOutput(deneb.ProcessExecutionPayload(ctx, spec, state.(deneb.ExecutionTrackingBeaconState),
-				&body, new(execution.NoOpExecutionEngine)))
+			return processElectraExecutionPayload(ctx, spec, state.(*electra.BeaconStateView), &body, c.executionEngine())
 		}
 	case "withdrawals":
 		switch c.PreFork {
@@ -549,21 +799,63 @@ func (c *TransitionBlockSubCmd) Run(ctx context.Context, args ...string) error {
 			return fmt.Errorf("fork %s does not have withdrawals processing", c.PreFork)
 		case "capella":
 			var payload capella.ExecutionPayload
-			if err := c.Op.Read(spec.Wrap(&payload)); err != nil {
+			if err := op.Read(spec.Wrap(&payload)); err != nil {
 				return err
 			}
-			return maybeOutput(capella.ProcessWithdrawals(ctx, spec, state.(capella.BeaconStateWithWithdrawals), &payload))
+			return capella.ProcessWithdrawals(ctx, spec, state.(capella.BeaconStateWithWithdrawals), &payload)
 		case "deneb":
 			var payload deneb.ExecutionPayload
-			if err := c.Op.Read(spec.Wrap(&payload)); err != nil {
+			if err := op.Read(spec.Wrap(&payload)); err != nil {
 				return err
 			}
-			return maybeOutput(capella.ProcessWithdrawals(ctx, spec, state.(capella.BeaconStateWithWithdrawals), &payload))
+			return capella.ProcessWithdrawals(ctx, spec, state.(capella.BeaconStateWithWithdrawals), &payload)
+		case "electra":
+			var payload deneb.ExecutionPayload
+			if err := op.Read(spec.Wrap(&payload)); err != nil {
+				return err
+			}
+			return processElectraWithdrawals(ctx, spec, state.(*electra.BeaconStateView), &payload)
 		}
 	}
 	return ask.UnrecognizedErr
 }
 
+// executionEngine returns the engine to verify execution payloads with, by default all payloads are valid.
+func (c *TransitionBlockSubCmd) executionEngine() executionEngine {
+	if c.engine != nil {
+		return c.engine
+	}
+	return new(execution.NoOpExecutionEngine)
+}
+
+// blockHeader computes the header of a BeaconBlock of any phase.
+func blockHeader(spec *common.Spec, obj common.SSZObj) (*common.BeaconBlockHeader, error) {
+	wrapped, ok := obj.(common.WrappedSpecObj)
+	if !ok {
+		return nil, fmt.Errorf("unexpected block type %T", obj)
+	}
+	_, block := wrapped.Unwrap()
+	headerBlock, ok := block.(interface {
+		Header(spec *common.Spec) *common.BeaconBlockHeader
+	})
+	if !ok {
+		return nil, fmt.Errorf("block type %T has no header", block)
+	}
+	return headerBlock.Header(spec), nil
+}
+
+// objReader reads spec objects, like util.ObjInput.
+type objReader interface {
+	Read(dest common.SSZObj) error
+}
+
+// executionEngine verifies the execution payloads of all phases.
+type executionEngine interface {
+	bellatrix.ExecutionEngine
+	capella.ExecutionEngine
+	deneb.ExecutionEngine
+}
+
 var epochSubProcessingByPhase = map[string][]string{
 	"phase0": {
 		"justification_and_finalization",
@@ -593,6 +885,7 @@ var epochSubProcessingByPhase = map[string][]string{
 	},
 	"bellatrix": {
 		"justification_and_finalization",
+		"inactivity_updates",
 		"rewards_and_penalties",
 		"registry_updates",
 		"slashings",
@@ -601,11 +894,12 @@ var epochSubProcessingByPhase = map[string][]string{
 		"slashings_reset",
 		"randao_mixes_reset",
 		"historical_roots_update",
-		"participation_record_updates",
+		"participation_flag_updates",
 		"sync_committee_updates",
 	},
 	"capella": {
 		"justification_and_finalization",
+		"inactivity_updates",
 		"rewards_and_penalties",
 		"registry_updates",
 		"slashings",
@@ -614,11 +908,12 @@ var epochSubProcessingByPhase = map[string][]string{
 		"slashings_reset",
 		"randao_mixes_reset",
 		"historical_summaries_update",
-		"participation_record_updates",
+		"participation_flag_updates",
 		"sync_committee_updates",
 	},
 	"deneb": {
 		"justification_and_finalization",
+		"inactivity_updates",
 		"rewards_and_penalties",
 		"registry_updates",
 		"slashings",
@@ -627,7 +922,23 @@ var epochSubProcessingByPhase = map[string][]string{
 		"slashings_reset",
 		"randao_mixes_reset",
 		"historical_summaries_update",
-		"participation_record_updates",
+		"participation_flag_updates",
+		"sync_committee_updates",
+	},
+	"electra": {
+		"justification_and_finalization",
+		"inactivity_updates",
+		"rewards_and_penalties",
+		"registry_updates",
+		"slashings",
+		"eth1_data_reset",
+		"pending_deposits",
+		"pending_consolidations",
+		"effective_balance_updates",
+		"slashings_reset",
+		"randao_mixes_reset",
+		"historical_summaries_update",
+		"participation_flag_updates",
 		"sync_committee_updates",
 	},
 }
@@ -694,4 +1005,132 @@ var blockOpSubProcessingByPhase = map[string][]string{
 		"execution_payload",
 		"withdrawals",
 	},
+	"electra": {
+		"block_header",
+		"randao",
+		"eth1_data",
+		"proposer_slashing",
+		"attester_slashing",
+		"attestation",
+		"deposit",
+		"voluntary_exit",
+		"bls_to_execution_change",
+		"deposit_request",
+		"withdrawal_request",
+		"consolidation_request",
+		"sync_aggregate",
+		"execution_payload",
+		"withdrawals",
+	},
+}
+
+// upgradeableState upgrades the state at the fork epochs of the config, like beacon.StandardUpgradeableBeaconState,
+// and runs the Electra epoch and block processing that ZRNT does not implement.
+type upgradeableState struct {
+	common.BeaconState
+}
+
+func (s *upgradeableState) UpgradeMaybe(ctx context.Context, spec *common.Spec, epc *common.EpochsContext) error {
+	slot, err := s.BeaconState.Slot()
+	if err != nil {
+		return err
+	}
+	fork, err := spec_types.ForkOfState(s.BeaconState)
+	if err != nil {
+		return err
+	}
+	for next := spec_types.NextFork(fork); next != nil; next = spec_types.NextFork(fork) {
+		// the start slot overflows for forks that are not scheduled
+		if start, err := spec.EpochStartSlot(next.Epoch(spec)); err != nil || start != slot {
+			break
+		}
+		post, err := next.Upgrade(spec, epc, s.BeaconState)
+		if err != nil {
+			return fmt.Errorf("failed to upgrade %s to %s state: %v", fork.Phase, next.Phase, err)
+		}
+		if post, ok := post.(*altair.BeaconStateView); ok {
+			if err := epc.LoadSyncCommittees(post); err != nil {
+				return fmt.Errorf("failed to pre-compute sync committees: %v", err)
+			}
+		}
+		s.BeaconState = post
+		fork = next
+	}
+	// the epochs-context computes the proposers of a new epoch with the sampling before Electra
+	if fork.Phase == "electra" && slot%spec.SLOTS_PER_EPOCH == 0 {
+		return loadPhaseProposers(spec, epc, s.BeaconState, fork.Phase)
+	}
+	return nil
+}
+
+func (s *upgradeableState) ProcessEpoch(ctx context.Context, spec *common.Spec, epc *common.EpochsContext) error {
+	if state, ok := s.BeaconState.(*electra.BeaconStateView); ok {
+		return processElectraEpoch(ctx, spec, epc, state)
+	}
+	return s.BeaconState.ProcessEpoch(ctx, spec, epc)
+}
+
+func (s *upgradeableState) ProcessBlock(ctx context.Context, spec *common.Spec, epc *common.EpochsContext, benv *common.BeaconBlockEnvelope) error {
+	if state, ok := s.BeaconState.(*electra.BeaconStateView); ok {
+		return processElectraBlock(ctx, spec, epc, state, benv)
+	}
+	return s.BeaconState.ProcessBlock(ctx, spec, epc, benv)
+}
+
+// writePost writes the post-state, and compares it to the expected post-state, if any.
+// With an expected post-state, the post-state is only written if the output is set.
+func writePost(spec *common.Spec, post common.BeaconState, out *util.StateOutput, expect *util.StateInput) error {
+	if *expect == "" || *out != "" {
+		if err := out.Write(spec, post); err != nil {
+			return err
+		}
+	}
+	if *expect == "" {
+		return nil
+	}
+	phase, err := util.StatePhase(post)
+	if err != nil {
+		return err
+	}
+	expected, err := expect.Read(spec, phase)
+	if err != nil {
+		return fmt.Errorf("failed to read expected post-state: %v", err)
+	}
+	diffs, err := diffStates(post, expected, 0)
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		fmt.Println("post-state matches the expected post-state")
+		return nil
+	}
+	fmt.Printf("post-state differs from the expected post-state (computed != expected):\n")
+	for _, d := range diffs {
+		fmt.Println(d.String())
+	}
+	return fmt.Errorf("post-state does not match the expected post-state, differences: %d", len(diffs))
+}
+
+// diffStates compares the merkle trees of two states, up to limit differences if limit > 0.
+func diffStates(a, b common.BeaconState, limit int) ([]util.TreeDiff, error) {
+	aPhase, err := util.StatePhase(a)
+	if err != nil {
+		return nil, err
+	}
+	bPhase, err := util.StatePhase(b)
+	if err != nil {
+		return nil, err
+	}
+	if aPhase != bPhase {
+		return nil, fmt.Errorf("cannot compare %s state to %s state", aPhase, bPhase)
+	}
+	aView, ok := a.(view.View)
+	if !ok {
+		return nil, fmt.Errorf("state %T is not a view", a)
+	}
+	bView, ok := b.(view.View)
+	if !ok {
+		return nil, fmt.Errorf("state %T is not a view", b)
+	}
+	return util.DiffTrees(aView, bView, util.DiffOptions{Limit: limit})
 }
@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/ask"
+	"github.com/protolambda/zcli/util"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/tree"
+)
+
+func TestTransitionUpgrade(t *testing.T) {
+	spec := configs.Minimal
+	cases := []struct {
+		name  string
+		route string
+		pre   string
+		post  string
+	}{
+		{"phase0 to altair", "phase0", "phase0", "altair"},
+		{"auto phase", util.AutoPhase, "altair", "bellatrix"},
+		{"capella to deneb", "capella", "capella", "deneb"},
+		{"deneb to electra", "deneb", "deneb", "electra"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pre, _ := genesisState(t, c.pre)
+			out := "ssz:" + filepath.Join(t.TempDir(), "post.ssz")
+			args := minimalArgs("--pre", writeState(t, pre), "--post", out)
+			if _, err := runCmd(t, routeCmd(t, &TransitionCmd{}, c.route, "upgrade"), args...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			input := util.StateInput(out)
+			post, err := input.Read(spec, util.AutoPhase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if phase, err := util.StatePhase(post); err != nil || phase != c.post {
+				t.Fatalf("got %s state (error: %v), expected %s", phase, err, c.post)
+			}
+			preFork, err := pre.Fork()
+			if err != nil {
+				t.Fatal(err)
+			}
+			postFork, err := post.Fork()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if postFork.PreviousVersion != preFork.CurrentVersion {
+				t.Fatalf("got previous fork version %s, expected %s", postFork.PreviousVersion, preFork.CurrentVersion)
+			}
+		})
+	}
+
+	// there is nothing to upgrade the latest phase to
+	if _, err := (&TransitionSubCmd{PreFork: latestPhase()}).Cmd("upgrade"); err != ask.UnrecognizedErr {
+		t.Fatalf("got %v, expected the upgrade of the latest phase to be unrecognized", err)
+	}
+}
+
+func TestTransitionEpochSub(t *testing.T) {
+	for _, phase := range genesisPhases {
+		for _, transition := range epochSubProcessingByPhase[phase] {
+			t.Run(phase+" "+transition, func(t *testing.T) {
+				pre, _ := genesisState(t, phase)
+				out := "ssz:" + filepath.Join(t.TempDir(), "post.ssz")
+				args := minimalArgs("--pre", writeState(t, pre), "--post", out)
+				if _, err := runCmd(t, routeCmd(t, &TransitionCmd{}, phase, "sub", transition), args...); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestTransitionElectraSlots(t *testing.T) {
+	spec := configs.Minimal
+	pre, _ := genesisState(t, "electra")
+	out := "ssz:" + filepath.Join(t.TempDir(), "post.ssz")
+	// process two epoch transitions, with the Electra epoch processing
+	args := minimalArgs("--pre", writeState(t, pre), "--post", out, "16")
+	if _, err := runCmd(t, routeCmd(t, &TransitionCmd{}, "electra", "slots"), args...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	input := util.StateInput(out)
+	post, err := input.Read(spec, "electra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := post.Slot(); err != nil || slot != 16 {
+		t.Fatalf("got slot %d (error: %v), expected 16", slot, err)
+	}
+}
+
+func TestTransitionEmitBlockHeader(t *testing.T) {
+	spec := configs.Minimal
+	genesis, _ := genesisState(t, "phase0")
+	pre := "ssz:" + filepath.Join(t.TempDir(), "pre.ssz")
+	args := minimalArgs("--pre", writeState(t, genesis), "--post", pre, "1")
+	if _, err := runCmd(t, routeCmd(t, &TransitionCmd{}, "phase0", "slots"), args...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	input := util.StateInput(pre)
+	state, err := input.Read(spec, "phase0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	epc, err := common.NewEpochsContext(spec, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposer, err := epc.GetBeaconProposer(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := state.LatestBlockHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &phase0.BeaconBlock{Slot: 1, ProposerIndex: proposer, ParentRoot: latest.HashTreeRoot(tree.GetHashFn())}
+
+	dir := filepath.Join(t.TempDir(), "minimal", "phase0", "operations", "block_header", "zcli", "header")
+	args = minimalArgs("--pre", pre, "--emit-test", dir, writeInput(t, "block", spec.Wrap(block)))
+	if _, err := runCmd(t, routeCmd(t, &TransitionCmd{}, "phase0", "sub", "block_header"), args...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the emitted case has the full block, like the consensus-spec-tests
+	var emitted phase0.BeaconBlock
+	emittedInput := util.ObjInput("ssz_snappy:" + filepath.Join(dir, "block.ssz_snappy"))
+	if err := emittedInput.Read(spec.Wrap(&emitted)); err != nil {
+		t.Fatalf("failed to read emitted block: %v", err)
+	}
+	if emitted.HashTreeRoot(spec, tree.GetHashFn()) != block.HashTreeRoot(spec, tree.GetHashFn()) {
+		t.Fatal("emitted block differs from the processed block")
+	}
+	out, err := runCmd(t, &SpectestRunCmd{}, dir)
+	if err != nil {
+		t.Fatalf("emitted case failed: %v", err)
+	}
+	if !strings.HasPrefix(out, "PASS") {
+		t.Fatalf("emitted case did not pass:\n%s", out)
+	}
+}
@@ -1,16 +1,13 @@
 package commands
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/protolambda/zcli/spec_types"
 	"github.com/protolambda/zcli/util"
 	"github.com/protolambda/zrnt/eth2/configs"
-	"github.com/protolambda/ztyp/codec"
 	"github.com/protolambda/ztyp/tree"
-	"github.com/protolambda/ztyp/view"
 	"io"
 	"os"
 )
@@ -22,15 +19,15 @@ func (c *TreeCmd) Help() string {
 }
 
 func (c *TreeCmd) Cmd(route string) (cmd interface{}, err error) {
-	phaseTypes, ok := spec_types.TypesByPhase[route]
-	if !ok {
-		return nil, fmt.Errorf("unrecognized phase: %s", route)
+	phaseTypes, err := phaseTypes(route)
+	if err != nil {
+		return nil, err
 	}
 	return &TreePhaseCmd{PhaseName: route, Types: phaseTypes}, nil
 }
 
 func (c *TreeCmd) Routes() []string {
-	return spec_types.Phases
+	return phaseRoutes()
 }
 
 type TreePhaseCmd struct {
@@ -60,6 +57,7 @@ type TreeObjCmd struct {
 	Type                spec_types.SpecType
 	configs.SpecOptions `ask:"."`
 	Input               util.ObjInput `ask:"<input>" help:"Input, prefix with format, empty path for STDIN"`
+	Path                util.PathFlag `ask:"--path" help:"Path to a sub-object, e.g. 'validators/1234', to dump the tree of"`
 }
 
 func (c *TreeObjCmd) Help() string {
@@ -71,25 +69,23 @@ func (c *TreeObjCmd) Run(ctx context.Context, args ...string) error {
 	if err != nil {
 		return err
 	}
-	objA := c.Type.Alloc(spec)
-	if err := c.Input.Read(objA); err != nil {
+	c.PhaseName, c.Type, err = resolveType(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
+		return err
+	}
+	objA, err := readSpecObj(spec, c.PhaseName, c.TypeName, c.Type, &c.Input)
+	if err != nil {
 		return fmt.Errorf("failed to read input: %v", err)
 	}
 
-	var v view.View
-	// Hack to convert flat-structure input to tree-structure
-	{
-		var buf bytes.Buffer
-		if err := objA.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
-			return err
-		}
-		data := buf.Bytes()
-		dec := codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))
-		treeType := c.Type.TypeDef(spec)
-		v, err = treeType.Deserialize(dec)
-		if err != nil {
-			return err
-		}
+	// convert flat-structure input to tree-structure
+	v, err := util.TreeView(objA, c.Type.TypeDef(spec))
+	if err != nil {
+		return err
+	}
+	v, err = c.Path.Select(v)
+	if err != nil {
+		return err
 	}
 
 	node := v.Backing()
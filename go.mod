@@ -5,8 +5,9 @@ go 1.21
 require (
 	github.com/golang/snappy v0.0.3
 	github.com/protolambda/ask v0.1.2
+	github.com/protolambda/bls12-381-util v0.1.0
 	github.com/protolambda/messagediff v1.4.0
-	github.com/protolambda/zrnt v0.33.1
+	github.com/protolambda/zrnt v0.34.1
 	github.com/protolambda/ztyp v0.2.2
 	gopkg.in/yaml.v3 v3.0.0
 )
@@ -15,6 +16,5 @@ require (
 	github.com/holiman/uint256 v1.2.0 // indirect
 	github.com/kilic/bls12-381 v0.1.0 // indirect
 	github.com/minio/sha256-simd v0.1.0 // indirect
-	github.com/protolambda/bls12-381-util v0.1.0 // indirect
 	golang.org/x/sys v0.17.0 // indirect
 )
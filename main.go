@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/protolambda/ask"
 	"github.com/protolambda/zcli/commands"
@@ -23,12 +24,18 @@ func (c *MainCmd) Cmd(route string) (cmd interface{}, err error) {
 		cmd = &commands.ConvertCmd{}
 	case "diff":
 		cmd = &commands.DiffCmd{}
+	case "gindex":
+		cmd = &commands.GindexCmd{}
+	case "lightclient":
+		cmd = &commands.LightClientCmd{}
 	case "meta":
 		cmd = &commands.MetaCmd{}
 	case "proof":
 		cmd = &commands.ProofCmd{}
 	case "root":
 		cmd = &commands.RootCmd{}
+	case "spectest":
+		cmd = &commands.SpectestCmd{}
 	case "transition":
 		cmd = &commands.TransitionCmd{}
 	case "tree":
@@ -42,29 +49,32 @@ func (c *MainCmd) Cmd(route string) (cmd interface{}, err error) {
 }
 
 func (c *MainCmd) Routes() []string {
-	return []string{"pretty", "convert", "diff", "meta", "proof", "root", "transition", "tree", "version"}
+	return []string{"pretty", "convert", "diff", "gindex", "lightclient", "meta", "proof", "root", "spectest", "transition", "tree", "version"}
 }
 
+// main exits with code 1 if diffed objects are different, and with code 2 on errors.
 func main() {
 	cmd := &MainCmd{}
 	descr, err := ask.Load(cmd)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "failed to load main command: %v", err.Error())
-		os.Exit(1)
+		os.Exit(2)
 	}
 
 	if cmd, err := descr.Execute(context.Background(), nil, os.Args[1:]...); err == ask.UnrecognizedErr {
 		_, _ = fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		os.Exit(2)
 	} else if err == ask.HelpErr {
 		_, _ = fmt.Fprintln(os.Stderr, cmd.Usage(false))
 		os.Exit(0)
+	} else if errors.Is(err, commands.ErrObjectsDiffer) {
+		os.Exit(1)
 	} else if err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		os.Exit(2)
 	} else if cmd == nil {
 		_, _ = fmt.Fprintln(os.Stderr, "failed to load command")
-		os.Exit(1)
+		os.Exit(2)
 	}
 	os.Exit(0)
 }
@@ -0,0 +1,322 @@
+package spec_types
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/electra"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/view"
+)
+
+// ZRNT defines the Electra state, but does not implement the upgrade to it,
+// nor the access to the pending deposits, partial withdrawals and consolidations of it.
+// These are implemented here, following the consensus-specs v1.5.0.
+
+// COMPOUNDING_WITHDRAWAL_PREFIX is the withdrawal credentials prefix of compounding validators.
+const COMPOUNDING_WITHDRAWAL_PREFIX = 0x02
+
+// UNSET_DEPOSIT_REQUESTS_START_INDEX is the deposit requests start index before the first deposit request.
+const UNSET_DEPOSIT_REQUESTS_START_INDEX = ^uint64(0)
+
+// G2PointAtInfinity is the signature of the pending deposits that do not need to be verified.
+var G2PointAtInfinity = common.BLSSignature{0xc0}
+
+// HasCompoundingWithdrawalCredential checks if the withdrawal credentials have the compounding prefix.
+func HasCompoundingWithdrawalCredential(creds common.Root) bool {
+	return creds[0] == COMPOUNDING_WITHDRAWAL_PREFIX
+}
+
+// HasExecutionWithdrawalCredential checks if the withdrawal credentials have the eth1 address or compounding prefix.
+func HasExecutionWithdrawalCredential(creds common.Root) bool {
+	return creds[0] == common.ETH1_ADDRESS_WITHDRAWAL_PREFIX || HasCompoundingWithdrawalCredential(creds)
+}
+
+// MaxEffectiveBalance is the maximum effective balance of a validator with the given withdrawal credentials.
+func MaxEffectiveBalance(spec *common.Spec, creds common.Root) common.Gwei {
+	if HasCompoundingWithdrawalCredential(creds) {
+		return spec.MAX_EFFECTIVE_BALANCE_ELECTRA
+	}
+	return spec.MIN_ACTIVATION_BALANCE
+}
+
+// BalanceChurnLimit computes get_balance_churn_limit from the total active balance.
+func BalanceChurnLimit(spec *common.Spec, totalActiveBalance common.Gwei) common.Gwei {
+	churn := totalActiveBalance / common.Gwei(spec.CHURN_LIMIT_QUOTIENT)
+	if min := common.Gwei(spec.MIN_PER_EPOCH_CHURN_LIMIT_ELECTRA); churn < min {
+		churn = min
+	}
+	return churn - churn%spec.EFFECTIVE_BALANCE_INCREMENT
+}
+
+// ActivationExitChurnLimit computes get_activation_exit_churn_limit from the total active balance.
+func ActivationExitChurnLimit(spec *common.Spec, totalActiveBalance common.Gwei) common.Gwei {
+	churn := BalanceChurnLimit(spec, totalActiveBalance)
+	if max := common.Gwei(spec.MAX_PER_EPOCH_ACTIVATION_EXIT_CHURN_LIMIT); churn > max {
+		return max
+	}
+	return churn
+}
+
+// ConsolidationChurnLimit computes get_consolidation_churn_limit from the total active balance.
+func ConsolidationChurnLimit(spec *common.Spec, totalActiveBalance common.Gwei) common.Gwei {
+	return BalanceChurnLimit(spec, totalActiveBalance) - ActivationExitChurnLimit(spec, totalActiveBalance)
+}
+
+// PendingDeposits reads the pending deposits of the state.
+func PendingDeposits(spec *common.Spec, state *electra.BeaconStateView) (out common.PendingDeposits, err error) {
+	err = readStateField(spec, state, "pending_deposits", &out)
+	return
+}
+
+// SetPendingDeposits replaces the pending deposits of the state.
+func SetPendingDeposits(spec *common.Spec, state *electra.BeaconStateView, deposits common.PendingDeposits) error {
+	return writeStateField(spec, state, "pending_deposits", &deposits)
+}
+
+// PendingPartialWithdrawals reads the pending partial withdrawals of the state.
+func PendingPartialWithdrawals(spec *common.Spec, state *electra.BeaconStateView) (out common.PendingPartialWithdrawals, err error) {
+	err = readStateField(spec, state, "pending_partial_withdrawals", &out)
+	return
+}
+
+// SetPendingPartialWithdrawals replaces the pending partial withdrawals of the state.
+func SetPendingPartialWithdrawals(spec *common.Spec, state *electra.BeaconStateView, withdrawals common.PendingPartialWithdrawals) error {
+	return writeStateField(spec, state, "pending_partial_withdrawals", &withdrawals)
+}
+
+// PendingConsolidations reads the pending consolidations of the state.
+func PendingConsolidations(spec *common.Spec, state *electra.BeaconStateView) (out common.PendingConsolidations, err error) {
+	err = readStateField(spec, state, "pending_consolidations", &out)
+	return
+}
+
+// SetPendingConsolidations replaces the pending consolidations of the state.
+func SetPendingConsolidations(spec *common.Spec, state *electra.BeaconStateView, consolidations common.PendingConsolidations) error {
+	return writeStateField(spec, state, "pending_consolidations", &consolidations)
+}
+
+func stateFieldIndex(state *electra.BeaconStateView, name string) (uint64, error) {
+	for i, f := range state.Fields {
+		if f.Name == name {
+			return uint64(i), nil
+		}
+	}
+	return 0, fmt.Errorf("state has no field %s", name)
+}
+
+// readStateField decodes the field of the state into dest.
+func readStateField(spec *common.Spec, state *electra.BeaconStateView, name string, dest common.SpecObj) error {
+	i, err := stateFieldIndex(state, name)
+	if err != nil {
+		return err
+	}
+	v, err := state.Get(i)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := v.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	return dest.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data))))
+}
+
+// writeStateField replaces the field of the state with the encoding of src.
+func writeStateField(spec *common.Spec, state *electra.BeaconStateView, name string, src common.SpecObj) error {
+	i, err := stateFieldIndex(state, name)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := src.Serialize(spec, codec.NewEncodingWriter(&buf)); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	v, err := state.Fields[i].Type.Deserialize(codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data))))
+	if err != nil {
+		return err
+	}
+	return state.Set(i, v)
+}
+
+// denebStateFields is the number of fields that the Electra state shares with the Deneb state.
+const denebStateFields = 28
+
+// upgradeToElectra upgrades the Deneb state like upgrade_to_electra.
+func upgradeToElectra(spec *common.Spec, epc *common.EpochsContext, pre *deneb.BeaconStateView) (*electra.BeaconStateView, error) {
+	slot, err := pre.Slot()
+	if err != nil {
+		return nil, err
+	}
+	epoch := spec.SlotToEpoch(slot)
+	post := electra.NewBeaconStateView(spec)
+	// the fields up to the historical summaries are of the same type, the subtrees are shared
+	for i := uint64(0); i < denebStateFields; i++ {
+		v, err := pre.Get(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := post.Set(i, v); err != nil {
+			return nil, err
+		}
+	}
+	preFork, err := pre.Fork()
+	if err != nil {
+		return nil, err
+	}
+	if err := post.SetFork(common.Fork{
+		PreviousVersion: preFork.CurrentVersion,
+		CurrentVersion:  spec.ELECTRA_FORK_VERSION,
+		Epoch:           epoch,
+	}); err != nil {
+		return nil, err
+	}
+	if err := post.SetDepositRequestsStartIndex(view.Uint64View(UNSET_DEPOSIT_REQUESTS_START_INDEX)); err != nil {
+		return nil, err
+	}
+	if err := post.SetExitBalanceToConsume(ActivationExitChurnLimit(spec, epc.TotalActiveStake)); err != nil {
+		return nil, err
+	}
+	if err := post.SetConsolidationBalanceToConsume(ConsolidationChurnLimit(spec, epc.TotalActiveStake)); err != nil {
+		return nil, err
+	}
+	if err := post.SetEarliestConsolidationEpoch(spec.ComputeActivationExitEpoch(epoch)); err != nil {
+		return nil, err
+	}
+
+	vals, err := post.Validators()
+	if err != nil {
+		return nil, err
+	}
+	flats, err := common.FlattenValidators(vals)
+	if err != nil {
+		return nil, err
+	}
+	earliestExitEpoch := epoch
+	var preActivation []common.ValidatorIndex
+	for i := range flats {
+		if exit := flats[i].ExitEpoch; exit != common.FAR_FUTURE_EPOCH && exit > earliestExitEpoch {
+			earliestExitEpoch = exit
+		}
+		if flats[i].ActivationEpoch == common.FAR_FUTURE_EPOCH {
+			preActivation = append(preActivation, common.ValidatorIndex(i))
+		}
+	}
+	if err := post.SetEarliestExitEpoch(earliestExitEpoch + 1); err != nil {
+		return nil, err
+	}
+
+	bals, err := post.Balances()
+	if err != nil {
+		return nil, err
+	}
+	var deposits common.PendingDeposits
+	sort.SliceStable(preActivation, func(i, j int) bool {
+		return flats[preActivation[i]].ActivationEligibilityEpoch < flats[preActivation[j]].ActivationEligibilityEpoch
+	})
+	for _, index := range preActivation {
+		balance, err := bals.GetBalance(index)
+		if err != nil {
+			return nil, err
+		}
+		if err := bals.SetBalance(index, 0); err != nil {
+			return nil, err
+		}
+		v, err := vals.Validator(index)
+		if err != nil {
+			return nil, err
+		}
+		if err := v.SetEffectiveBalance(0); err != nil {
+			return nil, err
+		}
+		if err := v.SetActivationEligibilityEpoch(common.FAR_FUTURE_EPOCH); err != nil {
+			return nil, err
+		}
+		dep, err := pendingDepositOf(v, balance)
+		if err != nil {
+			return nil, err
+		}
+		deposits = append(deposits, dep)
+	}
+	if err := SetPendingDeposits(spec, post, deposits); err != nil {
+		return nil, err
+	}
+	// early adopters of compounding credentials go through the activation churn
+	for i := range flats {
+		index := common.ValidatorIndex(i)
+		v, err := vals.Validator(index)
+		if err != nil {
+			return nil, err
+		}
+		creds, err := v.WithdrawalCredentials()
+		if err != nil {
+			return nil, err
+		}
+		if HasCompoundingWithdrawalCredential(creds) {
+			if err := QueueExcessActiveBalance(spec, post, index); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return post, nil
+}
+
+// QueueExcessActiveBalance moves the balance of the validator above MIN_ACTIVATION_BALANCE
+// into a pending deposit, like queue_excess_active_balance.
+func QueueExcessActiveBalance(spec *common.Spec, state *electra.BeaconStateView, index common.ValidatorIndex) error {
+	bals, err := state.Balances()
+	if err != nil {
+		return err
+	}
+	balance, err := bals.GetBalance(index)
+	if err != nil {
+		return err
+	}
+	if balance <= spec.MIN_ACTIVATION_BALANCE {
+		return nil
+	}
+	if err := bals.SetBalance(index, spec.MIN_ACTIVATION_BALANCE); err != nil {
+		return err
+	}
+	vals, err := state.Validators()
+	if err != nil {
+		return err
+	}
+	v, err := vals.Validator(index)
+	if err != nil {
+		return err
+	}
+	dep, err := pendingDepositOf(v, balance-spec.MIN_ACTIVATION_BALANCE)
+	if err != nil {
+		return err
+	}
+	deposits, err := PendingDeposits(spec, state)
+	if err != nil {
+		return err
+	}
+	return SetPendingDeposits(spec, state, append(deposits, dep))
+}
+
+// pendingDepositOf creates the pending deposit of an amount to an existing validator.
+func pendingDepositOf(v common.Validator, amount common.Gwei) (common.PendingDeposit, error) {
+	pubkey, err := v.Pubkey()
+	if err != nil {
+		return common.PendingDeposit{}, err
+	}
+	creds, err := v.WithdrawalCredentials()
+	if err != nil {
+		return common.PendingDeposit{}, err
+	}
+	return common.PendingDeposit{
+		Pubkey:                pubkey,
+		WithdrawalCredentials: creds,
+		Amount:                amount,
+		Signature:             G2PointAtInfinity,
+		Slot:                  common.GENESIS_SLOT,
+	}, nil
+}
@@ -0,0 +1,201 @@
+package spec_types
+
+import (
+	"fmt"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/electra"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/ztyp/view"
+)
+
+// SignedBeaconBlock is the flat-structure signed beacon block of any phase.
+type SignedBeaconBlock interface {
+	common.EnvelopeBuilder
+	common.SpecObj
+}
+
+// Fork describes how a phase is activated in the chain config, and how to handle the states and blocks of it.
+type Fork struct {
+	Phase   string
+	Version func(spec *common.Spec) common.Version
+	Epoch   func(spec *common.Spec) common.Epoch
+	// NewState allocates a flat-structure BeaconState
+	NewState func() common.SpecObj
+	// AsStateView converts a tree-backed BeaconState into the state view of the phase
+	AsStateView func(v view.View, err error) (common.BeaconState, error)
+	// IsStateView checks if the state is a state view of the phase
+	IsStateView func(state common.BeaconState) bool
+	// NewSignedBlock allocates a flat-structure SignedBeaconBlock
+	NewSignedBlock func() SignedBeaconBlock
+	// Upgrade upgrades a state view of the previous fork to this fork, nil for the genesis fork
+	Upgrade func(spec *common.Spec, epc *common.EpochsContext, pre common.BeaconState) (common.BeaconState, error)
+}
+
+func asStateView[S common.BeaconState](fn func(v view.View, err error) (S, error)) func(v view.View, err error) (common.BeaconState, error) {
+	return func(v view.View, err error) (common.BeaconState, error) {
+		state, err := fn(v, err)
+		if err != nil {
+			return nil, err
+		}
+		return state, nil
+	}
+}
+
+func isStateView[S common.BeaconState](state common.BeaconState) bool {
+	_, ok := state.(S)
+	return ok
+}
+
+func upgrade[Pre common.BeaconState, Post common.BeaconState](fn func(spec *common.Spec, epc *common.EpochsContext, pre Pre) (Post, error)) func(spec *common.Spec, epc *common.EpochsContext, pre common.BeaconState) (common.BeaconState, error) {
+	return func(spec *common.Spec, epc *common.EpochsContext, pre common.BeaconState) (common.BeaconState, error) {
+		state, ok := pre.(Pre)
+		if !ok {
+			return nil, fmt.Errorf("cannot upgrade state of type %T", pre)
+		}
+		post, err := fn(spec, epc, state)
+		if err != nil {
+			return nil, err
+		}
+		return post, nil
+	}
+}
+
+// Forks lists the forks in activation order.
+var Forks = []Fork{
+	{
+		Phase:          "phase0",
+		Version:        func(spec *common.Spec) common.Version { return spec.GENESIS_FORK_VERSION },
+		Epoch:          func(spec *common.Spec) common.Epoch { return common.GENESIS_EPOCH },
+		NewState:       func() common.SpecObj { return new(phase0.BeaconState) },
+		AsStateView:    asStateView(phase0.AsBeaconStateView),
+		IsStateView:    isStateView[*phase0.BeaconStateView],
+		NewSignedBlock: func() SignedBeaconBlock { return new(phase0.SignedBeaconBlock) },
+	},
+	{
+		Phase:          "altair",
+		Version:        func(spec *common.Spec) common.Version { return spec.ALTAIR_FORK_VERSION },
+		Epoch:          func(spec *common.Spec) common.Epoch { return spec.ALTAIR_FORK_EPOCH },
+		NewState:       func() common.SpecObj { return new(altair.BeaconState) },
+		AsStateView:    asStateView(altair.AsBeaconStateView),
+		IsStateView:    isStateView[*altair.BeaconStateView],
+		NewSignedBlock: func() SignedBeaconBlock { return new(altair.SignedBeaconBlock) },
+		Upgrade:        upgrade(altair.UpgradeToAltair),
+	},
+	{
+		Phase:          "bellatrix",
+		Version:        func(spec *common.Spec) common.Version { return spec.BELLATRIX_FORK_VERSION },
+		Epoch:          func(spec *common.Spec) common.Epoch { return spec.BELLATRIX_FORK_EPOCH },
+		NewState:       func() common.SpecObj { return new(bellatrix.BeaconState) },
+		AsStateView:    asStateView(bellatrix.AsBeaconStateView),
+		IsStateView:    isStateView[*bellatrix.BeaconStateView],
+		NewSignedBlock: func() SignedBeaconBlock { return new(bellatrix.SignedBeaconBlock) },
+		Upgrade:        upgrade(bellatrix.UpgradeToBellatrix),
+	},
+	{
+		Phase:          "capella",
+		Version:        func(spec *common.Spec) common.Version { return spec.CAPELLA_FORK_VERSION },
+		Epoch:          func(spec *common.Spec) common.Epoch { return spec.CAPELLA_FORK_EPOCH },
+		NewState:       func() common.SpecObj { return new(capella.BeaconState) },
+		AsStateView:    asStateView(capella.AsBeaconStateView),
+		IsStateView:    isStateView[*capella.BeaconStateView],
+		NewSignedBlock: func() SignedBeaconBlock { return new(capella.SignedBeaconBlock) },
+		Upgrade:        upgrade(capella.UpgradeToCapella),
+	},
+	{
+		Phase:          "deneb",
+		Version:        func(spec *common.Spec) common.Version { return spec.DENEB_FORK_VERSION },
+		Epoch:          func(spec *common.Spec) common.Epoch { return spec.DENEB_FORK_EPOCH },
+		NewState:       func() common.SpecObj { return new(deneb.BeaconState) },
+		AsStateView:    asStateView(deneb.AsBeaconStateView),
+		IsStateView:    isStateView[*deneb.BeaconStateView],
+		NewSignedBlock: func() SignedBeaconBlock { return new(deneb.SignedBeaconBlock) },
+		Upgrade:        upgrade(deneb.UpgradeToDeneb),
+	},
+	{
+		Phase:          "electra",
+		Version:        func(spec *common.Spec) common.Version { return spec.ELECTRA_FORK_VERSION },
+		Epoch:          func(spec *common.Spec) common.Epoch { return spec.ELECTRA_FORK_EPOCH },
+		NewState:       func() common.SpecObj { return new(electra.BeaconState) },
+		AsStateView:    asStateView(electra.AsBeaconStateView),
+		IsStateView:    isStateView[*electra.BeaconStateView],
+		NewSignedBlock: func() SignedBeaconBlock { return new(electra.SignedBeaconBlock) },
+		Upgrade:        upgrade(upgradeToElectra),
+	},
+}
+
+// ForkByPhase finds the fork of the given phase.
+func ForkByPhase(phase string) (*Fork, error) {
+	for i := range Forks {
+		if Forks[i].Phase == phase {
+			return &Forks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognized phase: %s", phase)
+}
+
+// NextFork finds the fork that follows the given fork, or nil if it is the latest fork.
+func NextFork(f *Fork) *Fork {
+	for i := range Forks {
+		if &Forks[i] == f && i+1 < len(Forks) {
+			return &Forks[i+1]
+		}
+	}
+	return nil
+}
+
+// After checks if the fork activates after the other fork.
+func (f *Fork) After(other *Fork) bool {
+	for i := range Forks {
+		if &Forks[i] == f {
+			return false
+		}
+		if &Forks[i] == other {
+			return true
+		}
+	}
+	return false
+}
+
+// ForkOfState finds the fork of the given state view.
+func ForkOfState(state common.BeaconState) (*Fork, error) {
+	for i := range Forks {
+		if Forks[i].IsStateView(state) {
+			return &Forks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognized state type: %T", state)
+}
+
+// ForkAtEpoch returns the latest fork that is active at the given epoch.
+func ForkAtEpoch(spec *common.Spec, epoch common.Epoch) *Fork {
+	for i := len(Forks) - 1; i > 0; i-- {
+		if epoch >= Forks[i].Epoch(spec) {
+			return &Forks[i]
+		}
+	}
+	return &Forks[0]
+}
+
+// PhaseOfForkVersion finds the phase with the given fork version in the config.
+// If multiple phases share the version, the latest one is returned.
+func PhaseOfForkVersion(spec *common.Spec, version common.Version) (string, error) {
+	for i := len(Forks) - 1; i >= 0; i-- {
+		if Forks[i].Version(spec) == version {
+			return Forks[i].Phase, nil
+		}
+	}
+	return "", fmt.Errorf("fork version %s is not known in the config of %s", version, spec.CONFIG_NAME)
+}
+
+func forkPhases() []string {
+	out := make([]string, len(Forks))
+	for i, f := range Forks {
+		out[i] = f.Phase
+	}
+	return out
+}
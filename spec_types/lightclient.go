@@ -0,0 +1,422 @@
+package spec_types
+
+import (
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/tree"
+	. "github.com/protolambda/ztyp/view"
+)
+
+// The light-client containers of the consensus-specs that are not part of zrnt.
+// The containers are the same in every phase, except for the header type.
+
+// LightClientHeaderObj is implemented by the light-client header of each phase.
+type LightClientHeaderObj interface {
+	codec.Serializable
+	codec.Deserializable
+	codec.FixedLength
+	tree.HTR
+	BeaconHeader() *common.BeaconBlockHeader
+}
+
+// LightClientHeaderPtr constrains the light-client containers to a pointer to a header type.
+type LightClientHeaderPtr[H any] interface {
+	*H
+	LightClientHeaderObj
+}
+
+var LightClientHeaderType = ContainerType("LightClientHeader", []FieldDef{
+	{Name: "beacon", Type: common.BeaconBlockHeaderType},
+})
+
+// LightClientHeader is the light-client header of Altair and Bellatrix.
+type LightClientHeader struct {
+	Beacon common.BeaconBlockHeader `yaml:"beacon" json:"beacon"`
+}
+
+func (h *LightClientHeader) BeaconHeader() *common.BeaconBlockHeader {
+	return &h.Beacon
+}
+
+func (h *LightClientHeader) Deserialize(dr *codec.DecodingReader) error {
+	return dr.FixedLenContainer(&h.Beacon)
+}
+
+func (h *LightClientHeader) Serialize(w *codec.EncodingWriter) error {
+	return w.FixedLenContainer(&h.Beacon)
+}
+
+func (h *LightClientHeader) ByteLength() uint64 {
+	return codec.ContainerLength(&h.Beacon)
+}
+
+func (h *LightClientHeader) FixedLength() uint64 {
+	return codec.ContainerLength(&h.Beacon)
+}
+
+func (h *LightClientHeader) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(&h.Beacon)
+}
+
+// The BeaconBlockBody has 11 (Capella) or 12 (Deneb) fields, padded to 16: a depth of 4.
+const executionBranchLen = 4
+
+var ExecutionBranchType = VectorType(RootType, executionBranchLen)
+
+// ExecutionBranch proves the execution payload against the body root of the beacon block header.
+type ExecutionBranch [executionBranchLen]common.Root
+
+func (eb *ExecutionBranch) Deserialize(dr *codec.DecodingReader) error {
+	roots := eb[:]
+	return tree.ReadRoots(dr, &roots, executionBranchLen)
+}
+
+func (eb ExecutionBranch) Serialize(w *codec.EncodingWriter) error {
+	return tree.WriteRoots(w, eb[:])
+}
+
+func (eb ExecutionBranch) ByteLength() (out uint64) {
+	return executionBranchLen * 32
+}
+
+func (eb *ExecutionBranch) FixedLength() uint64 {
+	return executionBranchLen * 32
+}
+
+func (eb ExecutionBranch) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.ComplexVectorHTR(func(i uint64) tree.HTR {
+		if i < executionBranchLen {
+			return &eb[i]
+		}
+		return nil
+	}, executionBranchLen)
+}
+
+var CapellaLightClientHeaderType = ContainerType("LightClientHeader", []FieldDef{
+	{Name: "beacon", Type: common.BeaconBlockHeaderType},
+	{Name: "execution", Type: capella.ExecutionPayloadHeaderType},
+	{Name: "execution_branch", Type: ExecutionBranchType},
+})
+
+// CapellaLightClientHeader is the light-client header of Capella, with the execution payload header.
+type CapellaLightClientHeader struct {
+	Beacon          common.BeaconBlockHeader       `yaml:"beacon" json:"beacon"`
+	Execution       capella.ExecutionPayloadHeader `yaml:"execution" json:"execution"`
+	ExecutionBranch ExecutionBranch                `yaml:"execution_branch" json:"execution_branch"`
+}
+
+func (h *CapellaLightClientHeader) BeaconHeader() *common.BeaconBlockHeader {
+	return &h.Beacon
+}
+
+func (h *CapellaLightClientHeader) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&h.Beacon, &h.Execution, &h.ExecutionBranch)
+}
+
+func (h *CapellaLightClientHeader) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&h.Beacon, &h.Execution, &h.ExecutionBranch)
+}
+
+func (h *CapellaLightClientHeader) ByteLength() uint64 {
+	return codec.ContainerLength(&h.Beacon, &h.Execution, &h.ExecutionBranch)
+}
+
+func (h *CapellaLightClientHeader) FixedLength() uint64 {
+	return 0
+}
+
+func (h *CapellaLightClientHeader) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(&h.Beacon, &h.Execution, &h.ExecutionBranch)
+}
+
+var DenebLightClientHeaderType = ContainerType("LightClientHeader", []FieldDef{
+	{Name: "beacon", Type: common.BeaconBlockHeaderType},
+	{Name: "execution", Type: deneb.ExecutionPayloadHeaderType},
+	{Name: "execution_branch", Type: ExecutionBranchType},
+})
+
+// DenebLightClientHeader is the light-client header of Deneb, with the execution payload header.
+type DenebLightClientHeader struct {
+	Beacon          common.BeaconBlockHeader     `yaml:"beacon" json:"beacon"`
+	Execution       deneb.ExecutionPayloadHeader `yaml:"execution" json:"execution"`
+	ExecutionBranch ExecutionBranch              `yaml:"execution_branch" json:"execution_branch"`
+}
+
+func (h *DenebLightClientHeader) BeaconHeader() *common.BeaconBlockHeader {
+	return &h.Beacon
+}
+
+func (h *DenebLightClientHeader) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&h.Beacon, &h.Execution, &h.ExecutionBranch)
+}
+
+func (h *DenebLightClientHeader) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&h.Beacon, &h.Execution, &h.ExecutionBranch)
+}
+
+func (h *DenebLightClientHeader) ByteLength() uint64 {
+	return codec.ContainerLength(&h.Beacon, &h.Execution, &h.ExecutionBranch)
+}
+
+func (h *DenebLightClientHeader) FixedLength() uint64 {
+	return 0
+}
+
+func (h *DenebLightClientHeader) HashTreeRoot(hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(&h.Beacon, &h.Execution, &h.ExecutionBranch)
+}
+
+// fixedLength returns the fixed length of a container, or 0 if the header makes it dynamic.
+func fixedLength(header codec.FixedLength, byteLength uint64) uint64 {
+	if header.FixedLength() == 0 {
+		return 0
+	}
+	return byteLength
+}
+
+func LightClientBootstrapType(spec *common.Spec, header *ContainerTypeDef) *ContainerTypeDef {
+	return ContainerType("LightClientBootstrap", []FieldDef{
+		{Name: "header", Type: header},
+		{Name: "current_sync_committee", Type: common.SyncCommitteeType(spec)},
+		{Name: "current_sync_committee_branch", Type: altair.SyncCommitteeProofBranchType},
+	})
+}
+
+type LightClientBootstrap[H any, PH LightClientHeaderPtr[H]] struct {
+	// Header matching the requested beacon block root
+	Header H `yaml:"header" json:"header"`
+	// Current sync committee corresponding to the header state
+	CurrentSyncCommittee       common.SyncCommittee            `yaml:"current_sync_committee" json:"current_sync_committee"`
+	CurrentSyncCommitteeBranch altair.SyncCommitteeProofBranch `yaml:"current_sync_committee_branch" json:"current_sync_committee_branch"`
+}
+
+func (b *LightClientBootstrap[H, PH]) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.Container(
+		PH(&b.Header),
+		spec.Wrap(&b.CurrentSyncCommittee),
+		&b.CurrentSyncCommitteeBranch,
+	)
+}
+
+func (b *LightClientBootstrap[H, PH]) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	return w.Container(
+		PH(&b.Header),
+		spec.Wrap(&b.CurrentSyncCommittee),
+		&b.CurrentSyncCommitteeBranch,
+	)
+}
+
+func (b *LightClientBootstrap[H, PH]) ByteLength(spec *common.Spec) uint64 {
+	return codec.ContainerLength(
+		PH(&b.Header),
+		spec.Wrap(&b.CurrentSyncCommittee),
+		&b.CurrentSyncCommitteeBranch,
+	)
+}
+
+func (b *LightClientBootstrap[H, PH]) FixedLength(spec *common.Spec) uint64 {
+	return fixedLength(PH(&b.Header), b.ByteLength(spec))
+}
+
+func (b *LightClientBootstrap[H, PH]) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(
+		PH(&b.Header),
+		spec.Wrap(&b.CurrentSyncCommittee),
+		&b.CurrentSyncCommitteeBranch,
+	)
+}
+
+func LightClientUpdateType(spec *common.Spec, header *ContainerTypeDef) *ContainerTypeDef {
+	return ContainerType("LightClientUpdate", []FieldDef{
+		{Name: "attested_header", Type: header},
+		{Name: "next_sync_committee", Type: common.SyncCommitteeType(spec)},
+		{Name: "next_sync_committee_branch", Type: altair.SyncCommitteeProofBranchType},
+		{Name: "finalized_header", Type: header},
+		{Name: "finality_branch", Type: altair.FinalizedRootProofBranchType},
+		{Name: "sync_aggregate", Type: altair.SyncAggregateType(spec)},
+		{Name: "signature_slot", Type: common.SlotType},
+	})
+}
+
+type LightClientUpdate[H any, PH LightClientHeaderPtr[H]] struct {
+	// Header attested to by the sync committee
+	AttestedHeader H `yaml:"attested_header" json:"attested_header"`
+	// Next sync committee corresponding to the attested header
+	NextSyncCommittee       common.SyncCommittee            `yaml:"next_sync_committee" json:"next_sync_committee"`
+	NextSyncCommitteeBranch altair.SyncCommitteeProofBranch `yaml:"next_sync_committee_branch" json:"next_sync_committee_branch"`
+	// Finalized header corresponding to the attested header
+	FinalizedHeader H                               `yaml:"finalized_header" json:"finalized_header"`
+	FinalityBranch  altair.FinalizedRootProofBranch `yaml:"finality_branch" json:"finality_branch"`
+	// Sync committee aggregate signature
+	SyncAggregate altair.SyncAggregate `yaml:"sync_aggregate" json:"sync_aggregate"`
+	// Slot at which the aggregate signature was created (untrusted)
+	SignatureSlot common.Slot `yaml:"signature_slot" json:"signature_slot"`
+}
+
+func (u *LightClientUpdate[H, PH]) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.Container(
+		PH(&u.AttestedHeader),
+		spec.Wrap(&u.NextSyncCommittee),
+		&u.NextSyncCommitteeBranch,
+		PH(&u.FinalizedHeader),
+		&u.FinalityBranch,
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	)
+}
+
+func (u *LightClientUpdate[H, PH]) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	return w.Container(
+		PH(&u.AttestedHeader),
+		spec.Wrap(&u.NextSyncCommittee),
+		&u.NextSyncCommitteeBranch,
+		PH(&u.FinalizedHeader),
+		&u.FinalityBranch,
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	)
+}
+
+func (u *LightClientUpdate[H, PH]) ByteLength(spec *common.Spec) uint64 {
+	return codec.ContainerLength(
+		PH(&u.AttestedHeader),
+		spec.Wrap(&u.NextSyncCommittee),
+		&u.NextSyncCommitteeBranch,
+		PH(&u.FinalizedHeader),
+		&u.FinalityBranch,
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	)
+}
+
+func (u *LightClientUpdate[H, PH]) FixedLength(spec *common.Spec) uint64 {
+	return fixedLength(PH(&u.AttestedHeader), u.ByteLength(spec))
+}
+
+func (u *LightClientUpdate[H, PH]) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(
+		PH(&u.AttestedHeader),
+		spec.Wrap(&u.NextSyncCommittee),
+		&u.NextSyncCommitteeBranch,
+		PH(&u.FinalizedHeader),
+		&u.FinalityBranch,
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	)
+}
+
+func LightClientFinalityUpdateType(spec *common.Spec, header *ContainerTypeDef) *ContainerTypeDef {
+	return ContainerType("LightClientFinalityUpdate", []FieldDef{
+		{Name: "attested_header", Type: header},
+		{Name: "finalized_header", Type: header},
+		{Name: "finality_branch", Type: altair.FinalizedRootProofBranchType},
+		{Name: "sync_aggregate", Type: altair.SyncAggregateType(spec)},
+		{Name: "signature_slot", Type: common.SlotType},
+	})
+}
+
+type LightClientFinalityUpdate[H any, PH LightClientHeaderPtr[H]] struct {
+	AttestedHeader  H                               `yaml:"attested_header" json:"attested_header"`
+	FinalizedHeader H                               `yaml:"finalized_header" json:"finalized_header"`
+	FinalityBranch  altair.FinalizedRootProofBranch `yaml:"finality_branch" json:"finality_branch"`
+	SyncAggregate   altair.SyncAggregate            `yaml:"sync_aggregate" json:"sync_aggregate"`
+	SignatureSlot   common.Slot                     `yaml:"signature_slot" json:"signature_slot"`
+}
+
+func (u *LightClientFinalityUpdate[H, PH]) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.Container(
+		PH(&u.AttestedHeader),
+		PH(&u.FinalizedHeader),
+		&u.FinalityBranch,
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	)
+}
+
+func (u *LightClientFinalityUpdate[H, PH]) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	return w.Container(
+		PH(&u.AttestedHeader),
+		PH(&u.FinalizedHeader),
+		&u.FinalityBranch,
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	)
+}
+
+func (u *LightClientFinalityUpdate[H, PH]) ByteLength(spec *common.Spec) uint64 {
+	return codec.ContainerLength(
+		PH(&u.AttestedHeader),
+		PH(&u.FinalizedHeader),
+		&u.FinalityBranch,
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	)
+}
+
+func (u *LightClientFinalityUpdate[H, PH]) FixedLength(spec *common.Spec) uint64 {
+	return fixedLength(PH(&u.AttestedHeader), u.ByteLength(spec))
+}
+
+func (u *LightClientFinalityUpdate[H, PH]) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(
+		PH(&u.AttestedHeader),
+		PH(&u.FinalizedHeader),
+		&u.FinalityBranch,
+		spec.Wrap(&u.SyncAggregate),
+		&u.SignatureSlot,
+	)
+}
+
+func LightClientOptimisticUpdateType(spec *common.Spec, header *ContainerTypeDef) *ContainerTypeDef {
+	return ContainerType("LightClientOptimisticUpdate", []FieldDef{
+		{Name: "attested_header", Type: header},
+		{Name: "sync_aggregate", Type: altair.SyncAggregateType(spec)},
+		{Name: "signature_slot", Type: common.SlotType},
+	})
+}
+
+type LightClientOptimisticUpdate[H any, PH LightClientHeaderPtr[H]] struct {
+	AttestedHeader H                    `yaml:"attested_header" json:"attested_header"`
+	SyncAggregate  altair.SyncAggregate `yaml:"sync_aggregate" json:"sync_aggregate"`
+	SignatureSlot  common.Slot          `yaml:"signature_slot" json:"signature_slot"`
+}
+
+func (u *LightClientOptimisticUpdate[H, PH]) Deserialize(spec *common.Spec, dr *codec.DecodingReader) error {
+	return dr.Container(PH(&u.AttestedHeader), spec.Wrap(&u.SyncAggregate), &u.SignatureSlot)
+}
+
+func (u *LightClientOptimisticUpdate[H, PH]) Serialize(spec *common.Spec, w *codec.EncodingWriter) error {
+	return w.Container(PH(&u.AttestedHeader), spec.Wrap(&u.SyncAggregate), &u.SignatureSlot)
+}
+
+func (u *LightClientOptimisticUpdate[H, PH]) ByteLength(spec *common.Spec) uint64 {
+	return codec.ContainerLength(PH(&u.AttestedHeader), spec.Wrap(&u.SyncAggregate), &u.SignatureSlot)
+}
+
+func (u *LightClientOptimisticUpdate[H, PH]) FixedLength(spec *common.Spec) uint64 {
+	return fixedLength(PH(&u.AttestedHeader), u.ByteLength(spec))
+}
+
+func (u *LightClientOptimisticUpdate[H, PH]) HashTreeRoot(spec *common.Spec, hFn tree.HashFn) common.Root {
+	return hFn.HashTreeRoot(PH(&u.AttestedHeader), spec.Wrap(&u.SyncAggregate), &u.SignatureSlot)
+}
+
+type (
+	AltairLightClientBootstrap        = LightClientBootstrap[LightClientHeader, *LightClientHeader]
+	AltairLightClientUpdate           = LightClientUpdate[LightClientHeader, *LightClientHeader]
+	AltairLightClientFinalityUpdate   = LightClientFinalityUpdate[LightClientHeader, *LightClientHeader]
+	AltairLightClientOptimisticUpdate = LightClientOptimisticUpdate[LightClientHeader, *LightClientHeader]
+
+	CapellaLightClientBootstrap        = LightClientBootstrap[CapellaLightClientHeader, *CapellaLightClientHeader]
+	CapellaLightClientUpdate           = LightClientUpdate[CapellaLightClientHeader, *CapellaLightClientHeader]
+	CapellaLightClientFinalityUpdate   = LightClientFinalityUpdate[CapellaLightClientHeader, *CapellaLightClientHeader]
+	CapellaLightClientOptimisticUpdate = LightClientOptimisticUpdate[CapellaLightClientHeader, *CapellaLightClientHeader]
+
+	DenebLightClientBootstrap        = LightClientBootstrap[DenebLightClientHeader, *DenebLightClientHeader]
+	DenebLightClientUpdate           = LightClientUpdate[DenebLightClientHeader, *DenebLightClientHeader]
+	DenebLightClientFinalityUpdate   = LightClientFinalityUpdate[DenebLightClientHeader, *DenebLightClientHeader]
+	DenebLightClientOptimisticUpdate = LightClientOptimisticUpdate[DenebLightClientHeader, *DenebLightClientHeader]
+)
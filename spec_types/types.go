@@ -8,6 +8,7 @@ import (
 	"github.com/protolambda/zrnt/eth2/beacon/capella"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
 	"github.com/protolambda/zrnt/eth2/beacon/deneb"
+	"github.com/protolambda/zrnt/eth2/beacon/electra"
 	"github.com/protolambda/zrnt/eth2/beacon/phase0"
 	"github.com/protolambda/ztyp/view"
 )
@@ -21,7 +22,7 @@ var Phase0SpecTypes = map[string]SpecType{
 	"BeaconState":             {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(phase0.BeaconState)) }, func(spec *common.Spec) view.TypeDef { return phase0.BeaconStateType(spec) }},
 	"BeaconBlock":             {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(phase0.BeaconBlock)) }, func(spec *common.Spec) view.TypeDef { return phase0.BeaconBlockType(spec) }},
 	"BeaconBlockHeader":       {func(spec *common.Spec) common.SSZObj { return new(common.BeaconBlockHeader) }, func(spec *common.Spec) view.TypeDef { return common.BeaconBlockHeaderType }},
-	"SignedBeaconBlock":       {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(phase0.SignedBeaconBlock)) }, func(spec *common.Spec) view.TypeDef { return phase0.BeaconStateType(spec) }},
+	"SignedBeaconBlock":       {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(phase0.SignedBeaconBlock)) }, func(spec *common.Spec) view.TypeDef { return phase0.SignedBeaconBlockType(spec) }},
 	"SignedBeaconBlockHeader": {func(spec *common.Spec) common.SSZObj { return new(common.SignedBeaconBlockHeader) }, func(spec *common.Spec) view.TypeDef { return common.SignedBeaconBlockHeaderType }},
 	"BeaconBlockBody":         {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(phase0.BeaconBlockBody)) }, func(spec *common.Spec) view.TypeDef { return phase0.BeaconBlockBodyType(spec) }},
 
@@ -97,8 +98,16 @@ var AltairSpecTypes = map[string]SpecType{
 	"BLSPubkey":      {func(spec *common.Spec) common.SSZObj { return new(common.BLSPubkey) }, func(spec *common.Spec) view.TypeDef { return common.BLSPubkeyType }},
 	"BLSSignature":   {func(spec *common.Spec) common.SSZObj { return new(common.BLSSignature) }, func(spec *common.Spec) view.TypeDef { return common.BLSSignatureType }},
 
-	"LightClientSnapshot": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientSnapshot)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientSnapshotType(spec) }},
-	"LightClientUpdate":   {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientUpdate)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientUpdateType(spec) }},
+	"LightClientSnapshot":  {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientSnapshot)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientSnapshotType(spec) }},
+	"LightClientHeader":    {func(spec *common.Spec) common.SSZObj { return new(LightClientHeader) }, func(spec *common.Spec) view.TypeDef { return LightClientHeaderType }},
+	"LightClientBootstrap": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(AltairLightClientBootstrap)) }, func(spec *common.Spec) view.TypeDef { return LightClientBootstrapType(spec, LightClientHeaderType) }},
+	"LightClientUpdate":    {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(AltairLightClientUpdate)) }, func(spec *common.Spec) view.TypeDef { return LightClientUpdateType(spec, LightClientHeaderType) }},
+	"LightClientFinalityUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(AltairLightClientFinalityUpdate)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientFinalityUpdateType(spec, LightClientHeaderType)
+	}},
+	"LightClientOptimisticUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(AltairLightClientOptimisticUpdate)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientOptimisticUpdateType(spec, LightClientHeaderType)
+	}},
 
 	"SyncAggregate":               {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.SyncAggregate)) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregateType(spec) }},
 	"SyncAggregatorSelectionData": {func(spec *common.Spec) common.SSZObj { return new(altair.SyncAggregatorSelectionData) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregatorSelectionDataType }},
@@ -148,8 +157,16 @@ var bellatrixSpecTypes = map[string]SpecType{
 	"BLSPubkey":      {func(spec *common.Spec) common.SSZObj { return new(common.BLSPubkey) }, func(spec *common.Spec) view.TypeDef { return common.BLSPubkeyType }},
 	"BLSSignature":   {func(spec *common.Spec) common.SSZObj { return new(common.BLSSignature) }, func(spec *common.Spec) view.TypeDef { return common.BLSSignatureType }},
 
-	"LightClientSnapshot": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientSnapshot)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientSnapshotType(spec) }},
-	"LightClientUpdate":   {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientUpdate)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientUpdateType(spec) }},
+	"LightClientSnapshot":  {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientSnapshot)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientSnapshotType(spec) }},
+	"LightClientHeader":    {func(spec *common.Spec) common.SSZObj { return new(LightClientHeader) }, func(spec *common.Spec) view.TypeDef { return LightClientHeaderType }},
+	"LightClientBootstrap": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(AltairLightClientBootstrap)) }, func(spec *common.Spec) view.TypeDef { return LightClientBootstrapType(spec, LightClientHeaderType) }},
+	"LightClientUpdate":    {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(AltairLightClientUpdate)) }, func(spec *common.Spec) view.TypeDef { return LightClientUpdateType(spec, LightClientHeaderType) }},
+	"LightClientFinalityUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(AltairLightClientFinalityUpdate)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientFinalityUpdateType(spec, LightClientHeaderType)
+	}},
+	"LightClientOptimisticUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(AltairLightClientOptimisticUpdate)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientOptimisticUpdateType(spec, LightClientHeaderType)
+	}},
 
 	"SyncAggregate":               {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.SyncAggregate)) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregateType(spec) }},
 	"SyncAggregatorSelectionData": {func(spec *common.Spec) common.SSZObj { return new(altair.SyncAggregatorSelectionData) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregatorSelectionDataType }},
@@ -205,7 +222,17 @@ var capellaSpecTypes = map[string]SpecType{
 	"BLSSignature":   {func(spec *common.Spec) common.SSZObj { return new(common.BLSSignature) }, func(spec *common.Spec) view.TypeDef { return common.BLSSignatureType }},
 
 	"LightClientSnapshot": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientSnapshot)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientSnapshotType(spec) }},
-	"LightClientUpdate":   {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientUpdate)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientUpdateType(spec) }},
+	"LightClientHeader":   {func(spec *common.Spec) common.SSZObj { return new(CapellaLightClientHeader) }, func(spec *common.Spec) view.TypeDef { return CapellaLightClientHeaderType }},
+	"LightClientBootstrap": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(CapellaLightClientBootstrap)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientBootstrapType(spec, CapellaLightClientHeaderType)
+	}},
+	"LightClientUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(CapellaLightClientUpdate)) }, func(spec *common.Spec) view.TypeDef { return LightClientUpdateType(spec, CapellaLightClientHeaderType) }},
+	"LightClientFinalityUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(CapellaLightClientFinalityUpdate)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientFinalityUpdateType(spec, CapellaLightClientHeaderType)
+	}},
+	"LightClientOptimisticUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(CapellaLightClientOptimisticUpdate)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientOptimisticUpdateType(spec, CapellaLightClientHeaderType)
+	}},
 
 	"SyncAggregate":               {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.SyncAggregate)) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregateType(spec) }},
 	"SyncAggregatorSelectionData": {func(spec *common.Spec) common.SSZObj { return new(altair.SyncAggregatorSelectionData) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregatorSelectionDataType }},
@@ -265,7 +292,77 @@ var denebSpecTypes = map[string]SpecType{
 	"BLSSignature":   {func(spec *common.Spec) common.SSZObj { return new(common.BLSSignature) }, func(spec *common.Spec) view.TypeDef { return common.BLSSignatureType }},
 
 	"LightClientSnapshot": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientSnapshot)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientSnapshotType(spec) }},
-	"LightClientUpdate":   {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientUpdate)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientUpdateType(spec) }},
+	"LightClientHeader":   {func(spec *common.Spec) common.SSZObj { return new(DenebLightClientHeader) }, func(spec *common.Spec) view.TypeDef { return DenebLightClientHeaderType }},
+	"LightClientBootstrap": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(DenebLightClientBootstrap)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientBootstrapType(spec, DenebLightClientHeaderType)
+	}},
+	"LightClientUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(DenebLightClientUpdate)) }, func(spec *common.Spec) view.TypeDef { return LightClientUpdateType(spec, DenebLightClientHeaderType) }},
+	"LightClientFinalityUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(DenebLightClientFinalityUpdate)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientFinalityUpdateType(spec, DenebLightClientHeaderType)
+	}},
+	"LightClientOptimisticUpdate": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(DenebLightClientOptimisticUpdate)) }, func(spec *common.Spec) view.TypeDef {
+		return LightClientOptimisticUpdateType(spec, DenebLightClientHeaderType)
+	}},
+
+	"SyncAggregate":               {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.SyncAggregate)) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregateType(spec) }},
+	"SyncAggregatorSelectionData": {func(spec *common.Spec) common.SSZObj { return new(altair.SyncAggregatorSelectionData) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregatorSelectionDataType }},
+	"SyncCommitteeContribution":   {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.SyncCommitteeContribution)) }, func(spec *common.Spec) view.TypeDef { return altair.SyncCommitteeContributionType(spec) }},
+	"ContributionAndProof":        {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.ContributionAndProof)) }, func(spec *common.Spec) view.TypeDef { return altair.ContributionAndProofType(spec) }},
+	"SignedContributionAndProof":  {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.SignedContributionAndProof)) }, func(spec *common.Spec) view.TypeDef { return altair.SignedContributionAndProofType(spec) }},
+	"SyncCommitteeMessage":        {func(spec *common.Spec) common.SSZObj { return new(altair.SyncCommitteeMessage) }, func(spec *common.Spec) view.TypeDef { return altair.SyncCommitteeMessageType }},
+	"SyncCommittee":               {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(common.SyncCommittee)) }, func(spec *common.Spec) view.TypeDef { return common.SyncCommitteeType(spec) }},
+
+	"ExecutionPayload":       {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(deneb.ExecutionPayload)) }, func(spec *common.Spec) view.TypeDef { return deneb.ExecutionPayloadType(spec) }},
+	"ExecutionPayloadHeader": {func(spec *common.Spec) common.SSZObj { return new(deneb.ExecutionPayloadHeader) }, func(spec *common.Spec) view.TypeDef { return deneb.ExecutionPayloadHeaderType }},
+	"PayloadTransactions":    {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(common.PayloadTransactions)) }, func(spec *common.Spec) view.TypeDef { return common.PayloadTransactionsType(spec) }},
+	"LogsBloom":              {func(spec *common.Spec) common.SSZObj { return new(common.LogsBloom) }, func(spec *common.Spec) view.TypeDef { return common.LogsBloomType }},
+
+	"Withdrawal":                 {func(spec *common.Spec) common.SSZObj { return new(common.Withdrawal) }, func(spec *common.Spec) view.TypeDef { return common.WithdrawalType }},
+	"BLSToExecutionChange":       {func(spec *common.Spec) common.SSZObj { return new(common.BLSToExecutionChange) }, func(spec *common.Spec) view.TypeDef { return common.BLSToExecutionChangeType }},
+	"SignedBLSToExecutionChange": {func(spec *common.Spec) common.SSZObj { return new(common.SignedBLSToExecutionChange) }, func(spec *common.Spec) view.TypeDef { return common.SignedBLSToExecutionChangeType }},
+}
+
+var electraSpecTypes = map[string]SpecType{
+	"BeaconState":             {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(electra.BeaconState)) }, func(spec *common.Spec) view.TypeDef { return electra.BeaconStateType(spec) }},
+	"BeaconBlock":             {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(electra.BeaconBlock)) }, func(spec *common.Spec) view.TypeDef { return electra.BeaconBlockType(spec) }},
+	"BeaconBlockHeader":       {func(spec *common.Spec) common.SSZObj { return new(common.BeaconBlockHeader) }, func(spec *common.Spec) view.TypeDef { return common.BeaconBlockHeaderType }},
+	"SignedBeaconBlock":       {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(electra.SignedBeaconBlock)) }, func(spec *common.Spec) view.TypeDef { return electra.SignedBeaconBlockType(spec) }},
+	"SignedBeaconBlockHeader": {func(spec *common.Spec) common.SSZObj { return new(common.SignedBeaconBlockHeader) }, func(spec *common.Spec) view.TypeDef { return common.SignedBeaconBlockHeaderType }},
+	"BeaconBlockBody":         {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(electra.BeaconBlockBody)) }, func(spec *common.Spec) view.TypeDef { return electra.BeaconBlockBodyType(spec) }},
+
+	"AttestationData":     {func(spec *common.Spec) common.SSZObj { return new(phase0.AttestationData) }, func(spec *common.Spec) view.TypeDef { return phase0.AttestationDataType }},
+	"Attestation":         {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(electra.Attestation)) }, func(spec *common.Spec) view.TypeDef { return electra.AttestationType(spec) }},
+	"AttesterSlashing":    {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(electra.AttesterSlashing)) }, func(spec *common.Spec) view.TypeDef { return electra.AttesterSlashingType(spec) }},
+	"ProposerSlashing":    {func(spec *common.Spec) common.SSZObj { return new(phase0.ProposerSlashing) }, func(spec *common.Spec) view.TypeDef { return phase0.ProposerSlashingType }},
+	"Deposit":             {func(spec *common.Spec) common.SSZObj { return new(common.Deposit) }, func(spec *common.Spec) view.TypeDef { return common.DepositType }},
+	"DepositData":         {func(spec *common.Spec) common.SSZObj { return new(common.DepositData) }, func(spec *common.Spec) view.TypeDef { return common.DepositDataType }},
+	"DepositMessage":      {func(spec *common.Spec) common.SSZObj { return new(common.DepositMessage) }, func(spec *common.Spec) view.TypeDef { return common.DepositMessageType }},
+	"VoluntaryExit":       {func(spec *common.Spec) common.SSZObj { return new(phase0.VoluntaryExit) }, func(spec *common.Spec) view.TypeDef { return phase0.VoluntaryExitType }},
+	"SignedVoluntaryExit": {func(spec *common.Spec) common.SSZObj { return new(phase0.SignedVoluntaryExit) }, func(spec *common.Spec) view.TypeDef { return phase0.SignedVoluntaryExitType }},
+	"Eth1Data":            {func(spec *common.Spec) common.SSZObj { return new(common.Eth1Data) }, func(spec *common.Spec) view.TypeDef { return common.Eth1DataType }},
+	"ForkData":            {func(spec *common.Spec) common.SSZObj { return new(common.ForkData) }, func(spec *common.Spec) view.TypeDef { return common.ForkDataType }},
+	"Fork":                {func(spec *common.Spec) common.SSZObj { return new(common.Fork) }, func(spec *common.Spec) view.TypeDef { return common.ForkType }},
+	"Checkpoint":          {func(spec *common.Spec) common.SSZObj { return new(common.Checkpoint) }, func(spec *common.Spec) view.TypeDef { return common.CheckpointType }},
+	"Validator":           {func(spec *common.Spec) common.SSZObj { return new(phase0.Validator) }, func(spec *common.Spec) view.TypeDef { return phase0.ValidatorType }},
+	"IndexedAttestation":  {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(electra.IndexedAttestation)) }, func(spec *common.Spec) view.TypeDef { return electra.IndexedAttestationType(spec) }},
+
+	"SigningData":    {func(spec *common.Spec) common.SSZObj { return new(common.SigningData) }, func(spec *common.Spec) view.TypeDef { return common.SigningDataType }},
+	"Slot":           {func(spec *common.Spec) common.SSZObj { return new(common.Slot) }, func(spec *common.Spec) view.TypeDef { return common.SlotType }},
+	"Epoch":          {func(spec *common.Spec) common.SSZObj { return new(common.Epoch) }, func(spec *common.Spec) view.TypeDef { return common.EpochType }},
+	"CommitteeIndex": {func(spec *common.Spec) common.SSZObj { return new(common.CommitteeIndex) }, func(spec *common.Spec) view.TypeDef { return common.CommitteeIndexType }},
+	"ValidatorIndex": {func(spec *common.Spec) common.SSZObj { return new(common.ValidatorIndex) }, func(spec *common.Spec) view.TypeDef { return common.ValidatorIndexType }},
+	"Gwei":           {func(spec *common.Spec) common.SSZObj { return new(common.Gwei) }, func(spec *common.Spec) view.TypeDef { return common.GweiType }},
+	"Root":           {func(spec *common.Spec) common.SSZObj { return new(common.Root) }, func(spec *common.Spec) view.TypeDef { return view.RootType }},
+	"Hash32":         {func(spec *common.Spec) common.SSZObj { return new(common.Hash32) }, func(spec *common.Spec) view.TypeDef { return common.Hash32Type }},
+	"Version":        {func(spec *common.Spec) common.SSZObj { return new(common.Version) }, func(spec *common.Spec) view.TypeDef { return common.VersionType }},
+	"DomainType":     {func(spec *common.Spec) common.SSZObj { return new(common.BLSDomainType) }, func(spec *common.Spec) view.TypeDef { return common.BLSDomainTypeTreeType }},
+	"ForkDigest":     {func(spec *common.Spec) common.SSZObj { return new(common.ForkDigest) }, func(spec *common.Spec) view.TypeDef { return common.ForkDigestType }},
+	"Domain":         {func(spec *common.Spec) common.SSZObj { return new(common.BLSDomain) }, func(spec *common.Spec) view.TypeDef { return common.BLSDomainTreeType }},
+	"BLSPubkey":      {func(spec *common.Spec) common.SSZObj { return new(common.BLSPubkey) }, func(spec *common.Spec) view.TypeDef { return common.BLSPubkeyType }},
+	"BLSSignature":   {func(spec *common.Spec) common.SSZObj { return new(common.BLSSignature) }, func(spec *common.Spec) view.TypeDef { return common.BLSSignatureType }},
+
+	"LightClientSnapshot": {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.LightClientSnapshot)) }, func(spec *common.Spec) view.TypeDef { return altair.LightClientSnapshotType(spec) }},
+	"LightClientHeader":   {func(spec *common.Spec) common.SSZObj { return new(DenebLightClientHeader) }, func(spec *common.Spec) view.TypeDef { return DenebLightClientHeaderType }},
 
 	"SyncAggregate":               {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(altair.SyncAggregate)) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregateType(spec) }},
 	"SyncAggregatorSelectionData": {func(spec *common.Spec) common.SSZObj { return new(altair.SyncAggregatorSelectionData) }, func(spec *common.Spec) view.TypeDef { return altair.SyncAggregatorSelectionDataType }},
@@ -283,6 +380,15 @@ var denebSpecTypes = map[string]SpecType{
 	"Withdrawal":                 {func(spec *common.Spec) common.SSZObj { return new(common.Withdrawal) }, func(spec *common.Spec) view.TypeDef { return common.WithdrawalType }},
 	"BLSToExecutionChange":       {func(spec *common.Spec) common.SSZObj { return new(common.BLSToExecutionChange) }, func(spec *common.Spec) view.TypeDef { return common.BLSToExecutionChangeType }},
 	"SignedBLSToExecutionChange": {func(spec *common.Spec) common.SSZObj { return new(common.SignedBLSToExecutionChange) }, func(spec *common.Spec) view.TypeDef { return common.SignedBLSToExecutionChangeType }},
+
+	"SingleAttestation":        {func(spec *common.Spec) common.SSZObj { return new(electra.SingleAttestation) }, func(spec *common.Spec) view.TypeDef { return electra.SingleAttestationType }},
+	"ExecutionRequests":        {func(spec *common.Spec) common.SSZObj { return spec.Wrap(new(electra.ExecutionRequests)) }, func(spec *common.Spec) view.TypeDef { return electra.ExecutionRequestsType(spec) }},
+	"DepositRequest":           {func(spec *common.Spec) common.SSZObj { return new(common.DepositRequest) }, func(spec *common.Spec) view.TypeDef { return common.DepositRequestType }},
+	"WithdrawalRequest":        {func(spec *common.Spec) common.SSZObj { return new(common.WithdrawalRequest) }, func(spec *common.Spec) view.TypeDef { return common.WithdrawalRequestType }},
+	"ConsolidationRequest":     {func(spec *common.Spec) common.SSZObj { return new(common.ConsolidationRequest) }, func(spec *common.Spec) view.TypeDef { return common.ConsolidationRequestType }},
+	"PendingDeposit":           {func(spec *common.Spec) common.SSZObj { return new(common.PendingDeposit) }, func(spec *common.Spec) view.TypeDef { return common.PendingDepositType }},
+	"PendingPartialWithdrawal": {func(spec *common.Spec) common.SSZObj { return new(common.PendingPartialWithdrawal) }, func(spec *common.Spec) view.TypeDef { return common.PendingPartialWithdrawalType }},
+	"PendingConsolidation":     {func(spec *common.Spec) common.SSZObj { return new(common.PendingConsolidation) }, func(spec *common.Spec) view.TypeDef { return common.PendingConsolidationType }},
 }
 
 var TypesByPhase = map[string]map[string]SpecType{
@@ -291,9 +397,11 @@ var TypesByPhase = map[string]map[string]SpecType{
 	"bellatrix": bellatrixSpecTypes,
 	"capella":   capellaSpecTypes,
 	"deneb":     denebSpecTypes,
+	"electra":   electraSpecTypes,
 }
 
-var Phases = []string{"phase0", "altair", "bellatrix", "capella", "deneb"}
+// Phases lists the names of the forks, in activation order
+var Phases = forkPhases()
 
 func TypeNames(types map[string]SpecType) []string {
 	out := make([]string, 0, len(types))
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/protolambda/zcli/spec_types"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"gopkg.in/yaml.v3"
+)
+
+// AutoPhase can be used in place of a phase name, to detect the phase from the input.
+const AutoPhase = "auto"
+
+// AutoTypeNames are the types that DetectPhase supports.
+var AutoTypeNames = []string{"BeaconBlock", "BeaconState", "SignedBeaconBlock"}
+
+// The fork.current_version of a BeaconState is at the same SSZ offset in every phase:
+// after genesis_time (8), genesis_validators_root (32), slot (8) and fork.previous_version (4).
+const stateForkVersionOffset = 8 + 32 + 8 + 4
+
+// DetectPhase detects the phase of a BeaconState from its fork version,
+// and the phase of a BeaconBlock or SignedBeaconBlock from its slot, using the fork config of the spec.
+// The format is "ssz", "json" or "yaml".
+func DetectPhase(spec *common.Spec, typeName string, format string, data []byte) (string, error) {
+	switch typeName {
+	case "BeaconState":
+		var version common.Version
+		if format == "ssz" {
+			if len(data) < stateForkVersionOffset+4 {
+				return "", fmt.Errorf("input of %d bytes is too short to be a BeaconState", len(data))
+			}
+			copy(version[:], data[stateForkVersionOffset:stateForkVersionOffset+4])
+		} else {
+			var partial struct {
+				Fork struct {
+					CurrentVersion common.Version `json:"current_version" yaml:"current_version"`
+				} `json:"fork" yaml:"fork"`
+			}
+			if err := decodeText(format, data, &partial); err != nil {
+				return "", fmt.Errorf("failed to decode fork of BeaconState: %v", err)
+			}
+			version = partial.Fork.CurrentVersion
+		}
+		phase, err := spec_types.PhaseOfForkVersion(spec, version)
+		if err != nil {
+			return "", fmt.Errorf("cannot detect phase of BeaconState: %v", err)
+		}
+		return phase, nil
+	case "BeaconBlock", "SignedBeaconBlock":
+		slot, err := BlockSlot(typeName, format, data)
+		if err != nil {
+			return "", err
+		}
+		return spec_types.ForkAtEpoch(spec, spec.SlotToEpoch(slot)).Phase, nil
+	default:
+		return "", fmt.Errorf("cannot detect the phase of a %s, only of %v", typeName, AutoTypeNames)
+	}
+}
+
+// BlockSlot reads the slot of a BeaconBlock or SignedBeaconBlock, without decoding the rest of it.
+// The format is "ssz", "json" or "yaml".
+func BlockSlot(typeName string, format string, data []byte) (common.Slot, error) {
+	if typeName != "BeaconBlock" && typeName != "SignedBeaconBlock" {
+		return 0, fmt.Errorf("cannot read the slot of a %s", typeName)
+	}
+	var slot common.Slot
+	if format == "ssz" {
+		offset := uint64(0)
+		if typeName == "SignedBeaconBlock" {
+			// the message is variable-size, the first 4 bytes are the offset of it
+			if len(data) < 4 {
+				return 0, fmt.Errorf("input of %d bytes is too short to be a SignedBeaconBlock", len(data))
+			}
+			offset = uint64(binary.LittleEndian.Uint32(data[:4]))
+		}
+		if uint64(len(data)) < offset+8 {
+			return 0, fmt.Errorf("input of %d bytes is too short to be a %s", len(data), typeName)
+		}
+		slot = common.Slot(binary.LittleEndian.Uint64(data[offset : offset+8]))
+	} else if typeName == "SignedBeaconBlock" {
+		var partial struct {
+			Message struct {
+				Slot common.Slot `json:"slot" yaml:"slot"`
+			} `json:"message" yaml:"message"`
+		}
+		if err := decodeText(format, data, &partial); err != nil {
+			return 0, fmt.Errorf("failed to decode slot of SignedBeaconBlock: %v", err)
+		}
+		slot = partial.Message.Slot
+	} else {
+		var partial struct {
+			Slot common.Slot `json:"slot" yaml:"slot"`
+		}
+		if err := decodeText(format, data, &partial); err != nil {
+			return 0, fmt.Errorf("failed to decode slot of BeaconBlock: %v", err)
+		}
+		slot = partial.Slot
+	}
+	return slot, nil
+}
+
+func decodeText(format string, data []byte, dest interface{}) error {
+	if format == "json" {
+		return json.Unmarshal(data, dest)
+	}
+	return yaml.Unmarshal(data, dest)
+}
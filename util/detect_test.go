@@ -0,0 +1,89 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/altair"
+	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/beacon/phase0"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+)
+
+func TestDetectPhase(t *testing.T) {
+	spec := configs.Mainnet
+	type serializable interface {
+		Serialize(w *codec.EncodingWriter) error
+	}
+	encode := func(obj serializable) []byte {
+		var buf bytes.Buffer
+		if err := obj.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	state := func(s interface {
+		serializable
+		SetFork(f common.Fork) error
+	}, version common.Version) []byte {
+		if err := s.SetFork(common.Fork{CurrentVersion: version}); err != nil {
+			t.Fatal(err)
+		}
+		return encode(s)
+	}
+	block := func(slot common.Slot) []byte {
+		return encode(spec.Wrap(&phase0.SignedBeaconBlock{Message: phase0.BeaconBlock{Slot: slot}}))
+	}
+	altairSlot := common.Slot(spec.ALTAIR_FORK_EPOCH) * spec.SLOTS_PER_EPOCH
+	capellaSlot := common.Slot(spec.CAPELLA_FORK_EPOCH) * spec.SLOTS_PER_EPOCH
+
+	cases := []struct {
+		name     string
+		typeName string
+		format   string
+		data     []byte
+		want     string
+		err      string
+	}{
+		{"phase0 state", "BeaconState", "ssz", state(phase0.NewBeaconStateView(spec), spec.GENESIS_FORK_VERSION), "phase0", ""},
+		{"altair state", "BeaconState", "ssz", state(altair.NewBeaconStateView(spec), spec.ALTAIR_FORK_VERSION), "altair", ""},
+		{"capella state", "BeaconState", "ssz", state(capella.NewBeaconStateView(spec), spec.CAPELLA_FORK_VERSION), "capella", ""},
+		{"json state", "BeaconState", "json",
+			[]byte(fmt.Sprintf(`{"slot": "1", "fork": {"current_version": "%s"}}`, spec.ALTAIR_FORK_VERSION)), "altair", ""},
+		{"yaml state", "BeaconState", "yaml",
+			[]byte(fmt.Sprintf("fork:\n  current_version: '%s'\n", spec.BELLATRIX_FORK_VERSION)), "bellatrix", ""},
+		{"unknown fork version", "BeaconState", "json", []byte(`{"fork": {"current_version": "0x12345678"}}`), "",
+			"fork version 0x12345678 is not known"},
+		{"short state", "BeaconState", "ssz", make([]byte, 10), "", "too short to be a BeaconState"},
+		{"genesis block", "SignedBeaconBlock", "ssz", block(0), "phase0", ""},
+		{"last phase0 block", "SignedBeaconBlock", "ssz", block(altairSlot - 1), "phase0", ""},
+		{"first altair block", "SignedBeaconBlock", "ssz", block(altairSlot), "altair", ""},
+		{"capella block", "SignedBeaconBlock", "ssz", block(capellaSlot + 3), "capella", ""},
+		{"unsigned block", "BeaconBlock", "ssz", encode(spec.Wrap(&phase0.BeaconBlock{Slot: altairSlot})), "altair", ""},
+		{"json block", "BeaconBlock", "json", []byte(fmt.Sprintf(`{"slot": "%d"}`, capellaSlot)), "capella", ""},
+		{"yaml signed block", "SignedBeaconBlock", "yaml", []byte(fmt.Sprintf("message:\n  slot: %d\n", altairSlot)), "altair", ""},
+		{"short block", "SignedBeaconBlock", "ssz", []byte{100, 0, 0, 0}, "", "too short to be a SignedBeaconBlock"},
+		{"unsupported type", "Attestation", "ssz", nil, "", "cannot detect the phase of a Attestation"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			phase, err := DetectPhase(spec, c.typeName, c.format, c.data)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, expected %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if phase != c.want {
+				t.Fatalf("got phase %s, expected %s", phase, c.want)
+			}
+		})
+	}
+}
@@ -3,21 +3,20 @@ package util
 import (
 	"fmt"
 	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
 	"strconv"
 	"strings"
 )
 
-type GindicesFlag []tree.Gindex64
+// GindicesFlag is a list of generalized indices, each specified as a number or as a path like "validators/1234".
+// Paths are resolved against the type of the object with Resolve.
+type GindicesFlag []string
 
 func (p *GindicesFlag) String() string {
 	if p == nil {
 		return ""
 	}
-	var buf strings.Builder
-	for _, v := range *p {
-		buf.WriteString(strconv.FormatUint(uint64(v), 10))
-	}
-	return buf.String()
+	return strings.Join(*p, ",")
 }
 
 func (p *GindicesFlag) Set(v string) error {
@@ -25,21 +24,45 @@ func (p *GindicesFlag) Set(v string) error {
 		return fmt.Errorf("cannot decode gindices list into nil pointer")
 	}
 	parts := strings.Split(v, ",")
-	*p = make([]tree.Gindex64, 0, len(parts))
+	*p = make([]string, 0, len(parts))
 	for i, v := range parts {
 		s := strings.TrimSpace(v)
 		if s == "" {
 			continue
 		}
-		g, err := strconv.ParseUint(s, 0, 64)
-		if err != nil {
-			return fmt.Errorf("failed to parse gindex list, item %d, got: %q", i, s)
+		if g, err := strconv.ParseUint(s, 0, 64); err == nil {
+			if g == 0 {
+				return fmt.Errorf("failed to parse gindex list, item %d: gindex 0 is not a node", i)
+			}
+		} else if _, err := ParsePath(s); err != nil {
+			return fmt.Errorf("failed to parse gindex list, item %d, got: %q: %v", i, s, err)
 		}
-		*p = append(*p, tree.Gindex64(g))
+		*p = append(*p, s)
 	}
 	return nil
 }
 
 func (p *GindicesFlag) Type() string {
-	return "comma separated list of generalized indices (in any base)"
+	return "comma separated list of generalized indices (in any base) or paths"
+}
+
+// Resolve converts all items to gindices, resolving paths against the given type.
+func (p GindicesFlag) Resolve(typ view.TypeDef) ([]tree.Gindex64, error) {
+	out := make([]tree.Gindex64, 0, len(p))
+	for i, s := range p {
+		if g, err := strconv.ParseUint(s, 0, 64); err == nil {
+			out = append(out, tree.Gindex64(g))
+			continue
+		}
+		path, err := ParsePath(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse gindex list, item %d, got: %q", i, s)
+		}
+		target, err := ResolvePath(typ, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve gindex list item %d: %v", i, err)
+		}
+		out = append(out, target.Gindex)
+	}
+	return out, nil
 }
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+)
+
+func gindices(values ...uint64) []tree.Gindex64 {
+	out := make([]tree.Gindex64, len(values))
+	for i, v := range values {
+		out[i] = tree.Gindex64(v)
+	}
+	return out
+}
+
+func TestGindicesFlag(t *testing.T) {
+	cases := []struct {
+		value string
+		want  []tree.Gindex64
+		err   string
+	}{
+		{value: "", want: []tree.Gindex64{}},
+		{value: "4", want: gindices(4)},
+		{value: "4, 0x5,,6", want: gindices(4, 5, 6)},
+		{value: "a,numbers[1]", want: gindices(4, 160)},
+		{value: "numbers.__len__,items/1/x,7", want: gindices(11, 386, 7)},
+		{value: "a,b", err: `item 1: invalid path element "b"`},
+		{value: "4,0", err: "item 1: gindex 0 is not a node"},
+		{value: "0x0", err: "item 0: gindex 0 is not a node"},
+		{value: "items//x", err: `item 0, got: "items//x": empty path element`},
+	}
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			var f GindicesFlag
+			err := f.Set(c.value)
+			if err == nil {
+				var got []tree.Gindex64
+				if got, err = f.Resolve(pathTestType); err == nil && !reflect.DeepEqual(got, c.want) {
+					t.Fatalf("got %v, expected %v", got, c.want)
+				}
+			}
+			if c.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Fatalf("got error %v, expected %q", err, c.err)
+			}
+		})
+	}
+}
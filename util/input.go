@@ -13,6 +13,54 @@ import (
 	"strings"
 )
 
+// std-in can only be read once, but an input may be read again after detecting the phase of it.
+var stdinData []byte
+
+// readInput reads the data of an input, prefixed with its format.
+// Snappy-compressed input is uncompressed, and returned with the "ssz" format.
+func readInput(full string) (format string, data []byte, err error) {
+	partIndex := strings.Index(full, ":")
+	var path string
+	if partIndex >= 0 {
+		format = full[:partIndex]
+		path = full[partIndex+1:]
+	} else {
+		// default to ssz input
+		format = "ssz"
+		path = full
+	}
+
+	if path == "" {
+		if stdinData == nil {
+			var buf bytes.Buffer
+			_, err := buf.ReadFrom(os.Stdin)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to read std-in as input data: %v", err)
+			}
+			stdinData = buf.Bytes()
+		}
+		data = stdinData
+	} else {
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to open input file: '%s': %v", path, err)
+		}
+	}
+
+	switch format {
+	case "ssz_snappy", "ssz-snappy":
+		uncompressed, err := snappy.Decode(nil, data)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to uncompress ssz_snappy input: %v", err)
+		}
+		return "ssz", uncompressed, nil
+	case "ssz", "json", "yaml":
+		return format, data, nil
+	default:
+		return "", nil, fmt.Errorf("unrecognized data type, prefix input value with 'ssz:', 'json:' or 'yaml:'. Got: %q", format+":")
+	}
+}
+
 type ObjInput string
 
 func (p *ObjInput) String() string {
@@ -35,47 +83,12 @@ func (p *ObjInput) Read(dest common.SSZObj) error {
 	if p == nil {
 		return fmt.Errorf("no input specified")
 	}
-	full := string(*p)
-	partIndex := strings.Index(full, ":")
-	var typ, path string
-	if partIndex >= 0 {
-		typ = full[:partIndex]
-		path = full[partIndex+1:]
-	} else {
-		// default to ssz input
-		typ = "ssz"
-		path = full
+	format, data, err := readInput(string(*p))
+	if err != nil {
+		return err
 	}
 
-	var data []byte
-	if path == "" {
-		var buf bytes.Buffer
-		_, err := buf.ReadFrom(os.Stdin)
-		if err != nil {
-			return fmt.Errorf("failed to read std-in as input data: %v", err)
-		}
-		data = buf.Bytes()
-	} else {
-		var err error
-		data, err = ioutil.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to open input file: '%s': %v", path, err)
-		}
-	}
-
-	switch typ {
-	case "ssz_snappy", "ssz-snappy":
-		uncompressed, err := snappy.Decode(nil, data)
-		if err != nil {
-			return fmt.Errorf("failed to uncompress ssz_snappy input: %v", err)
-		}
-		data = uncompressed
-		dec := codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))
-		sszDest, ok := dest.(codec.Deserializable)
-		if !ok {
-			return fmt.Errorf("cannot decode SSZ-snappy input into destination type %T", dest)
-		}
-		return sszDest.Deserialize(dec)
+	switch format {
 	case "ssz":
 		dec := codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))
 		sszDest, ok := dest.(codec.Deserializable)
@@ -85,9 +98,31 @@ func (p *ObjInput) Read(dest common.SSZObj) error {
 		return sszDest.Deserialize(dec)
 	case "json":
 		return json.Unmarshal(data, dest)
-	case "yaml":
-		return yaml.Unmarshal(data, dest)
 	default:
-		return fmt.Errorf("unrecognized data type, prefix input value with 'ssz:', 'json:' or 'yaml:'. Got: %q", typ+":")
+		return yaml.Unmarshal(data, dest)
+	}
+}
+
+// DetectPhase reads the input, and detects the phase of it. See DetectPhase for the supported types.
+func (p *ObjInput) DetectPhase(spec *common.Spec, typeName string) (string, error) {
+	if p == nil {
+		return "", fmt.Errorf("no input specified")
+	}
+	format, data, err := readInput(string(*p))
+	if err != nil {
+		return "", err
+	}
+	return DetectPhase(spec, typeName, format, data)
+}
+
+// BlockSlot reads the input, and reads the slot of the BeaconBlock or SignedBeaconBlock in it.
+func (p *ObjInput) BlockSlot(typeName string) (common.Slot, error) {
+	if p == nil {
+		return 0, fmt.Errorf("no input specified")
+	}
+	format, data, err := readInput(string(*p))
+	if err != nil {
+		return 0, err
 	}
+	return BlockSlot(typeName, format, data)
 }
@@ -0,0 +1,178 @@
+package util
+
+import (
+	"fmt"
+	"github.com/protolambda/ztyp/tree"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortGindices deduplicates and sorts the gindices in ascending order.
+func SortGindices(gindices []tree.Gindex64) []tree.Gindex64 {
+	set := make(map[tree.Gindex64]struct{})
+	for _, g := range gindices {
+		set[g] = struct{}{}
+	}
+	out := make([]tree.Gindex64, 0, len(set))
+	for g := range set {
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// HelperIndices returns the sorted gindices of the witness nodes that are needed to prove the given leaves.
+func HelperIndices(leaves []tree.Gindex64) []tree.Gindex64 {
+	// mark every gindex that is between the root and the leaves
+	interest := make(map[tree.Gindex64]struct{})
+	for _, g := range leaves {
+		iter, _ := g.BitIter()
+		n := tree.Gindex64(1)
+		for {
+			right, ok := iter.Next()
+			if !ok {
+				break
+			}
+			n *= 2
+			if right {
+				n += 1
+			}
+			interest[n] = struct{}{}
+		}
+	}
+	witness := make([]tree.Gindex64, 0)
+	// for every gindex that is covered, check if the sibling is covered, and if not, it's a witness
+	for g := range interest {
+		if _, ok := interest[g^1]; !ok {
+			witness = append(witness, g^1)
+		}
+	}
+	return SortGindices(witness)
+}
+
+// MultiProofRoot merkleizes the leaves and witness nodes of a multi-proof back into a root.
+// The witness nodes must be exactly the helper indices of the leaves.
+func MultiProofRoot(leaves map[tree.Gindex64]tree.Root, witness map[tree.Gindex64]tree.Root) (tree.Root, error) {
+	leafIndices := make([]tree.Gindex64, 0, len(leaves))
+	for g := range leaves {
+		leafIndices = append(leafIndices, g)
+	}
+	helpers := HelperIndices(leafIndices)
+	for _, g := range helpers {
+		if _, ok := witness[g]; !ok {
+			return tree.Root{}, fmt.Errorf("missing witness node %d", g)
+		}
+	}
+	if len(witness) != len(helpers) {
+		return tree.Root{}, fmt.Errorf("expected %d witness nodes, got %d", len(helpers), len(witness))
+	}
+	nodes := make(map[tree.Gindex64]tree.Root, len(leaves)+len(witness))
+	for g, r := range leaves {
+		nodes[g] = r
+	}
+	for g, r := range witness {
+		nodes[g] = r
+	}
+	keys := make([]tree.Gindex64, 0, len(nodes))
+	for g := range nodes {
+		keys = append(keys, g)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] > keys[j]
+	})
+	hFn := tree.GetHashFn()
+	// parents that are computed from their children
+	merged := make(map[tree.Gindex64]struct{})
+	// merge siblings bottom-up, the keys are appended as new parent nodes are computed.
+	// A supplied node that is also computed from its children, e.g. a leaf with a leaf below it, must match.
+	for i := 0; i < len(keys); i++ {
+		g := keys[i]
+		if g <= 1 {
+			continue
+		}
+		if _, ok := merged[g/2]; ok {
+			continue
+		}
+		left, ok := nodes[g&^1]
+		if !ok {
+			continue
+		}
+		right, ok := nodes[g|1]
+		if !ok {
+			continue
+		}
+		merged[g/2] = struct{}{}
+		parent := hFn(left, right)
+		if supplied, ok := nodes[g/2]; ok {
+			if supplied != parent {
+				return tree.Root{}, fmt.Errorf("node %d does not match the root %s of its children", g/2, parent)
+			}
+			continue
+		}
+		nodes[g/2] = parent
+		keys = append(keys, g/2)
+	}
+	root, ok := nodes[tree.RootGindex]
+	if !ok {
+		return tree.Root{}, fmt.Errorf("proof nodes do not merkleize to a root")
+	}
+	return root, nil
+}
+
+// NodesFlag is a list of merkle tree nodes, formatted as comma separated "gindex:root" pairs.
+type NodesFlag map[tree.Gindex64]tree.Root
+
+func (p *NodesFlag) String() string {
+	if p == nil {
+		return ""
+	}
+	keys := make([]tree.Gindex64, 0, len(*p))
+	for g := range *p {
+		keys = append(keys, g)
+	}
+	keys = SortGindices(keys)
+	var buf strings.Builder
+	for i, g := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.FormatUint(uint64(g), 10))
+		buf.WriteByte(':')
+		buf.WriteString((*p)[g].String())
+	}
+	return buf.String()
+}
+
+func (p *NodesFlag) Set(v string) error {
+	if p == nil {
+		return fmt.Errorf("cannot decode nodes into nil pointer")
+	}
+	*p = make(map[tree.Gindex64]tree.Root)
+	for i, part := range strings.Split(v, ",") {
+		s := strings.TrimSpace(part)
+		if s == "" {
+			continue
+		}
+		sep := strings.Index(s, ":")
+		if sep < 0 {
+			return fmt.Errorf("node %d is not formatted as 'gindex:root', got: %q", i, s)
+		}
+		g, err := strconv.ParseUint(s[:sep], 0, 64)
+		if err != nil || g == 0 {
+			return fmt.Errorf("failed to parse gindex of node %d, got: %q", i, s[:sep])
+		}
+		var r tree.Root
+		if err := r.UnmarshalText([]byte(s[sep+1:])); err != nil {
+			return fmt.Errorf("failed to parse root of node %d: %v", i, err)
+		}
+		(*p)[tree.Gindex64(g)] = r
+	}
+	return nil
+}
+
+func (p *NodesFlag) Type() string {
+	return "comma separated list of 'gindex:root' nodes"
+}
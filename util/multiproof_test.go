@@ -0,0 +1,102 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+)
+
+// testTree builds a full binary tree of the given depth with distinct leaves,
+// and returns the root of every node by gindex.
+func testTree(depth uint8) map[tree.Gindex64]tree.Root {
+	nodes := make(map[tree.Gindex64]tree.Root)
+	first := tree.Gindex64(1) << depth
+	for i := tree.Gindex64(0); i < first; i++ {
+		var leaf tree.Root
+		leaf[0] = byte(i + 1)
+		nodes[first+i] = leaf
+	}
+	hFn := tree.GetHashFn()
+	for g := first - 1; g >= 1; g-- {
+		nodes[g] = hFn(nodes[g*2], nodes[g*2+1])
+	}
+	return nodes
+}
+
+func TestHelperIndices(t *testing.T) {
+	cases := []struct {
+		name   string
+		leaves []tree.Gindex64
+		want   []tree.Gindex64
+	}{
+		{"root", gindices(1), gindices()},
+		{"single leaf", gindices(8), gindices(3, 5, 9)},
+		{"siblings", gindices(8, 9), gindices(3, 5)},
+		{"opposite sides", gindices(8, 15), gindices(5, 6, 9, 14)},
+		{"unsorted with duplicates", gindices(15, 8, 15), gindices(5, 6, 9, 14)},
+		{"leaf and ancestor", gindices(2, 4), gindices(3, 5)},
+		{"different depths", gindices(3, 4), gindices(5)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := HelperIndices(c.leaves); !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %v, expected %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMultiProofRoot(t *testing.T) {
+	nodes := testTree(3)
+	pick := func(indices []tree.Gindex64) map[tree.Gindex64]tree.Root {
+		out := make(map[tree.Gindex64]tree.Root, len(indices))
+		for _, g := range indices {
+			out[g] = nodes[g]
+		}
+		return out
+	}
+	var wrong tree.Root
+	wrong[0] = 0xff
+	cases := []struct {
+		name    string
+		leaves  map[tree.Gindex64]tree.Root
+		witness map[tree.Gindex64]tree.Root
+		// the error, or if the computed root must match the root of the tree
+		err     string
+		matches bool
+	}{
+		{"single leaf", pick(gindices(8)), pick(gindices(3, 5, 9)), "", true},
+		{"siblings", pick(gindices(8, 9)), pick(gindices(3, 5)), "", true},
+		{"opposite sides", pick(gindices(8, 15)), pick(gindices(5, 6, 9, 14)), "", true},
+		{"leaf and ancestor", pick(gindices(2, 4)), pick(gindices(3, 5)), "", true},
+		// the witness node 4 is visited before its sibling is computed
+		{"right leaf", pick(gindices(11)), pick(gindices(3, 4, 10)), "", true},
+		{"root", pick(gindices(1)), pick(gindices()), "", true},
+		{"wrong leaf", map[tree.Gindex64]tree.Root{8: wrong}, pick(gindices(3, 5, 9)), "", false},
+		{"wrong descendant leaf", map[tree.Gindex64]tree.Root{2: nodes[2], 4: wrong}, pick(gindices(3, 5)),
+			"node 2 does not match the root", false},
+		{"wrong ancestor leaf", map[tree.Gindex64]tree.Root{2: wrong, 4: nodes[4]}, pick(gindices(3, 5)),
+			"node 2 does not match the root", false},
+		{"missing witness", pick(gindices(8)), pick(gindices(3, 5)), "missing witness node 9", false},
+		{"extra witness", pick(gindices(8)), pick(gindices(3, 5, 9, 6)), "expected 3 witness nodes, got 4", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			root, err := MultiProofRoot(c.leaves, c.witness)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, expected %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (root == nodes[1]) != c.matches {
+				t.Fatalf("got root %s, tree root %s, expected match: %v", root, nodes[1], c.matches)
+			}
+		})
+	}
+}
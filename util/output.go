@@ -53,7 +53,7 @@ func (p *ObjOutput) Write(obj interface{}) error {
 		defer w.Flush()
 		out = w
 	} else {
-		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0777)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0777)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,291 @@
+package util
+
+import (
+	"fmt"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+	"strconv"
+	"strings"
+)
+
+// LengthKey selects the length mix-in of a list, like the "__len__" path element in the consensus-specs.
+const LengthKey = "__len__"
+
+// PathFlag is a path into a SSZ object, e.g. "validators/1234/pubkey".
+// Elements may be separated with '/' or '.', and indices may also be written like "validators[1234]".
+type PathFlag []string
+
+func (p *PathFlag) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(*p, "/")
+}
+
+func (p *PathFlag) Set(v string) error {
+	if p == nil {
+		return fmt.Errorf("cannot decode path into nil pointer")
+	}
+	path, err := ParsePath(v)
+	if err != nil {
+		return err
+	}
+	*p = path
+	return nil
+}
+
+func (p *PathFlag) Type() string {
+	return "path of fields and indices, e.g. 'validators/1234/pubkey'"
+}
+
+// PathsFlag is a list of paths, comma separated, and accumulated when the flag is repeated.
+type PathsFlag [][]string
+
+func (p *PathsFlag) String() string {
+	if p == nil {
+		return ""
+	}
+	out := make([]string, len(*p))
+	for i, path := range *p {
+		out[i] = strings.Join(path, "/")
+	}
+	return strings.Join(out, ",")
+}
+
+func (p *PathsFlag) Set(v string) error {
+	if p == nil {
+		return fmt.Errorf("cannot decode paths into nil pointer")
+	}
+	for i, s := range strings.Split(v, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		path, err := ParsePath(s)
+		if err != nil {
+			return fmt.Errorf("failed to parse path list, item %d, got: %q: %v", i, s, err)
+		}
+		*p = append(*p, path)
+	}
+	return nil
+}
+
+func (p *PathsFlag) Type() string {
+	return "comma separated list of paths, e.g. 'latest_block_header/state_root,validators/*/effective_balance'"
+}
+
+// ParsePath splits a human-readable path into its elements.
+// An empty path selects the root, but empty elements, e.g. of "validators//pubkey" or "validators[]", are rejected.
+func ParsePath(v string) ([]string, error) {
+	v = strings.TrimSpace(v)
+	out := []string{}
+	if v == "" {
+		return out, nil
+	}
+	for i, elem := range strings.Split(strings.ReplaceAll(v, ".", "/"), "/") {
+		name, rest, indexed := strings.Cut(elem, "[")
+		if strings.ContainsAny(name, "] \t") {
+			return nil, fmt.Errorf("invalid path element %d in %q", i, v)
+		}
+		if name == "" && !indexed {
+			return nil, fmt.Errorf("empty path element %d in %q", i, v)
+		}
+		if name != "" {
+			out = append(out, name)
+		}
+		// indices like "[1234]", possibly repeated like "[1][2]"
+		for indexed {
+			index, after, closed := strings.Cut(rest, "]")
+			if !closed || index == "" || strings.ContainsAny(index, "[ \t") {
+				return nil, fmt.Errorf("invalid index in path element %d in %q", i, v)
+			}
+			out = append(out, index)
+			if after == "" {
+				break
+			}
+			if rest, indexed = strings.CutPrefix(after, "["); !indexed {
+				return nil, fmt.Errorf("unexpected %q after index in path element %d in %q", after, i, v)
+			}
+		}
+	}
+	return out, nil
+}
+
+// FormatPath formats path elements like "validators[1234].pubkey"
+func FormatPath(path []string) string {
+	if len(path) == 0 {
+		return "<root>"
+	}
+	var buf strings.Builder
+	for i, p := range path {
+		if _, err := strconv.ParseUint(p, 10, 64); err == nil {
+			buf.WriteString("[" + p + "]")
+			continue
+		}
+		if i > 0 {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(p)
+	}
+	return buf.String()
+}
+
+type lengthCheck struct {
+	// gindex of the length mix-in of the list
+	lenGindex tree.Gindex64
+	index     uint64
+	path      []string
+}
+
+// PathTarget is the result of resolving a path against a type definition.
+type PathTarget struct {
+	Path []string
+	// Gindex of the node that holds the target, relative to the root of the object
+	Gindex tree.Gindex64
+	// Type of the target
+	Type view.TypeDef
+	// Packed is true if the target is a basic value that shares its node with neighbouring elements.
+	// SubIndex is then the index of the value within the node.
+	Packed   bool
+	SubIndex uint8
+
+	checks []lengthCheck
+}
+
+// ConcatGindices returns the gindex of b, when b is relative to the node at gindex a.
+func ConcatGindices(a, b tree.Gindex64) (tree.Gindex64, error) {
+	depth := b.Depth()
+	if a.Depth()+depth >= 64 {
+		return 0, fmt.Errorf("gindex %d of subtree at %d is too deep", b, a)
+	}
+	anchor := tree.Gindex64(1) << depth
+	return (a << depth) | (b ^ anchor), nil
+}
+
+// ResolvePath walks the type definition to find the gindex and type of the given path.
+func ResolvePath(typ view.TypeDef, path []string) (*PathTarget, error) {
+	out := &PathTarget{Path: path, Gindex: tree.RootGindex, Type: typ}
+	for i, key := range path {
+		if out.Packed {
+			return nil, fmt.Errorf("cannot navigate into basic value %s with %q", FormatPath(path[:i]), key)
+		}
+		local, elemType, err := out.step(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path element %q at %s: %v", key, FormatPath(path[:i]), err)
+		}
+		g, err := ConcatGindices(out.Gindex, local)
+		if err != nil {
+			return nil, err
+		}
+		if list, ok := out.Type.(view.ListTypeDef); ok && key != LengthKey {
+			lenGindex, err := ConcatGindices(out.Gindex, tree.RightGindex)
+			if err != nil {
+				return nil, err
+			}
+			index, _ := strconv.ParseUint(key, 10, 64)
+			if index >= list.Limit() {
+				return nil, fmt.Errorf("index %d at %s is out of bounds, limit is %d", index, FormatPath(path[:i]), list.Limit())
+			}
+			out.checks = append(out.checks, lengthCheck{lenGindex: lenGindex, index: index, path: path[:i]})
+		}
+		out.Gindex = g
+		out.Type = elemType
+	}
+	return out, nil
+}
+
+// step navigates one path element deeper, starting at the current type, and returns the relative gindex.
+func (t *PathTarget) step(key string) (tree.Gindex64, view.TypeDef, error) {
+	switch typ := t.Type.(type) {
+	case *view.ContainerTypeDef:
+		for i, f := range typ.Fields {
+			if f.Name == key {
+				g, err := tree.ToGindex64(uint64(i), tree.CoverDepth(typ.FieldCount()))
+				return g, f.Type, err
+			}
+		}
+		return 0, nil, fmt.Errorf("container %s has no field %q", typ.ContainerName, key)
+	case view.ListTypeDef:
+		if key == LengthKey {
+			return tree.RightGindex, view.Uint64Type, nil
+		}
+		index, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("expected list index or %q", LengthKey)
+		}
+		g, err := t.elemGindex(typ.ElementType(), index, typ.Limit())
+		if err != nil {
+			return 0, nil, err
+		}
+		// the contents are in the left subtree, the length is mixed in on the right
+		g, err = ConcatGindices(tree.LeftGindex, g)
+		return g, typ.ElementType(), err
+	case view.VectorTypeDef:
+		index, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("expected vector index")
+		}
+		if index >= typ.Length() {
+			return 0, nil, fmt.Errorf("index %d is out of bounds, vector length is %d", index, typ.Length())
+		}
+		g, err := t.elemGindex(typ.ElementType(), index, typ.Length())
+		return g, typ.ElementType(), err
+	default:
+		return 0, nil, fmt.Errorf("cannot navigate into type %s", t.Type.String())
+	}
+}
+
+// elemGindex computes the relative gindex of an element in the contents of a list or vector.
+// Basic elements are packed into 32-byte nodes.
+func (t *PathTarget) elemGindex(elemType view.TypeDef, index uint64, limit uint64) (tree.Gindex64, error) {
+	t.Packed = false
+	if _, ok := elemType.(view.BasicTypeDef); ok {
+		perNode := 32 / elemType.TypeByteLength()
+		nodeLimit := (limit + perNode - 1) / perNode
+		t.Packed = perNode > 1
+		t.SubIndex = uint8(index % perNode)
+		return tree.ToGindex64(index/perNode, tree.CoverDepth(nodeLimit))
+	}
+	return tree.ToGindex64(index, tree.CoverDepth(limit))
+}
+
+// View gets the targeted sub-view from the backing of the object the path was resolved against.
+func (t *PathTarget) View(root tree.Node) (view.View, error) {
+	for _, c := range t.checks {
+		lenNode, err := root.Getter(c.lenGindex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get length of list at %s: %v", FormatPath(c.path), err)
+		}
+		length, err := view.AsUint64(view.Uint64Type.ViewFromBacking(lenNode, nil))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read length of list at %s: %v", FormatPath(c.path), err)
+		}
+		if c.index >= uint64(length) {
+			return nil, fmt.Errorf("index %d at %s is out of bounds, list length is %d", c.index, FormatPath(c.path), length)
+		}
+	}
+	node, err := root.Getter(t.Gindex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node of %s at gindex %d: %v", FormatPath(t.Path), t.Gindex, err)
+	}
+	if t.Packed {
+		r, ok := node.(*tree.Root)
+		if !ok {
+			return nil, fmt.Errorf("expected bottom node for packed value %s", FormatPath(t.Path))
+		}
+		return t.Type.(view.BasicTypeDef).BasicViewFromBacking(r, t.SubIndex)
+	}
+	return t.Type.ViewFromBacking(node, nil)
+}
+
+// Select resolves the path against the type of the view, and returns the targeted sub-view.
+// An empty path selects the view itself.
+func (p PathFlag) Select(v view.View) (view.View, error) {
+	if len(p) == 0 {
+		return v, nil
+	}
+	target, err := ResolvePath(v.Type(), p)
+	if err != nil {
+		return nil, err
+	}
+	return target.View(v.Backing())
+}
@@ -0,0 +1,193 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+)
+
+var (
+	pathTestItemType = view.ContainerType("Item", []view.FieldDef{
+		{Name: "x", Type: view.Uint64Type},
+		{Name: "y", Type: view.Uint64Type},
+	})
+	pathTestType = view.ContainerType("Test", []view.FieldDef{
+		{Name: "a", Type: view.Uint64Type},
+		{Name: "numbers", Type: view.BasicListType(view.Uint64Type, 64)},
+		{Name: "items", Type: view.ComplexListType(pathTestItemType, 16)},
+	})
+)
+
+func TestParsePath(t *testing.T) {
+	cases := []struct {
+		value string
+		want  []string
+	}{
+		{"", []string{}},
+		{"validators", []string{"validators"}},
+		{"validators/1234/pubkey", []string{"validators", "1234", "pubkey"}},
+		{"validators.1234.pubkey", []string{"validators", "1234", "pubkey"}},
+		{"validators[1234].pubkey", []string{"validators", "1234", "pubkey"}},
+		{"items[1][2]", []string{"items", "1", "2"}},
+		{"numbers.__len__", []string{"numbers", LengthKey}},
+		{" validators[0] ", []string{"validators", "0"}},
+	}
+	for _, c := range cases {
+		got, err := ParsePath(c.value)
+		if err != nil {
+			t.Fatalf("path %q: unexpected error: %v", c.value, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("path %q: got %q, expected %q", c.value, got, c.want)
+		}
+	}
+}
+
+func TestParsePathInvalid(t *testing.T) {
+	for _, value := range []string{
+		"/validators",
+		"validators/",
+		"validators//pubkey",
+		"validators..pubkey",
+		"validators[]",
+		"validators[1",
+		"validators]1",
+		"validators[1]x",
+		"items[1][[2]]",
+		"a b",
+	} {
+		if got, err := ParsePath(value); err == nil {
+			t.Fatalf("path %q: got %q, expected an error", value, got)
+		}
+	}
+}
+
+func TestFormatPath(t *testing.T) {
+	cases := []struct {
+		path []string
+		want string
+	}{
+		{nil, "<root>"},
+		{[]string{"slot"}, "slot"},
+		{[]string{"validators", "1234", "pubkey"}, "validators[1234].pubkey"},
+		{[]string{"numbers", LengthKey}, "numbers.__len__"},
+	}
+	for _, c := range cases {
+		if got := FormatPath(c.path); got != c.want {
+			t.Fatalf("path %q: got %q, expected %q", c.path, got, c.want)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	cases := []struct {
+		path     string
+		gindex   tree.Gindex64
+		packed   bool
+		subIndex uint8
+		err      string
+	}{
+		{path: "", gindex: 1},
+		{path: "a", gindex: 4},
+		{path: "numbers", gindex: 5},
+		// 4 numbers are packed per node, the contents are at gindex 10, with a depth of 4
+		{path: "numbers[1]", gindex: 160, packed: true, subIndex: 1},
+		{path: "numbers[63]", gindex: 175, packed: true, subIndex: 3},
+		{path: "numbers.__len__", gindex: 11},
+		// the items are at gindex 12, with a depth of 4, and have 2 fields
+		{path: "items[1]", gindex: 193},
+		{path: "items[1].x", gindex: 386},
+		{path: "items[15].y", gindex: 415},
+		{path: "b", err: `container Test has no field "b"`},
+		{path: "numbers.x", err: "expected list index"},
+		{path: "numbers[64]", err: `invalid path element "64" at numbers`},
+		{path: "items[16]", err: `invalid path element "16" at items`},
+		{path: "numbers[1].x", err: "cannot navigate into basic value"},
+		{path: "a.x", err: "cannot navigate into type"},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			path, err := ParsePath(c.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			target, err := ResolvePath(pathTestType, path)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, expected %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if target.Gindex != c.gindex || target.Packed != c.packed || target.SubIndex != c.subIndex {
+				t.Fatalf("got gindex %d (packed: %v, sub-index: %d), expected %d (packed: %v, sub-index: %d)",
+					target.Gindex, target.Packed, target.SubIndex, c.gindex, c.packed, c.subIndex)
+			}
+		})
+	}
+}
+
+func TestPathSelect(t *testing.T) {
+	v := pathTestType.New()
+	check := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(v.Set(0, view.Uint64View(7)))
+	numbers := view.BasicListType(view.Uint64Type, 64).New()
+	for _, n := range []uint64{10, 11, 12} {
+		check(numbers.Append(view.Uint64View(n)))
+	}
+	check(v.Set(1, numbers))
+	items := view.ComplexListType(pathTestItemType, 16).New()
+	item := pathTestItemType.New()
+	check(item.Set(0, view.Uint64View(3)))
+	check(item.Set(1, view.Uint64View(4)))
+	check(items.Append(item))
+	check(v.Set(2, items))
+
+	cases := []struct {
+		path string
+		want uint64
+		err  string
+	}{
+		{path: "a", want: 7},
+		{path: "numbers[2]", want: 12},
+		{path: "numbers.__len__", want: 3},
+		{path: "items[0].y", want: 4},
+		{path: "numbers[3]", err: "out of bounds, list length is 3"},
+		{path: "items[1].x", err: "out of bounds, list length is 1"},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			var p PathFlag
+			if err := p.Set(c.path); err != nil {
+				t.Fatal(err)
+			}
+			selected, err := p.Select(v)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, expected %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := view.AsUint64(selected, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uint64(got) != c.want {
+				t.Fatalf("got %d, expected %d", got, c.want)
+			}
+		})
+	}
+}
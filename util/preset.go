@@ -0,0 +1,111 @@
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/protolambda/zcli/spec_types"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/view"
+)
+
+// KnownPresets are the presets that SSZ input is checked against, in order of preference.
+var KnownPresets = []struct {
+	Name string
+	Spec *common.Spec
+}{
+	{"mainnet", configs.Mainnet},
+	{"minimal", configs.Minimal},
+}
+
+// UsePreset replaces all presets of the spec with the presets of the other spec, and keeps the config.
+func UsePreset(spec *common.Spec, preset *common.Spec) {
+	spec.Phase0Preset = preset.Phase0Preset
+	spec.AltairPreset = preset.AltairPreset
+	spec.BellatrixPreset = preset.BellatrixPreset
+	spec.CapellaPreset = preset.CapellaPreset
+	spec.DenebPreset = preset.DenebPreset
+	spec.ElectraPreset = preset.ElectraPreset
+}
+
+// LayoutMatches checks that the SSZ data fits the fixed-size part of the container type:
+// the first offset must point to the end of the fixed-size part, like the SSZ decoder checks.
+// The fixed-size part includes vectors that are sized by the preset, e.g. block_roots and randao_mixes of a BeaconState.
+func LayoutMatches(typ view.TypeDef, data []byte) bool {
+	c, ok := typ.(*view.ContainerTypeDef)
+	if !ok {
+		return true
+	}
+	fixed := uint64(0)
+	firstOffset := -1
+	for _, f := range c.Fields {
+		if f.Type.IsFixedByteLength() {
+			fixed += f.Type.TypeByteLength()
+		} else {
+			if firstOffset < 0 {
+				firstOffset = int(fixed)
+			}
+			fixed += 4
+		}
+	}
+	if firstOffset < 0 {
+		return uint64(len(data)) == fixed
+	}
+	if uint64(len(data)) < fixed {
+		return false
+	}
+	return uint64(binary.LittleEndian.Uint32(data[firstOffset:firstOffset+4])) == fixed
+}
+
+// DetectPreset returns the first known preset that the SSZ layout of the BeaconState fits, with the config of the spec.
+func DetectPreset(spec *common.Spec, phase string, data []byte) (string, *common.Spec, error) {
+	stateType, ok := spec_types.TypesByPhase[phase]["BeaconState"]
+	if !ok {
+		return "", nil, fmt.Errorf("unrecognized phase: %s", phase)
+	}
+	for _, p := range KnownPresets {
+		candidate := *spec
+		UsePreset(&candidate, p.Spec)
+		if LayoutMatches(stateType.TypeDef(&candidate), data) {
+			return p.Name, p.Spec, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%d bytes do not fit the %s BeaconState layout of any known preset", len(data), phase)
+}
+
+// checkStatePreset checks the SSZ data of a BeaconState against the presets of the spec.
+// If it does not match, but does match a known preset, then the spec is changed to use that preset.
+func checkStatePreset(spec *common.Spec, phase string, data []byte) (changed bool, err error) {
+	stateType, ok := spec_types.TypesByPhase[phase]["BeaconState"]
+	if !ok {
+		return false, fmt.Errorf("unrecognized phase: %s", phase)
+	}
+	if LayoutMatches(stateType.TypeDef(spec), data) {
+		return false, nil
+	}
+	name, preset, err := DetectPreset(spec, phase, data)
+	if err != nil {
+		return false, fmt.Errorf("BeaconState input does not match the loaded presets: %v", err)
+	}
+	UsePreset(spec, preset)
+	_, _ = fmt.Fprintf(os.Stderr, "BeaconState input does not match the loaded presets, using the %s presets instead (set --preset-<fork>=%s to select them explicitly)\n", name, name)
+	return true, nil
+}
+
+// CheckStatePreset reads the input as BeaconState of the given phase, and checks it against the presets of the spec.
+// If it does not match, but does match a known preset, then the spec is changed to use that preset, and true is returned.
+func (p *ObjInput) CheckStatePreset(spec *common.Spec, phase string) (bool, error) {
+	if p == nil {
+		return false, fmt.Errorf("no input specified")
+	}
+	format, data, err := readInput(string(*p))
+	if err != nil {
+		return false, err
+	}
+	if format != "ssz" {
+		return false, nil
+	}
+	return checkStatePreset(spec, phase, data)
+}
@@ -0,0 +1,83 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/zcli/spec_types"
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+	"github.com/protolambda/zrnt/eth2/configs"
+	"github.com/protolambda/ztyp/codec"
+)
+
+// defaultStateSSZ encodes the default BeaconState of the phase, with the presets of the spec.
+func defaultStateSSZ(t *testing.T, spec *common.Spec, phase string) []byte {
+	t.Helper()
+	typ := spec_types.TypesByPhase[phase]["BeaconState"].TypeDef(spec)
+	state := typ.Default(nil)
+	var buf bytes.Buffer
+	if err := state.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		t.Fatalf("failed to encode %s state: %v", phase, err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectPreset(t *testing.T) {
+	cases := []struct {
+		name   string
+		phase  string
+		preset *common.Spec
+		// the spec to detect with, its config is kept
+		spec *common.Spec
+		want string
+		err  string
+	}{
+		{"mainnet phase0", "phase0", configs.Mainnet, configs.Mainnet, "mainnet", ""},
+		{"minimal phase0", "phase0", configs.Minimal, configs.Mainnet, "minimal", ""},
+		{"minimal altair", "altair", configs.Minimal, configs.Mainnet, "minimal", ""},
+		{"mainnet deneb with minimal spec", "deneb", configs.Mainnet, configs.Minimal, "mainnet", ""},
+		{"minimal electra", "electra", configs.Minimal, configs.Mainnet, "minimal", ""},
+		{"unknown phase", "unknown", configs.Mainnet, configs.Mainnet, "", "unrecognized phase"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var data []byte
+			if c.err == "" {
+				data = defaultStateSSZ(t, c.preset, c.phase)
+			}
+			name, preset, err := DetectPreset(c.spec, c.phase, data)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("got error %v, expected %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != c.want || preset != c.preset {
+				t.Fatalf("got preset %s, expected %s", name, c.want)
+			}
+		})
+	}
+}
+
+func TestDetectPresetMismatch(t *testing.T) {
+	data := defaultStateSSZ(t, configs.Minimal, "altair")
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", data[:len(data)/2]},
+		{"wrong phase", defaultStateSSZ(t, configs.Minimal, "phase0")},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if name, _, err := DetectPreset(configs.Mainnet, "altair", c.data); err == nil {
+				t.Fatalf("expected no preset to match, got %s", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package util
+
+import (
+	"fmt"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/conv"
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+)
+
+// ProofNodesLimit is the list limit of the SSZ representation of proof contents
+const ProofNodesLimit = 1 << 32
+
+// GindexList is a SSZ list of generalized indices, encoded as uint64 values
+type GindexList []tree.Gindex64
+
+func (li *GindexList) Deserialize(dr *codec.DecodingReader) error {
+	scope := dr.Scope()
+	if scope%8 != 0 {
+		return fmt.Errorf("gindex list scope %d is not a multiple of 8", scope)
+	}
+	length := scope / 8
+	if length > ProofNodesLimit {
+		return fmt.Errorf("too many gindices: %d", length)
+	}
+	*li = make([]tree.Gindex64, length)
+	for i := uint64(0); i < length; i++ {
+		v, err := dr.ReadUint64()
+		if err != nil {
+			return err
+		}
+		(*li)[i] = tree.Gindex64(v)
+	}
+	return nil
+}
+
+func (li GindexList) Serialize(w *codec.EncodingWriter) error {
+	for _, g := range li {
+		if err := w.WriteUint64(uint64(g)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (li GindexList) ByteLength() uint64 {
+	return uint64(len(li)) * 8
+}
+
+func (li *GindexList) FixedLength() uint64 {
+	return 0
+}
+
+func (li GindexList) HashTreeRoot(hFn tree.HashFn) tree.Root {
+	return hFn.Uint64ListHTR(func(i uint64) uint64 {
+		return uint64(li[i])
+	}, uint64(len(li)), ProofNodesLimit)
+}
+
+// RootList is a SSZ list of merkle nodes
+type RootList []tree.Root
+
+func (li *RootList) Deserialize(dr *codec.DecodingReader) error {
+	return tree.ReadRootsLimited(dr, (*[]tree.Root)(li), ProofNodesLimit)
+}
+
+func (li RootList) Serialize(w *codec.EncodingWriter) error {
+	return tree.WriteRoots(w, li)
+}
+
+func (li RootList) ByteLength() uint64 {
+	return uint64(len(li)) * 32
+}
+
+func (li *RootList) FixedLength() uint64 {
+	return 0
+}
+
+func (li RootList) HashTreeRoot(hFn tree.HashFn) tree.Root {
+	length := uint64(len(li))
+	return hFn.ComplexListHTR(func(i uint64) tree.HTR {
+		if i < length {
+			return &li[i]
+		}
+		return nil
+	}, length, ProofNodesLimit)
+}
+
+// MultiProof is a merkle proof of any number of leaves, with the witness nodes sorted by gindex.
+type MultiProof struct {
+	Root            tree.Root  `json:"root" yaml:"root"`
+	Gindices        GindexList `json:"gindices" yaml:"gindices"`
+	Leaves          RootList   `json:"leaves" yaml:"leaves"`
+	WitnessGindices GindexList `json:"witness_gindices" yaml:"witness_gindices"`
+	Witness         RootList   `json:"witness" yaml:"witness"`
+}
+
+func (p *MultiProof) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&p.Root, &p.Gindices, &p.Leaves, &p.WitnessGindices, &p.Witness)
+}
+
+func (p *MultiProof) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&p.Root, &p.Gindices, &p.Leaves, &p.WitnessGindices, &p.Witness)
+}
+
+func (p *MultiProof) ByteLength() uint64 {
+	return codec.ContainerLength(&p.Root, &p.Gindices, &p.Leaves, &p.WitnessGindices, &p.Witness)
+}
+
+func (p *MultiProof) FixedLength() uint64 {
+	return 0
+}
+
+func (p *MultiProof) HashTreeRoot(hFn tree.HashFn) tree.Root {
+	return hFn.HashTreeRoot(&p.Root, &p.Gindices, &p.Leaves, &p.WitnessGindices, &p.Witness)
+}
+
+// Nodes returns the leaves and witness nodes by gindex
+func (p *MultiProof) Nodes() (leaves map[tree.Gindex64]tree.Root, witness map[tree.Gindex64]tree.Root, err error) {
+	if len(p.Gindices) != len(p.Leaves) {
+		return nil, nil, fmt.Errorf("got %d leaf gindices, but %d leaves", len(p.Gindices), len(p.Leaves))
+	}
+	if len(p.WitnessGindices) != len(p.Witness) {
+		return nil, nil, fmt.Errorf("got %d witness gindices, but %d witness nodes", len(p.WitnessGindices), len(p.Witness))
+	}
+	leaves = make(map[tree.Gindex64]tree.Root, len(p.Leaves))
+	for i, g := range p.Gindices {
+		leaves[g] = p.Leaves[i]
+	}
+	witness = make(map[tree.Gindex64]tree.Root, len(p.Witness))
+	for i, g := range p.WitnessGindices {
+		witness[g] = p.Witness[i]
+	}
+	return leaves, witness, nil
+}
+
+// SingleProof is a merkle proof of a single leaf, with the witness nodes ordered from the bottom up.
+// This matches the consensus-specs single_merkle_proof test format and the light-client "branch" fields.
+type SingleProof struct {
+	Root      tree.Root     `json:"root" yaml:"root"`
+	Leaf      tree.Root     `json:"leaf" yaml:"leaf"`
+	LeafIndex tree.Gindex64 `json:"leaf_index" yaml:"leaf_index"`
+	Branch    RootList      `json:"branch" yaml:"branch"`
+}
+
+func (p *SingleProof) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&p.Root, &p.Leaf, (*view.Uint64View)(&p.LeafIndex), &p.Branch)
+}
+
+func (p *SingleProof) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&p.Root, &p.Leaf, (*view.Uint64View)(&p.LeafIndex), &p.Branch)
+}
+
+func (p *SingleProof) ByteLength() uint64 {
+	return codec.ContainerLength(&p.Root, &p.Leaf, (*view.Uint64View)(&p.LeafIndex), &p.Branch)
+}
+
+func (p *SingleProof) FixedLength() uint64 {
+	return 0
+}
+
+func (p *SingleProof) HashTreeRoot(hFn tree.HashFn) tree.Root {
+	return hFn.HashTreeRoot(&p.Root, &p.Leaf, (*view.Uint64View)(&p.LeafIndex), &p.Branch)
+}
+
+// BranchGindices returns the gindices of the branch nodes of a single leaf, from the bottom up.
+func BranchGindices(leaf tree.Gindex64) []tree.Gindex64 {
+	out := make([]tree.Gindex64, 0, leaf.Depth())
+	for g := leaf; g > 1; g >>= 1 {
+		out = append(out, g^1)
+	}
+	return out
+}
+
+// Descriptor is a SSZ byte list, encoded as hex in JSON and YAML
+type Descriptor []byte
+
+func (d *Descriptor) Deserialize(dr *codec.DecodingReader) error {
+	return dr.ByteList((*[]byte)(d), ProofNodesLimit)
+}
+
+func (d Descriptor) Serialize(w *codec.EncodingWriter) error {
+	return w.Write(d)
+}
+
+func (d Descriptor) ByteLength() uint64 {
+	return uint64(len(d))
+}
+
+func (d *Descriptor) FixedLength() uint64 {
+	return 0
+}
+
+func (d Descriptor) HashTreeRoot(hFn tree.HashFn) tree.Root {
+	return hFn.ByteListHTR(d, ProofNodesLimit)
+}
+
+func (d Descriptor) MarshalText() ([]byte, error) {
+	return conv.BytesMarshalText(d)
+}
+
+func (d *Descriptor) UnmarshalText(text []byte) error {
+	return conv.DynamicBytesUnmarshalText((*[]byte)(d), text)
+}
+
+// CompactProof is a multi-proof that encodes the shape of the proof tree as descriptor bits.
+// The descriptor has a bit for every node in the proof tree, in depth-first pre-order:
+// 1 for a node that is included in the proof, 0 for an intermediate node that is computed from its children.
+// The bits are packed from the most significant bit of the first byte onward, and padded with zero bits.
+// The included nodes are listed in the same order.
+type CompactProof struct {
+	Root       tree.Root  `json:"root" yaml:"root"`
+	Descriptor Descriptor `json:"descriptor" yaml:"descriptor"`
+	Nodes      RootList   `json:"nodes" yaml:"nodes"`
+}
+
+func (p *CompactProof) Deserialize(dr *codec.DecodingReader) error {
+	return dr.Container(&p.Root, &p.Descriptor, &p.Nodes)
+}
+
+func (p *CompactProof) Serialize(w *codec.EncodingWriter) error {
+	return w.Container(&p.Root, &p.Descriptor, &p.Nodes)
+}
+
+func (p *CompactProof) ByteLength() uint64 {
+	return codec.ContainerLength(&p.Root, &p.Descriptor, &p.Nodes)
+}
+
+func (p *CompactProof) FixedLength() uint64 {
+	return 0
+}
+
+func (p *CompactProof) HashTreeRoot(hFn tree.HashFn) tree.Root {
+	return hFn.HashTreeRoot(&p.Root, &p.Descriptor, &p.Nodes)
+}
+
+// CompactDescriptor computes the descriptor of a compact proof of the given leaves,
+// and the gindices of the nodes to include in the proof, in order.
+func CompactDescriptor(leaves []tree.Gindex64) (descriptor Descriptor, included []tree.Gindex64) {
+	included = make([]tree.Gindex64, 0)
+	if len(leaves) == 0 {
+		return nil, included
+	}
+	provided := make(map[tree.Gindex64]struct{})
+	for _, g := range leaves {
+		provided[g] = struct{}{}
+	}
+	for _, g := range HelperIndices(leaves) {
+		provided[g] = struct{}{}
+	}
+	// leaves that are ancestors of other leaves are computed, not included
+	for _, g := range leaves {
+		for p := g >> 1; p >= 1; p >>= 1 {
+			delete(provided, p)
+		}
+	}
+	var bitLen uint64
+	var visit func(g tree.Gindex64)
+	visit = func(g tree.Gindex64) {
+		if bitLen%8 == 0 {
+			descriptor = append(descriptor, 0)
+		}
+		if _, ok := provided[g]; ok {
+			descriptor[bitLen/8] |= 0x80 >> (bitLen % 8)
+			bitLen++
+			included = append(included, g)
+			return
+		}
+		bitLen++
+		visit(g << 1)
+		visit(g<<1 | 1)
+	}
+	visit(tree.RootGindex)
+	return descriptor, included
+}
+
+// Merkleize reconstructs the root from the proof nodes, and returns it together with the nodes of the proof tree by gindex:
+// the included nodes, and the intermediate nodes computed from them, such as leaves that are ancestors of other leaves.
+func (p *CompactProof) Merkleize() (tree.Root, map[tree.Gindex64]tree.Root, error) {
+	nodes := make(map[tree.Gindex64]tree.Root, len(p.Nodes))
+	bitCount := uint64(len(p.Descriptor)) * 8
+	var bitIndex uint64
+	var nodeIndex int
+	hFn := tree.GetHashFn()
+	var visit func(g tree.Gindex64) (tree.Root, error)
+	visit = func(g tree.Gindex64) (tree.Root, error) {
+		if bitIndex >= bitCount {
+			return tree.Root{}, fmt.Errorf("descriptor is too short")
+		}
+		bit := (p.Descriptor[bitIndex/8] >> (7 - bitIndex%8)) & 1
+		bitIndex++
+		if bit == 1 {
+			if nodeIndex >= len(p.Nodes) {
+				return tree.Root{}, fmt.Errorf("descriptor describes more than the %d nodes in the proof", len(p.Nodes))
+			}
+			r := p.Nodes[nodeIndex]
+			nodeIndex++
+			nodes[g] = r
+			return r, nil
+		}
+		if g.Depth() >= 62 {
+			return tree.Root{}, fmt.Errorf("descriptor describes a tree that is too deep")
+		}
+		left, err := visit(g << 1)
+		if err != nil {
+			return tree.Root{}, err
+		}
+		right, err := visit(g<<1 | 1)
+		if err != nil {
+			return tree.Root{}, err
+		}
+		r := hFn(left, right)
+		nodes[g] = r
+		return r, nil
+	}
+	root, err := visit(tree.RootGindex)
+	if err != nil {
+		return tree.Root{}, nil, err
+	}
+	if nodeIndex != len(p.Nodes) {
+		return tree.Root{}, nil, fmt.Errorf("descriptor describes %d nodes, but proof has %d", nodeIndex, len(p.Nodes))
+	}
+	if bitCount-bitIndex >= 8 {
+		return tree.Root{}, nil, fmt.Errorf("descriptor has too many bytes")
+	}
+	for ; bitIndex < bitCount; bitIndex++ {
+		if (p.Descriptor[bitIndex/8]>>(7-bitIndex%8))&1 != 0 {
+			return tree.Root{}, nil, fmt.Errorf("descriptor padding must be zero")
+		}
+	}
+	return root, nodes, nil
+}
+
+// BranchRoot computes the root of a single leaf proof, with the branch ordered from the bottom up.
+func BranchRoot(leaf tree.Root, index tree.Gindex64, branch []tree.Root) (tree.Root, error) {
+	gindices := BranchGindices(index)
+	if len(gindices) != len(branch) {
+		return tree.Root{}, fmt.Errorf("expected branch of %d nodes for gindex %d, got %d", len(gindices), index, len(branch))
+	}
+	witness := make(map[tree.Gindex64]tree.Root, len(branch))
+	for i, g := range gindices {
+		witness[g] = branch[i]
+	}
+	return MultiProofRoot(map[tree.Gindex64]tree.Root{index: leaf}, witness)
+}
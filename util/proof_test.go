@@ -0,0 +1,91 @@
+package util
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+)
+
+func TestCompactDescriptor(t *testing.T) {
+	cases := []struct {
+		name       string
+		leaves     []tree.Gindex64
+		descriptor Descriptor
+		included   []tree.Gindex64
+	}{
+		{"no leaves", gindices(), nil, gindices()},
+		{"root", gindices(1), Descriptor{0x80}, gindices(1)},
+		// pre-order 1 2 4 8 9 5 3: 0001111
+		{"single leaf", gindices(8), Descriptor{0x1e}, gindices(8, 9, 5, 3)},
+		// pre-order 1 2 4 8 9 5 3 6 7 14 15: 0001110 1011
+		{"opposite sides", gindices(8, 15), Descriptor{0x1d, 0x60}, gindices(8, 9, 5, 6, 14, 15)},
+		// the leaf 2 is computed from 4 and 5: 00111
+		{"leaf and ancestor", gindices(2, 4), Descriptor{0x38}, gindices(4, 5, 3)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			descriptor, included := CompactDescriptor(c.leaves)
+			if !bytes.Equal(descriptor, c.descriptor) {
+				t.Fatalf("got descriptor %x, expected %x", []byte(descriptor), []byte(c.descriptor))
+			}
+			if !reflect.DeepEqual(included, c.included) {
+				t.Fatalf("got included nodes %v, expected %v", included, c.included)
+			}
+		})
+	}
+}
+
+func TestCompactProofMerkleize(t *testing.T) {
+	nodes := testTree(3)
+	for _, leaves := range [][]tree.Gindex64{
+		gindices(1),
+		gindices(8),
+		gindices(8, 9),
+		gindices(8, 15),
+		gindices(2, 4),
+		gindices(3, 4, 10),
+	} {
+		descriptor, included := CompactDescriptor(leaves)
+		proof := CompactProof{Root: nodes[1], Descriptor: descriptor}
+		for _, g := range included {
+			proof.Nodes = append(proof.Nodes, nodes[g])
+		}
+		root, proofNodes, err := proof.Merkleize()
+		if err != nil {
+			t.Fatalf("leaves %v: unexpected error: %v", leaves, err)
+		}
+		if root != nodes[1] {
+			t.Fatalf("leaves %v: got root %s, expected %s", leaves, root, nodes[1])
+		}
+		for _, g := range leaves {
+			if proofNodes[g] != nodes[g] {
+				t.Fatalf("leaves %v: got node %d %s, expected %s", leaves, g, proofNodes[g], nodes[g])
+			}
+		}
+	}
+
+	cases := []struct {
+		name       string
+		descriptor Descriptor
+		nodes      int
+		err        string
+	}{
+		{"no bits", Descriptor{}, 0, "descriptor is too short"},
+		{"only intermediate nodes", Descriptor{0x00}, 0, "descriptor is too short"},
+		{"missing nodes", Descriptor{0x80}, 0, "more than the 0 nodes"},
+		{"extra nodes", Descriptor{0x80}, 2, "describes 1 nodes, but proof has 2"},
+		{"padding bits", Descriptor{0xc0}, 1, "padding must be zero"},
+		{"padding bytes", Descriptor{0x80, 0x00}, 1, "too many bytes"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			proof := CompactProof{Descriptor: c.descriptor, Nodes: make(RootList, c.nodes)}
+			if _, _, err := proof.Merkleize(); err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("got error %v, expected %q", err, c.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package util
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// RecordFormat is the output format of a RecordWriter: text, json, ndjson or csv. Empty is text.
+type RecordFormat string
+
+const (
+	TextRecords   RecordFormat = "text"
+	JSONRecords   RecordFormat = "json"
+	NDJSONRecords RecordFormat = "ndjson"
+	CSVRecords    RecordFormat = "csv"
+)
+
+func (f *RecordFormat) String() string {
+	if f == nil || *f == "" {
+		return string(TextRecords)
+	}
+	return string(*f)
+}
+
+func (f *RecordFormat) Set(v string) error {
+	if f == nil {
+		return fmt.Errorf("cannot decode format into nil pointer")
+	}
+	switch RecordFormat(v) {
+	case TextRecords, JSONRecords, NDJSONRecords, CSVRecords:
+		*f = RecordFormat(v)
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, expected text, json, ndjson or csv", v)
+	}
+}
+
+func (f *RecordFormat) Type() string {
+	return "output format (text, json, ndjson or csv)"
+}
+
+// RecordWriter writes a stream of records, all structs of the same type, in a RecordFormat.
+// The JSON, NDJSON and CSV field names are the json tags of the struct fields,
+// the text format uses the String method of the records.
+type RecordWriter struct {
+	w       io.Writer
+	format  RecordFormat
+	csv     *csv.Writer
+	typ     reflect.Type
+	records int
+}
+
+func NewRecordWriter(w io.Writer, format RecordFormat) *RecordWriter {
+	if format == "" {
+		format = TextRecords
+	}
+	out := &RecordWriter{w: w, format: format}
+	if format == CSVRecords {
+		out.csv = csv.NewWriter(w)
+	}
+	return out
+}
+
+// Textf writes a line in the text format, e.g. a section header, and is ignored by the other formats.
+func (w *RecordWriter) Textf(format string, args ...interface{}) error {
+	if w.format != TextRecords {
+		return nil
+	}
+	_, err := fmt.Fprintf(w.w, format+"\n", args...)
+	return err
+}
+
+// Write writes a record, a struct or a pointer to one.
+func (w *RecordWriter) Write(record interface{}) error {
+	typ := reflect.TypeOf(record)
+	if w.typ == nil {
+		w.typ = typ
+	} else if w.typ != typ {
+		return fmt.Errorf("cannot mix record types %s and %s", w.typ, typ)
+	}
+	defer func() { w.records++ }()
+	switch w.format {
+	case TextRecords:
+		_, err := fmt.Fprintln(w.w, record)
+		return err
+	case JSONRecords, NDJSONRecords:
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if w.format == JSONRecords {
+			sep := ",\n  "
+			if w.records == 0 {
+				sep = "[\n  "
+			}
+			_, err = fmt.Fprintf(w.w, "%s%s", sep, data)
+		} else {
+			_, err = fmt.Fprintf(w.w, "%s\n", data)
+		}
+		return err
+	case CSVRecords:
+		v := reflect.Indirect(reflect.ValueOf(record))
+		if v.Kind() != reflect.Struct {
+			return fmt.Errorf("cannot write %s as CSV record, expected a struct", typ)
+		}
+		fields := csvFields(v.Type())
+		if w.records == 0 {
+			header := make([]string, len(fields))
+			for i, f := range fields {
+				header[i] = f.name
+			}
+			if err := w.csv.Write(header); err != nil {
+				return err
+			}
+		}
+		row := make([]string, len(fields))
+		for i, f := range fields {
+			cell, err := csvValue(v.Field(f.index))
+			if err != nil {
+				return fmt.Errorf("failed to encode field %s: %v", f.name, err)
+			}
+			row[i] = cell
+		}
+		return w.csv.Write(row)
+	default:
+		return fmt.Errorf("unknown output format %q", w.format)
+	}
+}
+
+// Close ends the output: it closes the JSON list, or flushes the CSV writer.
+func (w *RecordWriter) Close() error {
+	switch w.format {
+	case JSONRecords:
+		end := "\n]\n"
+		if w.records == 0 {
+			end = "[]\n"
+		}
+		_, err := io.WriteString(w.w, end)
+		return err
+	case CSVRecords:
+		w.csv.Flush()
+		return w.csv.Error()
+	default:
+		return nil
+	}
+}
+
+type csvField struct {
+	name  string
+	index int
+}
+
+func csvFields(typ reflect.Type) (out []csvField) {
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		out = append(out, csvField{name: name, index: i})
+	}
+	return out
+}
+
+// csvValue encodes a field like JSON, but without the quotes of strings,
+// lists as space separated elements, and nil values as empty cells.
+func csvValue(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return "", nil
+		}
+	case reflect.Slice:
+		if _, ok := v.Interface().(json.Marshaler); !ok && v.Type().Elem().Kind() != reflect.Uint8 {
+			out := make([]string, v.Len())
+			for i := range out {
+				s, err := csvValue(v.Index(i))
+				if err != nil {
+					return "", err
+				}
+				out[i] = s
+			}
+			return strings.Join(out, " "), nil
+		}
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s, nil
+	}
+	return string(data), nil
+}
@@ -0,0 +1,106 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/protolambda/zrnt/eth2/beacon/common"
+)
+
+type testRecord struct {
+	Name    string                  `json:"name"`
+	Index   common.ValidatorIndex   `json:"index"`
+	Count   int                     `json:"count,string"`
+	Slot    *common.Slot            `json:"slot,omitempty"`
+	Indices []common.ValidatorIndex `json:"indices"`
+	Root    common.Root             `json:"root"`
+	Note    string                  `json:"-"`
+	Plain   bool
+	hidden  int
+}
+
+func (r *testRecord) String() string {
+	return fmt.Sprintf("record %s", r.Name)
+}
+
+func TestRecordWriter(t *testing.T) {
+	slot := common.Slot(7)
+	records := []*testRecord{
+		{Name: "a", Index: 1, Count: 2, Slot: &slot, Indices: []common.ValidatorIndex{3, 4}, Note: "x", hidden: 1},
+		{Name: "b,c", Index: 5, Plain: true},
+	}
+	root := "0x0000000000000000000000000000000000000000000000000000000000000000"
+	cases := []struct {
+		format  RecordFormat
+		records []*testRecord
+		want    string
+	}{
+		{TextRecords, records, "header\nrecord a\nrecord b,c\n"},
+		{"", records, "header\nrecord a\nrecord b,c\n"},
+		{JSONRecords, records, "[\n" +
+			`  {"name":"a","index":"1","count":"2","slot":"7","indices":["3","4"],"root":"` + root + `","Plain":false},` + "\n" +
+			`  {"name":"b,c","index":"5","count":"0","indices":null,"root":"` + root + `","Plain":true}` + "\n]\n"},
+		{JSONRecords, nil, "[]\n"},
+		{NDJSONRecords, records,
+			`{"name":"a","index":"1","count":"2","slot":"7","indices":["3","4"],"root":"` + root + `","Plain":false}` + "\n" +
+				`{"name":"b,c","index":"5","count":"0","indices":null,"root":"` + root + `","Plain":true}` + "\n"},
+		{CSVRecords, records, "name,index,count,slot,indices,root,Plain\n" +
+			"a,1,2,7,3 4," + root + ",false\n" +
+			"\"b,c\",5,0,,," + root + ",true\n"},
+		{CSVRecords, nil, ""},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s/%d", c.format.String(), len(c.records)), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewRecordWriter(&buf, c.format)
+			if err := w.Textf("header"); err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range c.records {
+				if err := w.Write(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != c.want {
+				t.Fatalf("got:\n%s\nexpected:\n%s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRecordWriterMixedTypes(t *testing.T) {
+	w := NewRecordWriter(new(bytes.Buffer), JSONRecords)
+	if err := w.Write(&testRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&struct{ Name string }{}); err == nil {
+		t.Fatal("expected an error for a record of another type")
+	}
+}
+
+func TestRecordFormatSet(t *testing.T) {
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{"text", true},
+		{"json", true},
+		{"ndjson", true},
+		{"csv", true},
+		{"yaml", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		var f RecordFormat
+		if err := f.Set(c.value); (err == nil) != c.valid {
+			t.Fatalf("format %q: got error %v, expected valid: %v", c.value, err, c.valid)
+		}
+		if c.valid && f.String() != c.value {
+			t.Fatalf("format %q: got %s", c.value, f.String())
+		}
+	}
+}
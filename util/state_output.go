@@ -6,12 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/golang/snappy"
-	"github.com/protolambda/zrnt/eth2/beacon"
-	"github.com/protolambda/zrnt/eth2/beacon/altair"
-	"github.com/protolambda/zrnt/eth2/beacon/bellatrix"
-	"github.com/protolambda/zrnt/eth2/beacon/capella"
+	"github.com/protolambda/zcli/spec_types"
 	"github.com/protolambda/zrnt/eth2/beacon/common"
-	"github.com/protolambda/zrnt/eth2/beacon/phase0"
 	"github.com/protolambda/ztyp/codec"
 	"gopkg.in/yaml.v3"
 	"io"
@@ -59,7 +55,7 @@ func (p *StateOutput) Write(spec *common.Spec, obj common.BeaconState) error {
 		defer w.Flush()
 		out = w
 	} else {
-		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0777)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0777)
 		if err != nil {
 			return err
 		}
@@ -88,22 +84,11 @@ func (p *StateOutput) Write(spec *common.Spec, obj common.BeaconState) error {
 		if err := obj.Serialize(enc); err != nil {
 			return err
 		}
-		var flat common.SpecObj
-		if up, ok := obj.(*beacon.StandardUpgradeableBeaconState); ok {
-			obj = up.BeaconState
-		}
-		switch obj.(type) {
-		case *phase0.BeaconStateView:
-			flat = new(phase0.BeaconState)
-		case *altair.BeaconStateView:
-			flat = new(altair.BeaconState)
-		case *bellatrix.BeaconStateView:
-			flat = new(bellatrix.BeaconState)
-		case *capella.BeaconStateView:
-			flat = new(capella.BeaconState)
-		default:
-			return fmt.Errorf("failed to detect state type for output: %T", obj)
+		fork, err := spec_types.ForkOfState(obj)
+		if err != nil {
+			return fmt.Errorf("failed to detect state type for output: %v", err)
 		}
+		flat := fork.NewState()
 		data := tmp.Bytes()
 		if err := flat.Deserialize(spec, codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))); err != nil {
 			return err
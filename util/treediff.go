@@ -0,0 +1,335 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+)
+
+// TreeDiff is a difference between two views of the same type, at a path of fields and indices.
+type TreeDiff struct {
+	Path []string
+	// Gindex of the differing node. Packed basic values share their node with neighbouring elements.
+	Gindex tree.Gindex64
+	A      view.View
+	B      view.View
+}
+
+func (d TreeDiff) String() string {
+	return fmt.Sprintf("%s: %s != %s", FormatPath(d.Path), FormatDiffValue(d.A), FormatDiffValue(d.B))
+}
+
+// MarshalJSON encodes the difference as an object with the path, gindex and both values.
+func (d TreeDiff) MarshalJSON() ([]byte, error) {
+	rec, err := d.Record()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rec)
+}
+
+// TreeDiffRecord is a TreeDiff with the values encoded, to write with a RecordWriter.
+type TreeDiffRecord struct {
+	Path   string          `json:"path"`
+	Gindex tree.Gindex64   `json:"gindex"`
+	A      json.RawMessage `json:"a"`
+	B      json.RawMessage `json:"b"`
+}
+
+func (r *TreeDiffRecord) String() string {
+	return fmt.Sprintf("%s (gindex %d): %s != %s", r.Path, r.Gindex, unquoteJSON(r.A), unquoteJSON(r.B))
+}
+
+// Record encodes the values of the difference, composite values by their hash-tree-root.
+func (d TreeDiff) Record() (*TreeDiffRecord, error) {
+	a, err := json.Marshal(diffValueJSON{d.A})
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(diffValueJSON{d.B})
+	if err != nil {
+		return nil, err
+	}
+	return &TreeDiffRecord{Path: FormatPath(d.Path), Gindex: d.Gindex, A: a, B: b}, nil
+}
+
+// diffValueJSON encodes a value like ViewJSON, but composite values by their hash-tree-root.
+type diffValueJSON struct {
+	View view.View
+}
+
+func (v diffValueJSON) MarshalJSON() ([]byte, error) {
+	if isCompositeType(v.View.Type()) {
+		return json.Marshal(v.View.HashTreeRoot(tree.GetHashFn()))
+	}
+	return ViewJSON{View: v.View}.MarshalJSON()
+}
+
+// isCompositeType checks if the type is compared by descending into it.
+func isCompositeType(typ view.TypeDef) bool {
+	switch t := typ.(type) {
+	case *view.ContainerTypeDef:
+		return true
+	case *view.BitListTypeDef, *view.BitVectorTypeDef:
+		return false
+	case view.ListTypeDef:
+		return !isByteType(t.ElementType())
+	case view.VectorTypeDef:
+		return !isByteType(t.ElementType())
+	default:
+		return false
+	}
+}
+
+// FormatDiffValue formats a value like diffValueJSON, without the quotes of strings.
+func FormatDiffValue(v view.View) string {
+	data, err := json.Marshal(diffValueJSON{View: v})
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return unquoteJSON(data)
+}
+
+// unquoteJSON returns a JSON string without the quotes, and other JSON values as-is.
+func unquoteJSON(data []byte) string {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s
+	}
+	return string(data)
+}
+
+var errDiffLimit = errors.New("diff limit reached")
+
+// DiffOptions configures DiffTrees.
+type DiffOptions struct {
+	// Limit stops the walk after this many differences, if larger than 0.
+	Limit int
+	// MaxDepth stops descending at this many path elements, if larger than 0.
+	// Differing composite values at the maximum depth are reported as a whole.
+	MaxDepth int
+	// Ignore skips the differences at these paths, and within them. A "*" path element matches any field or index.
+	Ignore [][]string
+}
+
+// CheckIgnore checks that the ignored paths exist in the type.
+func (opts *DiffOptions) CheckIgnore(typ view.TypeDef) error {
+	for _, path := range opts.Ignore {
+		// any index is fine to check a wildcard in a list or vector
+		concrete := make([]string, len(path))
+		for i, key := range path {
+			if key == "*" {
+				key = "0"
+			}
+			concrete[i] = key
+		}
+		if _, err := ResolvePath(typ, concrete); err != nil {
+			return fmt.Errorf("invalid ignored path %s: %v", FormatPath(path), err)
+		}
+	}
+	return nil
+}
+
+func (opts *DiffOptions) ignored(path []string) bool {
+outer:
+	for _, ign := range opts.Ignore {
+		if len(path) < len(ign) {
+			continue
+		}
+		for i, key := range ign {
+			if key != "*" && key != path[i] {
+				continue outer
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// DiffTrees compares two views of the same type by walking both merkle trees,
+// descending only into the subtrees whose roots differ.
+// Basic values, byte-vectors, byte-lists and bitfields are compared as a whole,
+// lists of different lengths are reported with a "__len__" path element, and then compared up to the shortest length.
+func DiffTrees(a, b view.View, opts DiffOptions) ([]TreeDiff, error) {
+	d := &treeDiffer{hFn: tree.GetHashFn(), opts: opts}
+	if err := d.diff(a.Type(), a.Backing(), b.Backing(), nil, tree.RootGindex); err != nil && err != errDiffLimit {
+		return nil, err
+	}
+	return d.out, nil
+}
+
+type treeDiffer struct {
+	hFn  tree.HashFn
+	opts DiffOptions
+	out  []TreeDiff
+}
+
+func (d *treeDiffer) add(path []string, g tree.Gindex64, a, b view.View) error {
+	if d.opts.ignored(path) {
+		return nil
+	}
+	d.out = append(d.out, TreeDiff{Path: path, Gindex: g, A: a, B: b})
+	if d.opts.Limit > 0 && len(d.out) >= d.opts.Limit {
+		return errDiffLimit
+	}
+	return nil
+}
+
+func subPath(path []string, key string) []string {
+	return append(append(make([]string, 0, len(path)+1), path...), key)
+}
+
+func (d *treeDiffer) diff(typ view.TypeDef, a, b tree.Node, path []string, g tree.Gindex64) error {
+	if a.MerkleRoot(d.hFn) == b.MerkleRoot(d.hFn) || d.opts.ignored(path) {
+		return nil
+	}
+	if !isCompositeType(typ) || (d.opts.MaxDepth > 0 && len(path) >= d.opts.MaxDepth) {
+		return d.value(typ, a, b, path, g)
+	}
+	switch t := typ.(type) {
+	case *view.ContainerTypeDef:
+		return d.walk(a, b, tree.CoverDepth(t.FieldCount()), 0, g, func(i uint64, a, b tree.Node, g tree.Gindex64) error {
+			if i >= uint64(len(t.Fields)) {
+				return nil
+			}
+			f := t.Fields[i]
+			return d.diff(f.Type, a, b, subPath(path, f.Name), g)
+		})
+	case view.ListTypeDef:
+		aLen, err := listLength(a)
+		if err != nil {
+			return fmt.Errorf("failed to read length of A at %s: %v", FormatPath(path), err)
+		}
+		bLen, err := listLength(b)
+		if err != nil {
+			return fmt.Errorf("failed to read length of B at %s: %v", FormatPath(path), err)
+		}
+		length := aLen
+		if aLen != bLen {
+			if err := d.add(subPath(path, LengthKey), g*2+1, view.Uint64View(aLen), view.Uint64View(bLen)); err != nil {
+				return err
+			}
+			if bLen < length {
+				length = bLen
+			}
+		}
+		aContents, err := a.Left()
+		if err != nil {
+			return err
+		}
+		bContents, err := b.Left()
+		if err != nil {
+			return err
+		}
+		return d.elems(t.ElementType(), aContents, bContents, t.Limit(), length, path, g*2)
+	case view.VectorTypeDef:
+		return d.elems(t.ElementType(), a, b, t.Length(), t.Length(), path, g)
+	default:
+		return fmt.Errorf("unexpected composite type %s", typ.String())
+	}
+}
+
+// elems compares the first length elements of the contents of a list or vector.
+// Basic elements are packed into 32-byte nodes.
+func (d *treeDiffer) elems(elemType view.TypeDef, a, b tree.Node, limit uint64, length uint64, path []string, g tree.Gindex64) error {
+	basic, ok := elemType.(view.BasicTypeDef)
+	if !ok {
+		return d.walk(a, b, tree.CoverDepth(limit), 0, g, func(i uint64, a, b tree.Node, g tree.Gindex64) error {
+			if i >= length {
+				return nil
+			}
+			return d.diff(elemType, a, b, subPath(path, strconv.FormatUint(i, 10)), g)
+		})
+	}
+	size := basic.TypeByteLength()
+	perNode := 32 / size
+	return d.walk(a, b, tree.CoverDepth((limit+perNode-1)/perNode), 0, g, func(i uint64, a, b tree.Node, g tree.Gindex64) error {
+		aRoot, aOk := a.(*tree.Root)
+		bRoot, bOk := b.(*tree.Root)
+		if !aOk || !bOk {
+			return fmt.Errorf("expected bottom nodes for packed elements at %s", FormatPath(path))
+		}
+		for j := uint64(0); j < perNode && i*perNode+j < length; j++ {
+			if bytes.Equal(aRoot[j*size:(j+1)*size], bRoot[j*size:(j+1)*size]) {
+				continue
+			}
+			aVal, err := basic.BasicViewFromBacking(aRoot, uint8(j))
+			if err != nil {
+				return err
+			}
+			bVal, err := basic.BasicViewFromBacking(bRoot, uint8(j))
+			if err != nil {
+				return err
+			}
+			if err := d.add(subPath(path, strconv.FormatUint(i*perNode+j, 10)), g, aVal, bVal); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// walk visits the pairs of nodes at the given depth, in order, skipping the subtrees with equal roots.
+// The nodes a and b are at gindex g, the visited nodes are passed with their index and gindex.
+func (d *treeDiffer) walk(a, b tree.Node, depth uint8, index uint64, g tree.Gindex64, visit func(i uint64, a, b tree.Node, g tree.Gindex64) error) error {
+	if a.MerkleRoot(d.hFn) == b.MerkleRoot(d.hFn) {
+		return nil
+	}
+	if depth == 0 {
+		return visit(index, a, b, g)
+	}
+	aLeft, aRight, err := children(a, depth)
+	if err != nil {
+		return err
+	}
+	bLeft, bRight, err := children(b, depth)
+	if err != nil {
+		return err
+	}
+	if err := d.walk(aLeft, bLeft, depth-1, index*2, g*2, visit); err != nil {
+		return err
+	}
+	return d.walk(aRight, bRight, depth-1, index*2+1, g*2+1, visit)
+}
+
+// children gets the child nodes of a node at the given depth above the bottom,
+// expanding the zero-hash subtrees, which are represented by a single node.
+func children(node tree.Node, depth uint8) (left tree.Node, right tree.Node, err error) {
+	if r, ok := node.(*tree.Root); ok && *r == tree.ZeroHashes[depth] {
+		zero := tree.ZeroNode(uint32(depth) - 1)
+		return zero, zero, nil
+	}
+	if left, err = node.Left(); err != nil {
+		return nil, nil, err
+	}
+	if right, err = node.Right(); err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
+
+func (d *treeDiffer) value(typ view.TypeDef, a, b tree.Node, path []string, g tree.Gindex64) error {
+	aVal, err := typ.ViewFromBacking(a, nil)
+	if err != nil {
+		return err
+	}
+	bVal, err := typ.ViewFromBacking(b, nil)
+	if err != nil {
+		return err
+	}
+	return d.add(path, g, aVal, bVal)
+}
+
+func listLength(node tree.Node) (uint64, error) {
+	lenNode, err := node.Right()
+	if err != nil {
+		return 0, err
+	}
+	length, err := view.AsUint64(view.Uint64Type.ViewFromBacking(lenNode, nil))
+	return uint64(length), err
+}
@@ -0,0 +1,168 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/protolambda/ztyp/tree"
+	"github.com/protolambda/ztyp/view"
+)
+
+var (
+	diffTestItemType = view.ContainerType("Item", []view.FieldDef{
+		{Name: "x", Type: view.Uint64Type},
+		{Name: "y", Type: view.Uint64Type},
+	})
+	diffTestType = view.ContainerType("Test", []view.FieldDef{
+		{Name: "a", Type: view.Uint64Type},
+		{Name: "numbers", Type: view.BasicListType(view.Uint64Type, 64)},
+		{Name: "items", Type: view.ComplexListType(diffTestItemType, 16)},
+		{Name: "balances", Type: view.BasicVectorType(view.Uint64Type, 16)},
+	})
+)
+
+type diffTestItem struct{ x, y uint64 }
+
+// diffTestValue describes a value of diffTestType, balances are only set if not nil.
+type diffTestValue struct {
+	a        uint64
+	numbers  []uint64
+	items    []diffTestItem
+	balances map[uint64]uint64
+}
+
+func (v *diffTestValue) view(t *testing.T) view.View {
+	t.Helper()
+	c := diffTestType.New()
+	check := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(c.Set(0, view.Uint64View(v.a)))
+	numbers := view.BasicListType(view.Uint64Type, 64).New()
+	for _, n := range v.numbers {
+		check(numbers.Append(view.Uint64View(n)))
+	}
+	check(c.Set(1, numbers))
+	items := view.ComplexListType(diffTestItemType, 16).New()
+	for _, it := range v.items {
+		item := diffTestItemType.New()
+		check(item.Set(0, view.Uint64View(it.x)))
+		check(item.Set(1, view.Uint64View(it.y)))
+		check(items.Append(item))
+	}
+	check(c.Set(2, items))
+	if v.balances != nil {
+		balances := view.BasicVectorType(view.Uint64Type, 16).New()
+		for i, b := range v.balances {
+			check(balances.Set(i, view.Uint64View(b)))
+		}
+		check(c.Set(3, balances))
+	} else {
+		// a zero subtree, represented by a single node, like in a tree that was loaded from its roots
+		zero := tree.Root(tree.ZeroHashes[2])
+		balances, err := view.BasicVectorType(view.Uint64Type, 16).ViewFromBacking(&zero, nil)
+		check(err)
+		check(c.Set(3, balances))
+	}
+	return c
+}
+
+// diffSummary is a difference as path, gindex and formatted values.
+type diffSummary struct {
+	path   string
+	gindex tree.Gindex64
+	a, b   string
+}
+
+func TestDiffTrees(t *testing.T) {
+	base := diffTestValue{
+		a:       1,
+		numbers: []uint64{10, 11, 12},
+		items:   []diffTestItem{{1, 2}, {3, 4}},
+	}
+	cases := []struct {
+		name string
+		a, b diffTestValue
+		opts DiffOptions
+		want []diffSummary
+	}{
+		{"equal", base, base, DiffOptions{}, nil},
+		{"basic field", base, diffTestValue{a: 2, numbers: base.numbers, items: base.items}, DiffOptions{},
+			[]diffSummary{{"a", 4, "1", "2"}}},
+		// 4 numbers are packed per node, the contents are at gindex 10, with a depth of 4
+		{"packed element", base, diffTestValue{a: 1, numbers: []uint64{10, 13, 12}, items: base.items}, DiffOptions{},
+			[]diffSummary{{"numbers[1]", 160, "11", "13"}}},
+		{"list length", base, diffTestValue{a: 1, numbers: []uint64{10, 11, 12, 13, 14}, items: base.items}, DiffOptions{},
+			[]diffSummary{{"numbers.__len__", 11, "3", "5"}}},
+		{"list length and shared element", base, diffTestValue{a: 1, numbers: []uint64{10, 9, 12, 13}, items: base.items}, DiffOptions{},
+			[]diffSummary{{"numbers.__len__", 11, "3", "4"}, {"numbers[1]", 160, "11", "9"}}},
+		// the items are at gindex 12, with a depth of 4, and have 2 fields
+		{"container element", base, diffTestValue{a: 1, numbers: base.numbers, items: []diffTestItem{{1, 2}, {5, 6}}}, DiffOptions{},
+			[]diffSummary{{"items[1].x", 386, "3", "5"}, {"items[1].y", 387, "4", "6"}}},
+		// the balances are at gindex 7, 16 balances are packed in 4 nodes
+		{"zero subtree", base, diffTestValue{a: 1, numbers: base.numbers, items: base.items, balances: map[uint64]uint64{13: 7}}, DiffOptions{},
+			[]diffSummary{{"balances[13]", 7*4 + 3, "0", "7"}}},
+		{"ignore wildcard", base, diffTestValue{a: 2, numbers: base.numbers, items: []diffTestItem{{1, 7}, {5, 6}}},
+			DiffOptions{Ignore: [][]string{{"items", "*", "y"}}},
+			[]diffSummary{{"a", 4, "1", "2"}, {"items[1].x", 386, "3", "5"}}},
+		{"ignore subtree", base, diffTestValue{a: 2, numbers: base.numbers, items: []diffTestItem{{1, 7}, {5, 6}}},
+			DiffOptions{Ignore: [][]string{{"items"}}},
+			[]diffSummary{{"a", 4, "1", "2"}}},
+		{"max depth", base, diffTestValue{a: 2, numbers: base.numbers, items: []diffTestItem{{1, 7}}},
+			DiffOptions{MaxDepth: 1},
+			[]diffSummary{{"a", 4, "1", "2"}, {"items", 6, "", ""}}},
+		{"limit", base, diffTestValue{a: 2, numbers: []uint64{9, 9, 9}, items: base.items}, DiffOptions{Limit: 2},
+			[]diffSummary{{"a", 4, "1", "2"}, {"numbers[0]", 160, "10", "9"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a, b := c.a.view(t), c.b.view(t)
+			diffs, err := DiffTrees(a, b, c.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(diffs) != len(c.want) {
+				t.Fatalf("got %d differences %v, expected %d", len(diffs), diffs, len(c.want))
+			}
+			for i, d := range diffs {
+				want := c.want[i]
+				if want.a == "" {
+					// composite values are formatted as their root
+					want.a = FormatDiffValue(d.A)
+					want.b = FormatDiffValue(d.B)
+					if want.a == want.b {
+						t.Fatalf("difference %d has equal values %s", i, want.a)
+					}
+				}
+				got := diffSummary{FormatPath(d.Path), d.Gindex, FormatDiffValue(d.A), FormatDiffValue(d.B)}
+				if got != want {
+					t.Fatalf("difference %d: got %+v, expected %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffOptionsCheckIgnore(t *testing.T) {
+	cases := []struct {
+		name  string
+		paths [][]string
+		valid bool
+	}{
+		{"field", [][]string{{"a"}}, true},
+		{"wildcard element field", [][]string{{"items", "*", "y"}}, true},
+		{"list length", [][]string{{"numbers", LengthKey}}, true},
+		{"unknown field", [][]string{{"b"}}, false},
+		{"unknown element field", [][]string{{"items", "*", "z"}}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := DiffOptions{Ignore: c.paths}
+			if err := opts.CheckIgnore(diffTestType); (err == nil) != c.valid {
+				t.Fatalf("got error %v, expected valid: %v", err, c.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/protolambda/ztyp/codec"
+	"github.com/protolambda/ztyp/conv"
+	"github.com/protolambda/ztyp/view"
+)
+
+// TreeView converts a flat-structure object into a tree-backed view of the given type, by passing it through SSZ.
+func TreeView(obj codec.Serializable, typ view.TypeDef) (view.View, error) {
+	var buf bytes.Buffer
+	if err := obj.Serialize(codec.NewEncodingWriter(&buf)); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	dec := codec.NewDecodingReader(bytes.NewReader(data), uint64(len(data)))
+	return typ.Deserialize(dec)
+}
+
+// ViewJSON encodes any view as JSON, with the same conventions as the flat spec types:
+// containers as objects, uints as strings, and byte-vectors, byte-lists and bitfields as hex strings.
+type ViewJSON struct {
+	View view.View
+}
+
+func (v ViewJSON) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeViewJSON(&buf, v.View); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isByteType(typ view.TypeDef) bool {
+	return typ == view.Uint8Type
+}
+
+func writeViewJSON(buf *bytes.Buffer, v view.View) error {
+	switch typ := v.Type().(type) {
+	case *view.ContainerTypeDef:
+		c, err := view.AsContainer(v, nil)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte('{')
+		for i, f := range typ.Fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(f.Name)
+			buf.Write(key)
+			buf.WriteByte(':')
+			fv, err := c.Get(uint64(i))
+			if err != nil {
+				return fmt.Errorf("failed to get field %s: %v", f.Name, err)
+			}
+			if err := writeViewJSON(buf, fv); err != nil {
+				return fmt.Errorf("field %s: %v", f.Name, err)
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case *view.BitListTypeDef, *view.BitVectorTypeDef:
+		return writeSSZHex(buf, v)
+	case view.ListTypeDef:
+		if isByteType(typ.ElementType()) {
+			return writeSSZHex(buf, v)
+		}
+		return writeElemsJSON(buf, v)
+	case view.VectorTypeDef:
+		if isByteType(typ.ElementType()) {
+			return writeSSZHex(buf, v)
+		}
+		return writeElemsJSON(buf, v)
+	default:
+		// basic values, roots and small byte vectors know how to encode themselves
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+}
+
+func writeSSZHex(buf *bytes.Buffer, v view.View) error {
+	var tmp bytes.Buffer
+	if err := v.Serialize(codec.NewEncodingWriter(&tmp)); err != nil {
+		return err
+	}
+	data, err := conv.BytesMarshalText(tmp.Bytes())
+	if err != nil {
+		return err
+	}
+	buf.WriteByte('"')
+	buf.Write(data)
+	buf.WriteByte('"')
+	return nil
+}
+
+func writeElemsJSON(buf *bytes.Buffer, v view.View) error {
+	var length uint64
+	var get func(i uint64) (view.View, error)
+	switch x := v.(type) {
+	case *view.ComplexListView:
+		n, err := x.Length()
+		if err != nil {
+			return err
+		}
+		length, get = n, x.Get
+	case *view.ComplexVectorView:
+		length, get = x.VectorLength, x.Get
+	case *view.BasicListView:
+		n, err := x.Length()
+		if err != nil {
+			return err
+		}
+		length = n
+		get = func(i uint64) (view.View, error) { return x.Get(i) }
+	case *view.BasicVectorView:
+		length = x.VectorLength
+		get = func(i uint64) (view.View, error) { return x.Get(i) }
+	default:
+		return fmt.Errorf("unsupported sequence view type %T", v)
+	}
+	buf.WriteByte('[')
+	for i := uint64(0); i < length; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		el, err := get(i)
+		if err != nil {
+			return fmt.Errorf("failed to get element %d: %v", i, err)
+		}
+		if err := writeViewJSON(buf, el); err != nil {
+			return fmt.Errorf("element %d: %v", i, err)
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}